@@ -1,8 +1,9 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -10,51 +11,118 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 
 	"github.com/alecthomas/kong"
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer"
 )
 
-var config struct {
-	BackendURL         *url.URL     `name:"backend.addr" help:"The URL of the backend to upstream to"`
-	ListenURL          *net.TCPAddr `name:"listen.addr" help:"The URL for the reverse proxy to listen on"`
-	TlsCertFile        string       `name:"tls.certfile" help:"The file path of the TLS cert file on disk, if you want to serve TLS"`
-	TlsKeyFile         string       `name:"tls.keyfile" help:"The file path of the TLS key file on disk, if you want to serve TLS"`
-	BouncersConfigFile string       `name:"config" help:"The file containing the list of bouncers to create"`
+var cli struct {
+	Serve  serveCmd  `cmd:"" default:"withargs" help:"Run the bouncing reverse proxy (the default)"`
+	Schema schemaCmd `cmd:"" help:"Print a JSON Schema describing the bouncers config file"`
 }
 
-func loadBouncersFromFile() ([]bouncer.Bouncer, error) {
-	jsonFile, err := os.Open(config.BouncersConfigFile)
+type serveCmd struct {
+	BackendURL         *url.URL `name:"backend.addr" help:"The URL of the backend to upstream to"`
+	ListenAddr         string   `name:"listen.addr" help:"The address for the reverse proxy to listen on"`
+	TlsCertFile        string   `name:"tls.certfile" help:"The file path of the TLS cert file on disk, if you want to serve TLS"`
+	TlsKeyFile         string   `name:"tls.keyfile" help:"The file path of the TLS key file on disk, if you want to serve TLS"`
+	BouncersConfigFile string   `name:"config" help:"The file containing the list of bouncers to create"`
+	MetricsAddr        string   `name:"metrics.addr" help:"The address to serve Prometheus metrics on, if you want them"`
+	ApprovalsAddr      string   `name:"approvals.addr" help:"The address to serve the approvals API on, if you use approval mode"`
+
+	// OldBouncersConfigFile is what --config used to be called, which still works so that upgrading doesn't break anyone.
+	OldBouncersConfigFile string `name:"config.bouncersfile" hidden:"" help:"Deprecated, use --config"`
+}
+
+type schemaCmd struct{}
+
+func loadConfigFromFile(path string) (bouncer.Config, error) {
+	jsonFile, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return bouncer.Config{}, err
 	}
 	defer jsonFile.Close()
 
 	bytes, err := io.ReadAll(jsonFile)
 	if err != nil {
-		return nil, err
+		return bouncer.Config{}, err
 	}
 
-	return bouncer.ParseBouncers(bytes)
+	return bouncer.ParseConfig(bytes)
 }
 
 func main() {
-	kong.Parse(&config)
+	ctx := kong.Parse(&cli)
+	ctx.FatalIfErrorf(ctx.Run())
+}
+
+func (s *schemaCmd) Run() error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(bouncer.Schema(bouncer.DefaultRegistry))
+}
+
+func (s *serveCmd) Run() error {
+	if s.BouncersConfigFile == "" {
+		s.BouncersConfigFile = s.OldBouncersConfigFile
+	}
+
+	if s.BackendURL == nil || s.ListenAddr == "" {
+		return fmt.Errorf("--backend.addr and --listen.addr must be set")
+	}
 
-	bouncers, err := loadBouncersFromFile()
+	config, err := loadConfigFromFile(s.BouncersConfigFile)
 	if err != nil {
-		log.Fatal().Str("file", config.BouncersConfigFile).Err(err).Msg("Failed to parse bouncers")
+		log.Fatal().Str("file", s.BouncersConfigFile).Err(err).Msg("Failed to parse bouncers")
 	}
 
-	log.Debug().Msgf("Loaded %d bouncers\n", len(bouncers))
+	log.Debug().Msgf("Loaded %d bouncers\n", len(config.Bouncers))
 
-	proxy := bouncer.NewBouncingReverseProxy(config.BackendURL, bouncers, nil)
+	proxy := bouncer.NewBouncingReverseProxyWithConfig(s.BackendURL, config, nil)
 	server := http.Server{
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		Handler:      proxy,
-		Addr:         config.ListenURL.String(),
+		Addr:         s.ListenAddr,
+	}
+
+	if s.MetricsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.Handler())
+			metricsServer := http.Server{
+				ReadTimeout:  10 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				Handler:      mux,
+				Addr:         s.MetricsAddr,
+			}
+
+			if err := metricsServer.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatal().Err(err).Msg("Got an error while serving metrics")
+			}
+		}()
+	}
+
+	// The approvals API is served on its own listener, so that it can be kept away from everyone that can reach the proxy.
+	if s.ApprovalsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle(bouncer.ApprovalsPath+"/", bouncer.NewApprovalHandler(proxy))
+			approvalsServer := http.Server{
+				ReadTimeout:  10 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				Handler:      mux,
+				Addr:         s.ApprovalsAddr,
+			}
+
+			if err := approvalsServer.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatal().Err(err).Msg("Got an error while serving the approvals API")
+			}
+		}()
+	} else if config.Approvals != nil {
+		log.Warn().Msg("Approvals are configured, but --approvals.addr isn't set, so held requests can't be approved")
 	}
 
 	sigChan := make(chan os.Signal, 1)
@@ -62,24 +130,26 @@ func main() {
 	go func() {
 		for {
 			<-sigChan
-			log.Printf("Received a SIGHUP. Reloading Bouncers from %s", config.BouncersConfigFile)
-			bouncers, err := loadBouncersFromFile()
+			log.Printf("Received a SIGHUP. Reloading Bouncers from %s", s.BouncersConfigFile)
+			config, err := loadConfigFromFile(s.BouncersConfigFile)
 			if err != nil {
-				log.Printf("Failed to parse bouncers from %s: %s. Aboring Reload.", config.BouncersConfigFile, err.Error())
+				log.Printf("Failed to parse bouncers from %s: %s. Aborting Reload.", s.BouncersConfigFile, err.Error())
+				continue
 			}
 
-			if err := bouncer.SetBouncers(bouncers, proxy); err != nil {
+			if err := bouncer.SetConfig(config, proxy); err != nil {
 				log.Printf("Failed to set bouncers on proxy: %s. Aborting Reload.", err.Error())
+				config.Close()
 			}
 		}
 	}()
 
-	if config.TlsCertFile != "" && config.TlsKeyFile != "" {
-		err = server.ListenAndServeTLS(config.TlsCertFile, config.TlsKeyFile)
+	if s.TlsCertFile != "" && s.TlsKeyFile != "" {
+		err = server.ListenAndServeTLS(s.TlsCertFile, s.TlsKeyFile)
 	} else {
-		if config.TlsCertFile != "" {
+		if s.TlsCertFile != "" {
 			log.Fatal().Msg("TLS Cert file given without TLS Key File. Bailing.")
-		} else if config.TlsKeyFile != "" {
+		} else if s.TlsKeyFile != "" {
 			log.Fatal().Msg("TLS Key file given without TLS Config File. Bailing.")
 		}
 		err = server.ListenAndServe()
@@ -88,4 +158,6 @@ func main() {
 	if err != http.ErrServerClosed {
 		log.Fatal().Err(err).Msg("Got an error while serving HTTP")
 	}
+
+	return nil
 }
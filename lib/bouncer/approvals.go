@@ -0,0 +1,586 @@
+package bouncer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+const (
+	// ApprovalsPath is where the approvals API is served by the bouncer.
+	ApprovalsPath = "/-/bouncer/approvals"
+
+	// HeaderApprovalID is the header that the ID of a request waiting for approval is returned in.
+	HeaderApprovalID = "X-Bouncer-Approval-ID"
+	// HeaderApprovedBy is added to requests that are sent to the backend after being approved, with who approved them.
+	HeaderApprovedBy = "X-Bouncer-Approved-By"
+
+	// ReasonPendingApproval is the reason given for requests that are held for approval.
+	ReasonPendingApproval = "pending_approval"
+
+	defaultApprovalTTL = 24 * time.Hour
+)
+
+var approvalsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "alertmanager_bouncer_approvals_total",
+	Help: "The number of requests held for approval, and what happened to them",
+}, []string{"result"})
+
+// Approvals configures the two person approval workflow. Requests rejected by deciders in approval mode are held, rather than
+// rejected, until someone other than the person that made them approves them through the approvals API. Requests without an
+// identity can't be held, because there would be no way to tell who made them.
+type Approvals struct {
+	// StoreFile is where held requests are kept, so that restarting the bouncer doesn't lose them. If it's empty, they're only kept in memory.
+	StoreFile string `yaml:"storeFile"`
+
+	// TTL is how long requests are held for before they expire. Defaults to 24 hours.
+	TTL time.Duration `yaml:"ttl"`
+
+	// IdentityHeader is the header that the identities of requesters and approvers are read from. Defaults to X-Forwarded-User.
+	IdentityHeader string `yaml:"identityHeader"`
+
+	// Approvers are the only identities that can approve, reject, and list requests, if it's set. Otherwise anyone can, except
+	// that requesters can't approve their own requests. Requesters can always see and reject their own requests.
+	Approvers []string `yaml:"approvers"`
+}
+
+// PendingApproval is a request that is being held until it's approved.
+type PendingApproval struct {
+	ID        string    `json:"id"`
+	Method    string    `json:"method"`
+	URI       string    `json:"uri"`
+	Body      string    `json:"body"`
+	Requester string    `json:"requester"`
+	Reasons   []string  `json:"reasons"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// Header is the headers of the original request, without hop-by-hop headers, so that the request sent to the backend once it's
+	// approved is the one that was held. This can include credentials, so StoreFile is only readable by the bouncer.
+	Header http.Header `json:"header,omitempty"`
+}
+
+// pendingApprovalBody is the body of the response to requests that are held for approval.
+type pendingApprovalBody struct {
+	Status     string    `json:"status"`
+	ApprovalID string    `json:"approvalID"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Reasons    []string  `json:"reasons"`
+}
+
+// approvalStore holds requests until they're approved, rejected, or expire.
+type approvalStore struct {
+	config  Approvals
+	now     func() time.Time
+	lock    sync.Mutex
+	loaded  bool
+	pending map[string]*PendingApproval
+}
+
+func newApprovalStore(config Approvals) (*approvalStore, error) {
+	if config.TTL < 0 {
+		return nil, fmt.Errorf("approvals.ttl must be positive")
+	}
+
+	if config.TTL == 0 {
+		config.TTL = defaultApprovalTTL
+	}
+
+	return &approvalStore{
+		config:  config,
+		now:     time.Now,
+		pending: make(map[string]*PendingApproval),
+	}, nil
+}
+
+// loadLocked reads StoreFile the first time that the store is used, rather than when the config is parsed, because reloads keep
+// using the old store if Approvals hasn't changed, and it's the only thing that should be touching the file. The lock must be held.
+func (s *approvalStore) loadLocked() error {
+	if s.loaded {
+		return nil
+	}
+
+	if s.config.StoreFile != "" {
+		contents, err := os.ReadFile(s.config.StoreFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to read approvals store: %w", err)
+		}
+
+		if err == nil {
+			if err := json.Unmarshal(contents, &s.pending); err != nil {
+				return fmt.Errorf("failed to parse approvals store %s: %w", s.config.StoreFile, err)
+			}
+		}
+	}
+
+	s.loaded = true
+	return nil
+}
+
+// hold stores the given request, which has been rejected with the given errors by deciders in approval mode.
+func (s *approvalStore) hold(req *http.Request, body []byte, rejections []*deciders.HTTPError) (*PendingApproval, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	reasons := make([]string, 0, len(rejections))
+	for _, rejection := range rejections {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", rejection.Decider, rejection.Err))
+	}
+
+	now := s.now()
+	approval := &PendingApproval{
+		ID:        hex.EncodeToString(id),
+		Method:    req.Method,
+		URI:       req.URL.RequestURI(),
+		Body:      string(body),
+		Header:    heldHeader(req.Header),
+		Requester: deciders.Identity(req, s.config.IdentityHeader),
+		Reasons:   reasons,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.config.TTL),
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.loadLocked(); err != nil {
+		return nil, err
+	}
+
+	s.expireLocked()
+	s.pending[approval.ID] = approval
+	if err := s.saveLocked(); err != nil {
+		delete(s.pending, approval.ID)
+		return nil, err
+	}
+
+	approvalsTotal.WithLabelValues("pending").Inc()
+	return approval, nil
+}
+
+// list returns all the requests that are waiting for approval, oldest first.
+func (s *approvalStore) list() ([]PendingApproval, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.loadLocked(); err != nil {
+		return nil, err
+	}
+
+	s.expireLocked()
+	approvals := make([]PendingApproval, 0, len(s.pending))
+	for _, approval := range s.pending {
+		approvals = append(approvals, *approval)
+	}
+
+	sort.Slice(approvals, func(i, j int) bool {
+		return approvals[i].CreatedAt.Before(approvals[j].CreatedAt)
+	})
+
+	return approvals, nil
+}
+
+func (s *approvalStore) get(id string) (PendingApproval, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.loadLocked(); err != nil {
+		return PendingApproval{}, false, err
+	}
+
+	s.expireLocked()
+	approval, ok := s.pending[id]
+	if !ok {
+		return PendingApproval{}, false, nil
+	}
+
+	return *approval, true, nil
+}
+
+// remove takes the request with the given ID out of the store, so that it can only be approved or rejected once.
+func (s *approvalStore) remove(id string) (PendingApproval, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.loadLocked(); err != nil {
+		return PendingApproval{}, false, err
+	}
+
+	s.expireLocked()
+	approval, ok := s.pending[id]
+	if !ok {
+		return PendingApproval{}, false, nil
+	}
+
+	delete(s.pending, id)
+	if err := s.saveLocked(); err != nil {
+		s.pending[id] = approval
+		return PendingApproval{}, false, err
+	}
+
+	return *approval, true, nil
+}
+
+// expireLocked forgets requests that have been waiting for longer than the TTL. The lock must be held.
+func (s *approvalStore) expireLocked() {
+	now := s.now()
+	expired := 0
+	for id, approval := range s.pending {
+		if now.After(approval.ExpiresAt) {
+			delete(s.pending, id)
+			expired++
+		}
+	}
+
+	if expired == 0 {
+		return
+	}
+
+	approvalsTotal.WithLabelValues("expired").Add(float64(expired))
+	if err := s.saveLocked(); err != nil {
+		log.Warn().Err(err).Str("file", s.config.StoreFile).Msg("Failed to save approvals store")
+	}
+}
+
+// saveLocked writes the store to StoreFile, through a temporary file so that a crash half way through doesn't leave a broken store.
+// The lock must be held.
+func (s *approvalStore) saveLocked() error {
+	if s.config.StoreFile == "" {
+		return nil
+	}
+
+	contents, err := json.Marshal(s.pending)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.config.StoreFile), filepath.Base(s.config.StoreFile)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.config.StoreFile)
+}
+
+// canApprove returns an error if the given identity isn't allowed to approve the given request.
+func (s *approvalStore) canApprove(approval PendingApproval, identity string) *deciders.HTTPError {
+	if identity == "" {
+		return missingIdentity("approving requests requires an identity")
+	}
+
+	if identity == approval.Requester {
+		return &deciders.HTTPError{
+			Status: http.StatusForbidden,
+			Err:    "requests must be approved by someone other than the person that made them",
+			Reason: "self_approval",
+		}
+	}
+
+	if s.isApprover(identity) {
+		return nil
+	}
+
+	return notAnApprover(identity, "approve requests")
+}
+
+// canAccess returns an error if the given identity isn't allowed to see or reject the given request, or list all of the requests
+// if it's nil. Approvers can do both, and requesters can see and reject their own requests.
+func (s *approvalStore) canAccess(approval *PendingApproval, identity string) *deciders.HTTPError {
+	if identity == "" {
+		return missingIdentity("the approvals API requires an identity")
+	}
+
+	if s.isApprover(identity) || (approval != nil && identity == approval.Requester) {
+		return nil
+	}
+
+	if approval == nil {
+		return notAnApprover(identity, "list requests")
+	}
+
+	return notAnApprover(identity, "see or reject other peoples requests")
+}
+
+// isApprover returns whether the given identity is one of the Approvers, or whether anyone is if they aren't set.
+func (s *approvalStore) isApprover(identity string) bool {
+	if len(s.config.Approvers) == 0 {
+		return true
+	}
+
+	for _, approver := range s.config.Approvers {
+		if approver == identity {
+			return true
+		}
+	}
+
+	return false
+}
+
+func missingIdentity(err string) *deciders.HTTPError {
+	return &deciders.HTTPError{
+		Status: http.StatusUnauthorized,
+		Err:    err,
+		Reason: "missing_identity",
+	}
+}
+
+func notAnApprover(identity, action string) *deciders.HTTPError {
+	return &deciders.HTTPError{
+		Status: http.StatusForbidden,
+		Err:    fmt.Sprintf("%s isn't allowed to %s", identity, action),
+		Reason: "not_an_approver",
+	}
+}
+
+// pendingResponse is the response to a request that is being held for approval because of the given rejection.
+func pendingResponse(req *http.Request, approval *PendingApproval, rejection *deciders.HTTPError) *http.Response {
+	pending := *rejection
+	pending.Status = http.StatusAccepted
+	pending.Reason = ReasonPendingApproval
+	pending.Headers = http.Header{HeaderApprovalID: []string{approval.ID}}
+
+	body, _ := json.Marshal(pendingApprovalBody{
+		Status:     ReasonPendingApproval,
+		ApprovalID: approval.ID,
+		ExpiresAt:  approval.ExpiresAt,
+		Reasons:    approval.Reasons,
+	})
+
+	response := pending.NewResponse("application/json", body)
+	response.Request = req
+	return response
+}
+
+type approvedContextKey struct{}
+
+// approvedBy returns who approved the given request, if it's being sent to the backend after being approved.
+func approvedBy(req *http.Request) (string, bool) {
+	approver, ok := req.Context().Value(approvedContextKey{}).(string)
+	return approver, ok
+}
+
+// approvalHandler serves the approvals API for the proxy that it wraps.
+type approvalHandler struct {
+	proxy *httputil.ReverseProxy
+}
+
+// NewApprovalHandler returns a handler for the approvals API of the given proxy, which should be served at ApprovalsPath:
+//
+//	GET  /                 lists the requests waiting for approval
+//	GET  /{id}             shows a request waiting for approval
+//	POST /{id}/approve     sends the request to the backend, and returns its response
+//	POST /{id}/reject      forgets the request
+//
+// Only approvers can list the requests, and only approvers or the person that made a request can see or reject it.
+func NewApprovalHandler(proxy *httputil.ReverseProxy) http.Handler {
+	return http.StripPrefix(ApprovalsPath, approvalHandler{proxy: proxy})
+}
+
+func (a approvalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	transport, ok := a.proxy.Transport.(bouncingTransport)
+	if !ok || transport.active.Load().approvals == nil {
+		writeAPIError(w, &deciders.HTTPError{Status: http.StatusNotFound, Err: "approvals aren't configured"})
+		return
+	}
+
+	store := transport.active.Load().approvals
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "" && r.Method == http.MethodGet:
+		if err := store.canAccess(nil, deciders.Identity(r, store.config.IdentityHeader)); err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		approvals, err := store.list()
+		if err != nil {
+			writeAPIError(w, &deciders.HTTPError{Status: http.StatusInternalServerError, Err: err.Error()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, approvals)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		approval, ok := a.access(w, r, store, parts[0])
+		if !ok {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, approval)
+	case len(parts) == 2 && parts[1] == "approve" && r.Method == http.MethodPost:
+		a.approve(w, r, store, parts[0])
+	case len(parts) == 2 && parts[1] == "reject" && r.Method == http.MethodPost:
+		a.reject(w, r, store, parts[0])
+	default:
+		writeAPIError(w, &deciders.HTTPError{Status: http.StatusNotFound, Err: fmt.Sprintf("no such endpoint: %s %s", r.Method, r.URL.Path)})
+	}
+}
+
+// access returns the request with the given ID, if the person asking can see it. Otherwise, it writes an error and returns false.
+func (a approvalHandler) access(w http.ResponseWriter, r *http.Request, store *approvalStore, id string) (PendingApproval, bool) {
+	identity := deciders.Identity(r, store.config.IdentityHeader)
+	if identity == "" {
+		writeAPIError(w, store.canAccess(nil, identity))
+		return PendingApproval{}, false
+	}
+
+	approval, ok, err := store.get(id)
+	if err != nil {
+		writeAPIError(w, &deciders.HTTPError{Status: http.StatusInternalServerError, Err: err.Error()})
+		return PendingApproval{}, false
+	} else if !ok {
+		writeAPIError(w, notFound(id))
+		return PendingApproval{}, false
+	}
+
+	if err := store.canAccess(&approval, identity); err != nil {
+		writeAPIError(w, err)
+		return PendingApproval{}, false
+	}
+
+	return approval, true
+}
+
+// reject forgets the request with the given ID, if the person asking can reject it.
+func (a approvalHandler) reject(w http.ResponseWriter, r *http.Request, store *approvalStore, id string) {
+	if _, ok := a.access(w, r, store, id); !ok {
+		return
+	}
+
+	approval, ok, err := store.remove(id)
+	if err != nil {
+		writeAPIError(w, &deciders.HTTPError{Status: http.StatusInternalServerError, Err: err.Error()})
+		return
+	} else if !ok {
+		// Someone else got to it first.
+		writeAPIError(w, notFound(id))
+		return
+	}
+
+	approvalsTotal.WithLabelValues("rejected").Inc()
+	auditLog.Info().Str("approval", approval.ID).Str("requester", approval.Requester).Str("by", deciders.Identity(r, store.config.IdentityHeader)).Msg("Request rejected")
+	writeJSON(w, http.StatusOK, approval)
+}
+
+// approve sends the request with the given ID to the backend through the proxy, skipping the bouncers, if the person asking can approve it.
+func (a approvalHandler) approve(w http.ResponseWriter, r *http.Request, store *approvalStore, id string) {
+	approval, ok, err := store.get(id)
+	if err != nil {
+		writeAPIError(w, &deciders.HTTPError{Status: http.StatusInternalServerError, Err: err.Error()})
+		return
+	} else if !ok {
+		writeAPIError(w, notFound(id))
+		return
+	}
+
+	approver := deciders.Identity(r, store.config.IdentityHeader)
+	if err := store.canApprove(approval, approver); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	approval, ok, err = store.remove(id)
+	if err != nil {
+		writeAPIError(w, &deciders.HTTPError{Status: http.StatusInternalServerError, Err: err.Error()})
+		return
+	} else if !ok {
+		// Someone else got to it first.
+		writeAPIError(w, notFound(id))
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), approvedContextKey{}, approver)
+	req, err := http.NewRequestWithContext(ctx, approval.Method, approval.URI, strings.NewReader(approval.Body))
+	if err != nil {
+		writeAPIError(w, &deciders.HTTPError{Status: http.StatusInternalServerError, Err: err.Error()})
+		return
+	}
+
+	req.Header = approval.Header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+
+	req.Header.Set(HeaderApprovedBy, approver)
+	req.RemoteAddr = r.RemoteAddr
+
+	approvalsTotal.WithLabelValues("approved").Inc()
+	auditLog.Info().Str("approval", approval.ID).Str("requester", approval.Requester).Str("by", approver).Str("method", approval.Method).Str("uri", approval.URI).Msg("Request approved")
+	a.proxy.ServeHTTP(w, req)
+}
+
+// hopByHopHeaders are the headers that only apply to a single connection, which shouldn't be kept with a held request.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// heldHeader returns a copy of the given headers, without the hop-by-hop ones, to keep with a held request.
+func heldHeader(header http.Header) http.Header {
+	held := header.Clone()
+	for _, connectionHeader := range held.Values("Connection") {
+		for _, name := range strings.Split(connectionHeader, ",") {
+			held.Del(strings.TrimSpace(name))
+		}
+	}
+
+	for _, name := range hopByHopHeaders {
+		held.Del(name)
+	}
+
+	return held
+}
+
+func notFound(id string) *deciders.HTTPError {
+	return &deciders.HTTPError{
+		Status: http.StatusNotFound,
+		Err:    fmt.Sprintf("no request waiting for approval with ID %s", id),
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, err *deciders.HTTPError) {
+	writeJSON(w, err.Status, ErrorBody{Error: err.Err, Reason: err.ReasonCode()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Warn().Err(err).Msg("Failed to write approvals API response")
+	}
+}
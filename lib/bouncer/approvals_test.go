@@ -0,0 +1,291 @@
+package bouncer_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer"
+)
+
+func parseApprovalsConfig(t *testing.T, registry *bouncer.Registry, approvals string) bouncer.Config {
+	t.Helper()
+	config, err := bouncer.ParseConfigWithRegistry([]byte(`
+approvals:`+approvals+`
+bouncers:
+  - method: POST
+    uriRegex: .*
+    deciders:
+      - name: Forbidden
+        mode: approval
+`), registry)
+	require.NoError(t, err)
+	return config
+}
+
+func newApprovalsFrontend(t *testing.T, backendURL *url.URL, registry *bouncer.Registry, approvals string) (*httptest.Server, *httputil.ReverseProxy) {
+	t.Helper()
+	config := parseApprovalsConfig(t, registry, approvals)
+	proxy := bouncer.NewBouncingReverseProxyWithConfig(backendURL, config, http.DefaultTransport)
+	mux := http.NewServeMux()
+	mux.Handle(bouncer.ApprovalsPath+"/", bouncer.NewApprovalHandler(proxy))
+	mux.Handle("/", proxy)
+
+	frontend := httptest.NewServer(mux)
+	t.Cleanup(frontend.Close)
+	return frontend, proxy
+}
+
+func doAs(t *testing.T, client *http.Client, method, url, user, body string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if user != "" {
+		req.Header.Set("X-Forwarded-User", user)
+	}
+
+	response, err := client.Do(req)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	responseBody, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	return response, string(responseBody)
+}
+
+func TestApprovals(t *testing.T) {
+	var received []string
+	var approvedBy []string
+	var headers []http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+		approvedBy = append(approvedBy, r.Header.Get(bouncer.HeaderApprovedBy))
+		headers = append(headers, r.Header)
+		w.Write([]byte(`{"silenceID":"abc"}`))
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	registry := bouncer.NewRegistry()
+	require.NoError(t, registry.Register("Forbidden", rejectWith(http.StatusForbidden, "forbidden")))
+
+	approvals := `
+  storeFile: ` + filepath.Join(t.TempDir(), "approvals.json") + `
+  approvers: [alice, bob]`
+	frontend, _ := newApprovalsFrontend(t, backendURL, registry, approvals)
+	client := frontend.Client()
+
+	const silence = `{"createdBy":"colin","comment":"testing"}`
+	response, body := doAs(t, client, http.MethodPost, frontend.URL+"/api/v2/silences", "colin", silence)
+	require.Equal(t, http.StatusAccepted, response.StatusCode)
+	require.Equal(t, bouncer.ReasonPendingApproval, response.Header.Get("X-Bouncer-Reason"))
+	require.Empty(t, received, "Expected requests waiting for approval not to reach the backend")
+
+	var pending struct {
+		ApprovalID string   `json:"approvalID"`
+		Reasons    []string `json:"reasons"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &pending))
+	require.Equal(t, response.Header.Get(bouncer.HeaderApprovalID), pending.ApprovalID)
+	require.Equal(t, []string{"Forbidden: forbidden failed"}, pending.Reasons)
+
+	approveURL := frontend.URL + bouncer.ApprovalsPath + "/" + pending.ApprovalID + "/approve"
+	response, _ = doAs(t, client, http.MethodPost, approveURL, "", "")
+	require.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	response, _ = doAs(t, client, http.MethodPost, approveURL, "colin", "")
+	require.Equal(t, http.StatusForbidden, response.StatusCode, "Expected people not to be able to approve their own requests")
+
+	response, _ = doAs(t, client, http.MethodPost, approveURL, "mallory", "")
+	require.Equal(t, http.StatusForbidden, response.StatusCode, "Expected only approvers to be able to approve requests")
+
+	// Restarting the bouncer shouldn't lose the request.
+	frontend, _ = newApprovalsFrontend(t, backendURL, registry, approvals)
+	approveURL = frontend.URL + bouncer.ApprovalsPath + "/" + pending.ApprovalID + "/approve"
+
+	var listed []bouncer.PendingApproval
+	_, body = doAs(t, client, http.MethodGet, frontend.URL+bouncer.ApprovalsPath+"/", "alice", "")
+	require.NoError(t, json.Unmarshal([]byte(body), &listed))
+	require.Len(t, listed, 1)
+	require.Equal(t, "colin", listed[0].Requester)
+
+	response, body = doAs(t, client, http.MethodPost, approveURL, "alice", "")
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, `{"silenceID":"abc"}`, body)
+	require.Equal(t, []string{silence}, received)
+	require.Equal(t, []string{"alice"}, approvedBy)
+	require.Equal(t, "colin", headers[0].Get("X-Forwarded-User"), "Expected approved requests to keep the headers they were held with")
+	require.Equal(t, "application/json", headers[0].Get("Content-Type"))
+
+	response, _ = doAs(t, client, http.MethodPost, approveURL, "bob", "")
+	require.Equal(t, http.StatusNotFound, response.StatusCode, "Expected requests to only be approved once")
+}
+
+func TestApprovalsRejectAndExpire(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no requests to reach the backend")
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	registry := bouncer.NewRegistry()
+	require.NoError(t, registry.Register("Forbidden", rejectWith(http.StatusForbidden, "forbidden")))
+
+	frontend, proxy := newApprovalsFrontend(t, backendURL, registry, `
+  ttl: 1h`)
+	client := frontend.Client()
+
+	now := time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)
+	bouncer.SetApprovalsClock(proxy, func() time.Time { return now })
+
+	response, _ := doAs(t, client, http.MethodPost, frontend.URL+"/api/v2/silences", "colin", "{}")
+	require.Equal(t, http.StatusAccepted, response.StatusCode)
+	id := response.Header.Get(bouncer.HeaderApprovalID)
+
+	response, _ = doAs(t, client, http.MethodPost, frontend.URL+bouncer.ApprovalsPath+"/"+id+"/reject", "alice", "")
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	response, _ = doAs(t, client, http.MethodGet, frontend.URL+bouncer.ApprovalsPath+"/"+id, "alice", "")
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response, _ = doAs(t, client, http.MethodPost, frontend.URL+"/api/v2/silences", "colin", "{}")
+	require.Equal(t, http.StatusAccepted, response.StatusCode)
+	id = response.Header.Get(bouncer.HeaderApprovalID)
+
+	now = now.Add(2 * time.Hour)
+	response, _ = doAs(t, client, http.MethodPost, frontend.URL+bouncer.ApprovalsPath+"/"+id+"/approve", "alice", "")
+	require.Equal(t, http.StatusNotFound, response.StatusCode, "Expected requests to expire after the TTL")
+}
+
+func TestApprovalsStoreIsOnlyReadWhenItsUsed(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	registry := bouncer.NewRegistry()
+	require.NoError(t, registry.Register("Forbidden", rejectWith(http.StatusForbidden, "forbidden")))
+
+	storeFile := filepath.Join(t.TempDir(), "approvals.json")
+	approvals := `
+  storeFile: ` + storeFile
+	frontend, proxy := newApprovalsFrontend(t, backendURL, registry, approvals)
+	client := frontend.Client()
+
+	response, _ := doAs(t, client, http.MethodPost, frontend.URL+"/api/v2/silences", "colin", "{}")
+	require.Equal(t, http.StatusAccepted, response.StatusCode)
+	id := response.Header.Get(bouncer.HeaderApprovalID)
+
+	// Reloading with the same approvals config keeps using the store that's already loaded, so it shouldn't read the file again.
+	require.NoError(t, os.WriteFile(storeFile, []byte("not json"), 0o600))
+	require.NoError(t, bouncer.SetConfig(parseApprovalsConfig(t, registry, approvals), proxy))
+
+	response, body := doAs(t, client, http.MethodPost, frontend.URL+bouncer.ApprovalsPath+"/"+id+"/approve", "alice", "")
+	require.Equal(t, http.StatusOK, response.StatusCode, body)
+}
+
+func TestApprovalsRequireIdentities(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no requests to reach the backend")
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	registry := bouncer.NewRegistry()
+	require.NoError(t, registry.Register("Forbidden", rejectWith(http.StatusForbidden, "forbidden")))
+
+	frontend, _ := newApprovalsFrontend(t, backendURL, registry, `
+  approvers: [alice]`)
+	client := frontend.Client()
+
+	response, body := doAs(t, client, http.MethodPost, frontend.URL+"/api/v2/silences", "", `{"createdBy":"colin"}`)
+	require.Equal(t, http.StatusUnauthorized, response.StatusCode, "Expected requests without an identity not to be held, got %s", body)
+	require.Equal(t, "missing_identity", response.Header.Get("X-Bouncer-Reason"))
+
+	response, _ = doAs(t, client, http.MethodPost, frontend.URL+"/api/v2/silences", "colin", `{"createdBy":"colin"}`)
+	require.Equal(t, http.StatusAccepted, response.StatusCode)
+	requestURL := frontend.URL + bouncer.ApprovalsPath + "/" + response.Header.Get(bouncer.HeaderApprovalID)
+
+	testCases := []struct {
+		name           string
+		method         string
+		url            string
+		user           string
+		expectedStatus int
+	}{
+		{
+			name:           "Test listing requires an identity",
+			method:         http.MethodGet,
+			url:            frontend.URL + bouncer.ApprovalsPath + "/",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Test listing requires an approver",
+			method:         http.MethodGet,
+			url:            frontend.URL + bouncer.ApprovalsPath + "/",
+			user:           "colin",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Test showing a request requires an identity",
+			method:         http.MethodGet,
+			url:            requestURL,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Test showing a request requires an approver or the requester",
+			method:         http.MethodGet,
+			url:            requestURL,
+			user:           "mallory",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Test requesters can see their own requests",
+			method:         http.MethodGet,
+			url:            requestURL,
+			user:           "colin",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Test rejecting requires an identity",
+			method:         http.MethodPost,
+			url:            requestURL + "/reject",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Test rejecting requires an approver or the requester",
+			method:         http.MethodPost,
+			url:            requestURL + "/reject",
+			user:           "mallory",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Test requesters can reject their own requests",
+			method:         http.MethodPost,
+			url:            requestURL + "/reject",
+			user:           "colin",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			response, body := doAs(t, client, tt.method, tt.url, tt.user, "")
+			require.Equal(t, tt.expectedStatus, response.StatusCode, body)
+		})
+	}
+}
@@ -0,0 +1,193 @@
+// Package backend is a client for the Alertmanager that the bouncer proxies to, for deciders that need to know
+// about more than the request that they're deciding on, e.g. the silence that a request is expiring.
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// ErrNotFound is returned when the backend doesn't have the requested silence.
+var ErrNotFound = errors.New("silence not found")
+
+// Client fetches silences from the backend Alertmanager.
+type Client interface {
+	// GetSilence returns the silence with the given ID, or ErrNotFound if there isn't one.
+	GetSilence(ctx context.Context, id string) (types.Silence, error)
+
+	// ListSilences returns every silence that the backend knows about, including expired ones.
+	ListSilences(ctx context.Context) ([]types.Silence, error)
+
+	// ListAlerts returns every alert that the backend knows about, including silenced and inhibited ones.
+	ListAlerts(ctx context.Context) ([]model.Alert, error)
+}
+
+// HTTPClient is a Client that talks to the Alertmanagers v2 API.
+type HTTPClient struct {
+	base   *url.URL
+	client *http.Client
+}
+
+// New returns an HTTPClient for the Alertmanager at the given URL, which sends its requests through the given transport.
+// The transport should be the one that the bouncer proxies requests through, so that requests from the client aren't bounced.
+func New(base *url.URL, transport http.RoundTripper) *HTTPClient {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &HTTPClient{
+		base: base,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   defaultTimeout,
+		},
+	}
+}
+
+// GetSilence implements Client.
+func (c *HTTPClient) GetSilence(ctx context.Context, id string) (types.Silence, error) {
+	var silence types.Silence
+	err := c.get(ctx, "/api/v2/silence/"+url.PathEscape(id), &silence)
+	return silence, err
+}
+
+// ListSilences implements Client.
+func (c *HTTPClient) ListSilences(ctx context.Context) ([]types.Silence, error) {
+	var silences []types.Silence
+	err := c.get(ctx, "/api/v2/silences", &silences)
+	return silences, err
+}
+
+// ListAlerts implements Client.
+func (c *HTTPClient) ListAlerts(ctx context.Context) ([]model.Alert, error) {
+	var alerts []model.Alert
+	err := c.get(ctx, "/api/v2/alerts", &alerts)
+	return alerts, err
+}
+
+func (c *HTTPClient) get(ctx context.Context, apiPath string, result interface{}) error {
+	u := *c.base
+	u.Path = path.Join("/", u.Path, apiPath)
+	u.RawPath = ""
+	u.RawQuery = ""
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("got status %d from backend: %s", resp.StatusCode, body)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response from backend: %w", err)
+	}
+
+	return nil
+}
+
+// memoized is a Client that remembers the results of the Client that it wraps.
+type memoized struct {
+	client Client
+
+	lock     sync.Mutex
+	silences map[string]memoizedSilence
+	list     []types.Silence
+	listErr  error
+	listed   bool
+
+	alerts    []model.Alert
+	alertsErr error
+	alerted   bool
+}
+
+type memoizedSilence struct {
+	silence types.Silence
+	err     error
+}
+
+// Memoize returns a Client that only asks the given Client for each silence, the list of silences, or the list of alerts once.
+// It is meant to live for a single request, so that multiple deciders can look at the same silence without fetching it multiple times.
+func Memoize(client Client) Client {
+	return &memoized{
+		client:   client,
+		silences: make(map[string]memoizedSilence),
+	}
+}
+
+func (m *memoized) GetSilence(ctx context.Context, id string) (types.Silence, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if result, ok := m.silences[id]; ok {
+		return result.silence, result.err
+	}
+
+	silence, err := m.client.GetSilence(ctx, id)
+	m.silences[id] = memoizedSilence{silence: silence, err: err}
+	return silence, err
+}
+
+func (m *memoized) ListSilences(ctx context.Context) ([]types.Silence, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.listed {
+		m.list, m.listErr = m.client.ListSilences(ctx)
+		m.listed = true
+	}
+
+	return m.list, m.listErr
+}
+
+func (m *memoized) ListAlerts(ctx context.Context) ([]model.Alert, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.alerted {
+		m.alerts, m.alertsErr = m.client.ListAlerts(ctx)
+		m.alerted = true
+	}
+
+	return m.alerts, m.alertsErr
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of the given context that carries the given Client.
+func NewContext(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, contextKey{}, client)
+}
+
+// FromContext returns the Client carried by the given context, if there is one.
+func FromContext(ctx context.Context) (Client, bool) {
+	client, ok := ctx.Value(contextKey{}).(Client)
+	return client, ok
+}
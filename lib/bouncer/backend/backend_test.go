@@ -0,0 +1,101 @@
+package backend_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPClient(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/alertmanager/api/v2/silence/abc":
+			w.Write([]byte(`{"id": "abc", "createdBy": "colin", "matchers": [{"name": "alertname", "value": "Foo", "isRegex": false, "isEqual": true}], "status": {"state": "active"}}`))
+		case "/alertmanager/api/v2/silences":
+			w.Write([]byte(`[{"id": "abc"}, {"id": "def"}]`))
+		case "/alertmanager/api/v2/alerts":
+			w.Write([]byte(`[{"labels": {"alertname": "Foo"}, "status": {"state": "active"}, "fingerprint": "abc"}]`))
+		case "/alertmanager/api/v2/silence/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL + "/alertmanager")
+	require.NoError(t, err)
+	client := backend.New(base, nil)
+
+	silence, err := client.GetSilence(context.Background(), "abc")
+	require.NoError(t, err)
+	require.Equal(t, "colin", silence.CreatedBy)
+	require.Equal(t, `alertname="Foo"`, silence.Matchers[0].String())
+	require.Equal(t, "active", string(silence.Status.State))
+
+	_, err = client.GetSilence(context.Background(), "missing")
+	require.ErrorIs(t, err, backend.ErrNotFound)
+
+	_, err = client.GetSilence(context.Background(), "broken")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, backend.ErrNotFound)
+
+	silences, err := client.ListSilences(context.Background())
+	require.NoError(t, err)
+	require.Len(t, silences, 2)
+
+	alerts, err := client.ListAlerts(context.Background())
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	require.Equal(t, "Foo", string(alerts[0].Labels["alertname"]))
+
+	calls = 0
+	memoized := backend.Memoize(client)
+	for i := 0; i < 3; i++ {
+		_, err := memoized.GetSilence(context.Background(), "abc")
+		require.NoError(t, err)
+		_, err = memoized.ListSilences(context.Background())
+		require.NoError(t, err)
+		_, err = memoized.ListAlerts(context.Background())
+		require.NoError(t, err)
+	}
+	require.Equal(t, 3, calls, "Expected the memoized client to only fetch each thing once")
+}
+
+func TestSilenceCache(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`[{"id": "abc"}]`))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	client := backend.New(base, nil)
+
+	cache := backend.NewSilenceCache(time.Hour)
+	for i := 0; i < 3; i++ {
+		silences, err := cache.List(context.Background(), client)
+		require.NoError(t, err)
+		require.Len(t, silences, 1)
+	}
+	require.Equal(t, 1, calls, "Expected the cache to only fetch silences once within the TTL")
+
+	calls = 0
+	cache = backend.NewSilenceCache(time.Nanosecond)
+	for i := 0; i < 3; i++ {
+		_, err := cache.List(context.Background(), client)
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond)
+	}
+	require.Equal(t, 3, calls, "Expected the cache to refetch silences once the TTL has passed")
+}
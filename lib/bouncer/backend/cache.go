@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+)
+
+// SilenceCache remembers the list of silences from a backend for TTL, so that deciders that look at every silence don't
+// fetch them all on every request.
+type SilenceCache struct {
+	TTL time.Duration
+
+	lock     sync.Mutex
+	silences []types.Silence
+	expires  time.Time
+}
+
+// NewSilenceCache returns a SilenceCache that remembers silences for the given TTL.
+func NewSilenceCache(ttl time.Duration) *SilenceCache {
+	return &SilenceCache{TTL: ttl}
+}
+
+// List returns the cached silences, fetching them with the given Client if they're older than the TTL.
+func (s *SilenceCache) List(ctx context.Context, client Client) ([]types.Silence, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	if s.silences != nil && now.Before(s.expires) {
+		return s.silences, nil
+	}
+
+	silences, err := client.ListSilences(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if silences == nil {
+		silences = []types.Silence{}
+	}
+
+	s.silences = silences
+	s.expires = now.Add(s.TTL)
+	return silences, nil
+}
@@ -7,102 +7,308 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"strings"
+	"reflect"
+	"strconv"
+	"sync"
 
-	"github.com/grafana/regexp"
 	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/backend"
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"go.uber.org/atomic"
 
 	"gopkg.in/yaml.v3"
 )
 
 type deciderSerialized struct {
-	Name   string                 `yaml:"name"`
-	Config map[string]interface{} `yaml:"config"`
+	Name           string                 `yaml:"name"`
+	Config         map[string]interface{} `yaml:"config"`
+	Mode           string                 `yaml:"mode"`
+	EnforcePercent *float64               `yaml:"enforcePercent"`
 }
 
 type bouncerSerialized struct {
-	Method   string              `yaml:"method"`
-	URIRegex string              `yaml:"uriRegex"`
-	Deciders []deciderSerialized `yaml:"deciders"`
-	DryRun   bool                `yaml:"dryrun"`
+	Name       string              `yaml:"name"`
+	Target     TargetConfig        `yaml:",inline"`
+	Mutators   []deciderSerialized `yaml:"mutators"`
+	Deciders   []deciderSerialized `yaml:"deciders"`
+	Hooks      hooksSerialized     `yaml:"hooks"`
+	DryRun     bool                `yaml:"dryrun"`
+	Evaluation string              `yaml:"evaluation"`
 }
 
-// ParseBouncers loads a slice of Bouncers from a given byte array
-// which should represent a YAML encoded text stream of serialized bouncers.
-func ParseBouncers(b []byte) ([]Bouncer, error) {
-	var serializedBouncers struct {
-		Bouncers []bouncerSerialized `yaml:"bouncers"`
+type configSerialized struct {
+	Bouncers       []bouncerSerialized `yaml:"bouncers"`
+	ErrorResponses ErrorResponses      `yaml:"errorResponses"`
+	Evaluation     string              `yaml:"evaluation"`
+	Approvals      *Approvals          `yaml:"approvals"`
+}
+
+// Config is everything that can be configured in a bouncers config file: the Bouncers themselves, and the options that apply to all of them.
+type Config struct {
+	Bouncers       []Bouncer
+	ErrorResponses ErrorResponses
+
+	// Evaluation is EvaluationAll if every bouncer should run on every request, aggregating their rejections,
+	// and is the default for bouncers that don't set their own Evaluation.
+	Evaluation string
+
+	// Approvals configures where requests from deciders in approval mode are held. It must be set if any deciders are in approval mode.
+	Approvals *Approvals
+
+	// approvals is the store for Approvals, which is only replaced on reload if Approvals changes.
+	approvals *approvalStore
+}
+
+// Close releases any resources held by the Bouncers in the Config.
+func (c Config) Close() {
+	for i := range c.Bouncers {
+		c.Bouncers[i].Close()
 	}
+}
+
+// ParseConfig loads a Config from a given byte array, which should represent a YAML encoded config file.
+func ParseConfig(b []byte) (Config, error) {
+	return ParseConfigWithRegistry(b, DefaultRegistry)
+}
+
+// ParseConfigWithRegistry is ParseConfig, but looks up deciders in the given Registry rather than the DefaultRegistry.
+func ParseConfigWithRegistry(b []byte, registry *Registry) (Config, error) {
+	var serializedConfig configSerialized
 
 	decoder := yaml.NewDecoder(bytes.NewReader(b))
 	decoder.KnownFields(true)
 
-	if err := decoder.Decode(&serializedBouncers); err != nil {
+	if err := decoder.Decode(&serializedConfig); err != nil {
+		return Config{}, err
+	}
+
+	if err := serializedConfig.ErrorResponses.setDefaults(); err != nil {
+		return Config{}, err
+	}
+
+	if err := validateEvaluation(serializedConfig.Evaluation); err != nil {
+		return Config{}, err
+	}
+
+	var approvals *approvalStore
+	if serializedConfig.Approvals != nil {
+		var err error
+		if approvals, err = newApprovalStore(*serializedConfig.Approvals); err != nil {
+			return Config{}, err
+		}
+	}
+
+	bouncers, err := parseBouncers(serializedConfig.Bouncers, registry)
+	if err != nil {
+		return Config{}, err
+	}
+
+	config := Config{
+		Bouncers:       bouncers,
+		ErrorResponses: serializedConfig.ErrorResponses,
+		Evaluation:     serializedConfig.Evaluation,
+		Approvals:      serializedConfig.Approvals,
+		approvals:      approvals,
+	}
+
+	if approvals == nil {
+		for _, bouncer := range bouncers {
+			for i := range bouncer.Deciders {
+				if bouncer.options(i).mode == ModeApproval {
+					config.Close()
+					return Config{}, fmt.Errorf("decider %q in bouncer %q is in %q mode, but approvals aren't configured", bouncer.options(i).name, bouncer.Name, ModeApproval)
+				}
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// ParseBouncers loads a slice of Bouncers from a given byte array
+// which should represent a YAML encoded text stream of serialized bouncers.
+func ParseBouncers(b []byte) ([]Bouncer, error) {
+	return ParseBouncersWithRegistry(b, DefaultRegistry)
+}
+
+// ParseBouncersWithRegistry is ParseBouncers, but looks up deciders in the given Registry rather than the DefaultRegistry.
+func ParseBouncersWithRegistry(b []byte, registry *Registry) ([]Bouncer, error) {
+	config, err := ParseConfigWithRegistry(b, registry)
+	if err != nil {
 		return nil, err
 	}
 
-	bouncers := make([]Bouncer, 0, len(serializedBouncers.Bouncers))
-	for _, serializedBouncer := range serializedBouncers.Bouncers {
-		uriRegex, err := regexp.Compile(serializedBouncer.URIRegex)
+	return config.Bouncers, nil
+}
+
+func parseBouncers(serializedBouncers []bouncerSerialized, registry *Registry) ([]Bouncer, error) {
+	bouncers := make([]Bouncer, 0, len(serializedBouncers))
+	for i, serializedBouncer := range serializedBouncers {
+		if serializedBouncer.Name == "" {
+			serializedBouncer.Name = fmt.Sprintf("bouncer-%d", i)
+		}
+
+		bouncer, err := parseBouncer(serializedBouncer, registry)
 		if err != nil {
+			for i := range bouncers {
+				bouncers[i].Close()
+			}
+
 			return nil, err
 		}
 
-		target := Target{
-			Method:   serializedBouncer.Method,
-			URIRegex: uriRegex,
+		bouncers = append(bouncers, bouncer)
+	}
+
+	if err := checkOwnedResources(bouncers); err != nil {
+		for i := range bouncers {
+			bouncers[i].Close()
 		}
 
-		deciders := make([]deciders.Decider, 0, len(serializedBouncer.Deciders))
-		for _, serializedDecider := range serializedBouncer.Deciders {
-			if _, exists := deciderTemplates[serializedDecider.Name]; !exists {
-				return nil, fmt.Errorf("no decider template named %q found", serializedDecider.Name)
+		return nil, err
+	}
+
+	return bouncers, nil
+}
+
+// checkOwnedResources returns an error if two of the deciders in the given bouncers own the same thing.
+func checkOwnedResources(bouncers []Bouncer) error {
+	owners := make(map[string]string)
+	for _, bouncer := range bouncers {
+		for i, decider := range bouncer.Deciders {
+			owner, ok := decider.(deciders.ResourceOwner)
+			if !ok {
+				continue
 			}
 
-			decider, err := deciderTemplates[serializedDecider.Name].Make(serializedDecider.Config)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create decider %q: %s", serializedDecider.Name, err)
+			name := fmt.Sprintf("decider %q in bouncer %q", bouncer.options(i).name, bouncer.Name)
+			for _, resource := range owner.OwnedResources() {
+				if other, ok := owners[resource]; ok {
+					return fmt.Errorf("%s and %s both use %s", other, name, resource)
+				}
+
+				owners[resource] = name
 			}
+		}
+	}
+
+	return nil
+}
+
+func parseBouncer(serializedBouncer bouncerSerialized, registry *Registry) (Bouncer, error) {
+	if err := validateEvaluation(serializedBouncer.Evaluation); err != nil {
+		return Bouncer{}, fmt.Errorf("bouncer %q: %w", serializedBouncer.Name, err)
+	}
+
+	target, err := ParseTarget(serializedBouncer.Target)
+	if err != nil {
+		return Bouncer{}, fmt.Errorf("bouncer %q: %w", serializedBouncer.Name, err)
+	}
+
+	mutators, mutatorNames, err := makeMutators(serializedBouncer.Mutators, registry)
+	if err != nil {
+		return Bouncer{}, fmt.Errorf("bouncer %q: %w", serializedBouncer.Name, err)
+	}
 
-			deciders = append(deciders, decider)
+	deciders := make([]deciders.Decider, 0, len(serializedBouncer.Deciders))
+	options := make([]deciderOptions, 0, len(serializedBouncer.Deciders))
+	for _, serializedDecider := range serializedBouncer.Deciders {
+		opts := deciderOptions{
+			name:           serializedDecider.Name,
+			mode:           serializedDecider.Mode,
+			enforcePercent: serializedDecider.EnforcePercent,
 		}
 
-		bouncers = append(bouncers, Bouncer{
-			Target:   target,
-			Deciders: deciders,
-			DryRun:   serializedBouncer.DryRun,
-		})
+		if err := opts.validate(); err != nil {
+			closeAll(mutators)
+			closeAll(deciders)
+			return Bouncer{}, fmt.Errorf("invalid options for decider %q: %w", serializedDecider.Name, err)
+		}
+
+		template, exists := registry.Get(serializedDecider.Name)
+		if !exists {
+			closeAll(mutators)
+			closeAll(deciders)
+			return Bouncer{}, fmt.Errorf("no decider template named %q found", serializedDecider.Name)
+		}
+
+		decider, err := template.Make(serializedDecider.Config)
+		if err != nil {
+			closeAll(mutators)
+			closeAll(deciders)
+			return Bouncer{}, fmt.Errorf("failed to create decider %q: %s", serializedDecider.Name, err)
+		}
+
+		deciders = append(deciders, decider)
+		options = append(options, opts)
 	}
 
-	return bouncers, nil
-}
+	hooks, err := parseHooks(serializedBouncer.Hooks, registry)
+	if err != nil {
+		closeAll(mutators)
+		closeAll(deciders)
+		return Bouncer{}, err
+	}
 
-// Target Represents a potential target for an HTTP request with both a Method (Which represents the HTTP method), and a URI Regex
-// which matches the URI of the request.
-type Target struct {
-	Method   string
-	URIRegex *regexp.Regexp
-}
+	return Bouncer{
+		Name:     serializedBouncer.Name,
+		Target:   target,
+		Mutators: mutators,
+		Deciders: deciders,
+		Hooks:    hooks,
+		DryRun:   serializedBouncer.DryRun,
 
-// Matches returns whether the given the given Target matches the given request, i.e. the method matches, and the URI matches the regex.
-func (t Target) Matches(req *http.Request) bool {
-	methodMatches := strings.EqualFold(req.Method, t.Method)
-	uriMatches := t.URIRegex.MatchString(req.URL.RequestURI())
-	return methodMatches && uriMatches
+		Evaluation:     serializedBouncer.Evaluation,
+		mutatorNames:   mutatorNames,
+		deciderOptions: options,
+	}, nil
 }
 
 // Bouncer is a coupling of a Target, and a number of deciders. It can optionally "Bounce" a request, i.e. reject it based on a series of Deciders.
+// Before any bouncer runs its deciders, the Mutators of every Bouncer that matches a request can rewrite it. Once the outcome of a request
+// is known, the Bouncers Hooks are run.
 type Bouncer struct {
+	Name     string
 	Target   Target
+	Mutators []deciders.Mutator
 	Deciders []deciders.Decider
+	Hooks    Hooks
 	DryRun   bool
+
+	// Evaluation is EvaluationAll if the Bouncer should run every decider, rejecting requests with all their violations.
+	// If it's empty, the Evaluation of the Config is used.
+	Evaluation string
+
+	// mutatorNames are the names that the Mutators were configured with.
+	mutatorNames []string
+
+	// deciderOptions are the names and modes that the Deciders were configured with.
+	deciderOptions []deciderOptions
 }
 
 // Bounce takes an HTTPRequest and optionally returns an HTTPError if the request should be "Bounced", i.e. rejected.
 func (b *Bouncer) Bounce(req *http.Request) *deciders.HTTPError {
+	return b.bounce(req, b.Evaluation == EvaluationAll).rejection
+}
+
+// outcome is the result of running a Bouncer on a request.
+type outcome struct {
+	// rejection is the error that the request should be rejected with, if any.
+	rejection *deciders.HTTPError
+
+	// dryRun are the errors from deciders in dry run mode, which would have rejected the request otherwise,
+	// warnings are the errors from deciders in warn mode, which should be passed back to the client as warnings, and
+	// approvals are the errors from deciders in approval mode, which mean that the request has to be approved.
+	dryRun    []*deciders.HTTPError
+	warnings  []*deciders.HTTPError
+	approvals []*deciders.HTTPError
+}
+
+// bounce is Bounce, but also returns the errors from deciders that didn't reject the request because of their mode.
+// If evaluateAll is set, every decider is run, and the rejection aggregates all of their violations.
+func (b *Bouncer) bounce(req *http.Request, evaluateAll bool) outcome {
 	if !b.Target.Matches(req) {
-		return nil
+		return outcome{}
 	}
 
 	// We want multiple deciders to be able to read the body, so we have to read it here, and then reload it into a buffer for every decider.
@@ -114,72 +320,498 @@ func (b *Bouncer) Bounce(req *http.Request) *deciders.HTTPError {
 		defer req.Body.Close()
 		rawBody, err = io.ReadAll(req.Body)
 		if err != nil {
-			return &deciders.HTTPError{
-				Status: http.StatusBadRequest,
-				Err:    "failed to read body from request",
+			return outcome{
+				rejection: &deciders.HTTPError{
+					Status:  http.StatusBadRequest,
+					Err:     "failed to read body from request",
+					Reason:  deciders.ReasonInvalidRequest,
+					Bouncer: b.Name,
+				},
 			}
 		}
 	}
 
-	for _, decider := range b.Deciders {
+	// Put the body back for whatever reads it next, e.g. the next bouncer or the backend, however we return.
+	defer func() {
+		req.Body = io.NopCloser(bytes.NewBuffer(rawBody))
+	}()
+
+	var result outcome
+	var violations []*deciders.HTTPError
+	for i, decider := range b.Deciders {
 		req.Body = io.NopCloser(bytes.NewBuffer(rawBody))
 		defer req.Body.Close()
 		err := decider.Decide(req)
-		if err != nil {
-			if b.DryRun {
-				log.Info().Msgf("Would have rejected %s %s: %s", req.Method, req.URL.RequestURI(), err.Err)
-			} else {
-				log.Debug().Msgf("Rejected %s %s: %s", req.Method, req.URL.RequestURI(), err.Err)
-				return err
+		if err == nil {
+			continue
+		}
+
+		err = b.attribute(err, i)
+		switch mode := b.mode(i, req, rawBody); mode {
+		case ModeDryRun:
+			log.Info().Msgf("Would have rejected %s %s: %s", req.Method, req.URL.RequestURI(), err.Err)
+			audit(req, mode, err)
+			result.dryRun = append(result.dryRun, err)
+		case ModeWarn:
+			log.Info().Msgf("Warning on %s %s: %s", req.Method, req.URL.RequestURI(), err.Err)
+			audit(req, mode, err)
+			result.warnings = append(result.warnings, err)
+		case ModeApproval:
+			log.Info().Msgf("Holding %s %s for approval: %s", req.Method, req.URL.RequestURI(), err.Err)
+			result.approvals = append(result.approvals, err)
+		default:
+			log.Debug().Msgf("Rejected %s %s: %s", req.Method, req.URL.RequestURI(), err.Err)
+			if !evaluateAll {
+				result.rejection = err
+				return result
 			}
+
+			violations = append(violations, err)
 		}
 	}
 
-	req.Body = io.NopCloser(bytes.NewBuffer(rawBody))
-	return nil
+	if len(violations) > 0 {
+		result.rejection = aggregate(violations)
+	}
+
+	return result
+}
+
+// evaluateAll returns whether the Bouncer should run all its deciders, given the Evaluation of the Config that it's in.
+func (b *Bouncer) evaluateAll(evaluation string) bool {
+	if b.Evaluation != "" {
+		return b.Evaluation == EvaluationAll
+	}
+
+	return evaluation == EvaluationAll
+}
+
+// attribute returns a copy of the given error from the decider at the given index, filled in with who rejected the request.
+func (b *Bouncer) attribute(err *deciders.HTTPError, decider int) *deciders.HTTPError {
+	attributed := *err
+	attributed.Bouncer = b.Name
+	attributed.Decider = b.options(decider).name
+	if len(err.Violations) > 0 {
+		// Deciders can report more than one violation, which get flattened into the aggregate when evaluating all the deciders.
+		attributed.Violations = make([]*deciders.HTTPError, 0, len(err.Violations))
+		for _, violation := range err.Violations {
+			attributed.Violations = append(attributed.Violations, b.attribute(violation, decider))
+		}
+	}
+
+	return &attributed
+}
+
+// Close releases any resources held by the Bouncers mutators, deciders, and hooks, e.g. plugin processes.
+func (b *Bouncer) Close() {
+	closeAll(b.Mutators)
+	closeAll(b.Deciders)
+	b.Hooks.Close()
 }
 
+// bouncingTransport is the Transport of a BouncingReverseProxy. SetConfig swaps the config that it runs requests with while
+// requests are in flight, so the config is kept behind a pointer that every copy of the transport shares.
 type bouncingTransport struct {
 	backingTransport http.RoundTripper
+	backend          backend.Client
+	active           *atomic.Pointer[activeConfig]
+}
+
+// activeConfig is the config that a bouncingTransport runs requests with. Once it has been replaced, its bouncers are closed
+// when the last of the requests that were using it finishes.
+type activeConfig struct {
+	backingTransport http.RoundTripper
+	backend          backend.Client
 	bouncers         []Bouncer
+	errorResponses   ErrorResponses
+	evaluation       string
+	approvals        *approvalStore
+
+	lock     sync.Mutex
+	requests int
+	retired  bool
+}
+
+// acquire marks the config as in use by a request, returning false if it has already been replaced.
+func (c *activeConfig) acquire() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.retired {
+		return false
+	}
+
+	c.requests++
+	return true
+}
+
+// release marks a request that acquired the config as finished, closing the bouncers if it was the last one using a replaced config.
+func (c *activeConfig) release() {
+	c.lock.Lock()
+	c.requests--
+	done := c.retired && c.requests == 0
+	c.lock.Unlock()
+
+	if done {
+		c.closeBouncers()
+	}
+}
+
+// retire marks the config as replaced, closing the bouncers now if no requests are using them.
+func (c *activeConfig) retire() {
+	c.lock.Lock()
+	c.retired = true
+	done := c.requests == 0
+	c.lock.Unlock()
+
+	if done {
+		c.closeBouncers()
+	}
+}
+
+func (c *activeConfig) closeBouncers() {
+	for i := range c.bouncers {
+		c.bouncers[i].Close()
+	}
+}
+
+// newActiveConfig makes the config that a bouncingTransport runs requests with from the given Config.
+func (b bouncingTransport) newActiveConfig(config Config, approvals *approvalStore) *activeConfig {
+	return &activeConfig{
+		backingTransport: b.backingTransport,
+		backend:          b.backend,
+		bouncers:         config.Bouncers,
+		errorResponses:   config.ErrorResponses,
+		evaluation:       config.Evaluation,
+		approvals:        approvals,
+	}
+}
+
+// acquire returns the current config, marked as in use until it's released.
+func (b bouncingTransport) acquire() *activeConfig {
+	for {
+		// Acquiring only fails if the config was replaced after we loaded it, in which case there's a newer one to load.
+		if config := b.active.Load(); config.acquire() {
+			return config
+		}
+	}
 }
 
-// SetBouncers updates the bouncers on the given proxy.
+// SetBouncers updates the bouncers on the given proxy. The bouncers that it replaces are closed once the requests using them finish.
 func SetBouncers(bouncers []Bouncer, proxy *httputil.ReverseProxy) error {
 	transport, ok := proxy.Transport.(bouncingTransport)
 	if !ok {
 		return fmt.Errorf("given proxy is not a BouncingReverseProxy")
 	}
 
-	proxy.Transport = bouncingTransport{
-		backingTransport: transport.backingTransport,
-		bouncers:         bouncers,
+	current := transport.active.Load()
+	config := Config{
+		Bouncers:       bouncers,
+		ErrorResponses: current.errorResponses,
+		Evaluation:     current.evaluation,
+		approvals:      current.approvals,
 	}
 
-	return nil
+	if current.approvals != nil {
+		config.Approvals = &current.approvals.config
+	}
+
+	return SetConfig(config, proxy)
+}
+
+// SetConfig updates the bouncers, and the options that apply to them, on the given proxy. The bouncers that it replaces are closed
+// once the requests using them finish.
+func SetConfig(config Config, proxy *httputil.ReverseProxy) error {
+	transport, ok := proxy.Transport.(bouncingTransport)
+	if !ok {
+		return fmt.Errorf("given proxy is not a BouncingReverseProxy")
+	}
+
+	for {
+		current := transport.active.Load()
+
+		// Keep the requests that are waiting for approval, unless where they're kept has changed.
+		approvals := config.approvals
+		if current.approvals != nil && approvals != nil && reflect.DeepEqual(current.approvals.config, approvals.config) {
+			approvals = current.approvals
+		}
+
+		if transport.active.CompareAndSwap(current, transport.newActiveConfig(config, approvals)) {
+			current.retire()
+			return nil
+		}
+	}
 }
 
 func (b bouncingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
-	for _, bouncer := range b.bouncers {
-		if err := bouncer.Bounce(request); err != nil {
-			return err.ToResponse(), nil
+	config := b.acquire()
+	defer config.release()
+
+	return config.roundTrip(request)
+}
+
+func (c *activeConfig) roundTrip(request *http.Request) (*http.Response, error) {
+	// Approved requests have already been through the bouncers.
+	if _, ok := approvedBy(request); ok {
+		return c.backingTransport.RoundTrip(request)
+	}
+
+	// Deciders can ask the backend about e.g. the silence that a request is expiring. Multiple deciders are likely to ask
+	// about the same silence, so the answers are remembered for the rest of the request.
+	request = request.WithContext(backend.NewContext(request.Context(), backend.Memoize(c.backend)))
+
+	if rejection := c.mutate(request); rejection != nil {
+		return c.errorResponses.response(request, rejection), nil
+	}
+
+	var hooks []Hooks
+	for _, bouncer := range c.bouncers {
+		if !bouncer.Hooks.Empty() && bouncer.Target.Matches(request) {
+			hooks = append(hooks, bouncer.Hooks)
+		}
+	}
+
+	// Hooks need to see the request body, but by the time they run the body has been consumed, so we keep a copy.
+	var event *deciders.Event
+	if len(hooks) > 0 {
+		body, err := bufferBody(request)
+		if err != nil {
+			return c.errorResponses.response(request, &deciders.HTTPError{
+				Status: http.StatusBadRequest,
+				Err:    "failed to read body from request",
+				Reason: deciders.ReasonInvalidRequest,
+			}), nil
+		}
+
+		event = &deciders.Event{
+			Request: request,
+			Body:    body,
+		}
+	}
+
+	var rejections, warnings, approvals []*deciders.HTTPError
+	for _, bouncer := range c.bouncers {
+		result := bouncer.bounce(request, bouncer.evaluateAll(c.evaluation))
+		warnings = append(warnings, result.warnings...)
+		approvals = append(approvals, result.approvals...)
+		if event != nil {
+			for _, wouldHaveRejected := range result.dryRun {
+				dryRunEvent := *event
+				dryRunEvent.Bouncer = bouncer.Name
+				dryRunEvent.Rejection = wouldHaveRejected
+				dryRunEvent.DryRun = true
+				runAllHooks(hooks, &dryRunEvent)
+			}
+		}
+
+		if result.rejection != nil {
+			rejections = append(rejections, result.rejection)
+			if c.evaluation != EvaluationAll {
+				break
+			}
+		}
+	}
+
+	if len(rejections) == 0 && len(approvals) > 0 {
+		if c.approvals != nil {
+			return c.hold(request, approvals, warnings), nil
+		}
+
+		// Bouncers that weren't parsed from a config can have deciders in approval mode without anywhere to hold requests.
+		rejections = approvals
+	}
+
+	if len(rejections) > 0 {
+		rejection := rejections[0]
+		if c.evaluation == EvaluationAll {
+			rejection = aggregate(rejections)
+		}
+
+		if event != nil {
+			event.Bouncer = rejection.Bouncer
+			event.Rejection = rejection
+			runAllHooks(hooks, event)
+		}
+
+		response := c.errorResponses.response(request, rejection)
+		addWarnings(response.Header, warnings)
+		return response, nil
+	}
+
+	response, err := c.backingTransport.RoundTrip(request)
+	if err != nil {
+		if event != nil {
+			runAllHooks(hooks, event)
 		}
+
+		return nil, err
+	}
+
+	if err := c.observeResponse(request, response, event); err != nil {
+		return nil, err
 	}
 
-	return b.backingTransport.RoundTrip(request)
+	addWarnings(response.Header, warnings)
+
+	if event != nil {
+		runAllHooks(hooks, event)
+	}
+
+	return response, nil
+}
+
+// mutate runs the mutators of every bouncer that matches the given request, in order, replacing its body with theirs.
+func (c *activeConfig) mutate(request *http.Request) *deciders.HTTPError {
+	for _, bouncer := range c.bouncers {
+		if len(bouncer.Mutators) == 0 || !bouncer.Target.Matches(request) {
+			continue
+		}
+
+		body, err := bufferBody(request)
+		if err != nil {
+			return &deciders.HTTPError{
+				Status: http.StatusBadRequest,
+				Err:    "failed to read body from request",
+				Reason: deciders.ReasonInvalidRequest,
+			}
+		}
+
+		for i, mutator := range bouncer.Mutators {
+			var rejection *deciders.HTTPError
+			if body, rejection = mutator.Mutate(request, body); rejection != nil {
+				attributed := *rejection
+				attributed.Bouncer = bouncer.Name
+				if i < len(bouncer.mutatorNames) {
+					attributed.Decider = bouncer.mutatorNames[i]
+				}
+
+				return &attributed
+			}
+		}
+
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		request.ContentLength = int64(len(body))
+		if request.Header.Get("Content-Length") != "" {
+			request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		}
+	}
+
+	return nil
+}
+
+// hold stores the given request until it's approved, responding with the ID that it can be approved with.
+func (c *activeConfig) hold(request *http.Request, approvals, warnings []*deciders.HTTPError) *http.Response {
+	// Otherwise, anyone could approve their own requests by sending them without an identity.
+	if deciders.Identity(request, c.approvals.config.IdentityHeader) == "" {
+		return c.errorResponses.response(request, missingIdentity("requests that need approval require an identity"))
+	}
+
+	body, err := bufferBody(request)
+	if err != nil {
+		return c.errorResponses.response(request, &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    "failed to read body from request",
+			Reason: deciders.ReasonInvalidRequest,
+		})
+	}
+
+	approval, err := c.approvals.hold(request, body, approvals)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to hold request for approval")
+		return c.errorResponses.response(request, &deciders.HTTPError{
+			Status: http.StatusInternalServerError,
+			Err:    "failed to hold request for approval",
+			Reason: deciders.ReasonDeciderFailed,
+		})
+	}
+
+	auditLog.Info().Str("approval", approval.ID).Str("requester", approval.Requester).Str("method", approval.Method).Str("uri", approval.URI).Msg("Request held for approval")
+	response := pendingResponse(request, approval, aggregate(approvals))
+	addWarnings(response.Header, warnings)
+	return response
+}
+
+func runAllHooks(hooks []Hooks, event *deciders.Event) {
+	for _, h := range hooks {
+		h.run(event)
+	}
+}
+
+// bufferBody reads the body of the given request, replacing it with a copy that can be read again.
+func bufferBody(request *http.Request) ([]byte, error) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return []byte{}, nil
+	}
+
+	body, err := io.ReadAll(request.Body)
+	request.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// observeResponse passes the response from the backend to any deciders that want to see it, and to the hooks through the given event.
+func (c *activeConfig) observeResponse(request *http.Request, response *http.Response, event *deciders.Event) error {
+	var observers []deciders.ResponseObserver
+	for _, bouncer := range c.bouncers {
+		if !bouncer.Target.Matches(request) {
+			continue
+		}
+
+		for _, decider := range bouncer.Deciders {
+			if observer, ok := decider.(deciders.ResponseObserver); ok {
+				observers = append(observers, observer)
+			}
+		}
+	}
+
+	if len(observers) == 0 && event == nil {
+		return nil
+	}
+
+	// Like request bodies, we have to buffer the response body so that it can be read by the observers, and then the client.
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read body from backend: %w", err)
+	}
+
+	for _, observer := range observers {
+		observer.ObserveResponse(request, response, body)
+	}
+
+	if event != nil {
+		event.Response = response
+		event.ResponseBody = body
+	}
+
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
 }
 
 // NewBouncingReverseProxy generates a ReverseProxy instance which runs the given set of bouncers on every request that passes through it.
-func NewBouncingReverseProxy(backend *url.URL, bouncers []Bouncer, backingTransport http.RoundTripper) *httputil.ReverseProxy {
+func NewBouncingReverseProxy(backendURL *url.URL, bouncers []Bouncer, backingTransport http.RoundTripper) *httputil.ReverseProxy {
+	return NewBouncingReverseProxyWithConfig(backendURL, Config{Bouncers: bouncers}, backingTransport)
+}
+
+// NewBouncingReverseProxyWithConfig is NewBouncingReverseProxy, but with the options from the given Config as well as its Bouncers.
+func NewBouncingReverseProxyWithConfig(backendURL *url.URL, config Config, backingTransport http.RoundTripper) *httputil.ReverseProxy {
 	if backingTransport == nil {
 		backingTransport = http.DefaultTransport
 	}
 
-	proxy := httputil.NewSingleHostReverseProxy(backend)
-	proxy.Transport = bouncingTransport{
+	transport := bouncingTransport{
 		backingTransport: backingTransport,
-		bouncers:         bouncers,
+		backend:          backend.New(backendURL, backingTransport),
+		active:           atomic.NewPointer[activeConfig](nil),
 	}
 
+	transport.active.Store(transport.newActiveConfig(config, config.approvals))
+
+	proxy := httputil.NewSingleHostReverseProxy(backendURL)
+	proxy.Transport = transport
 	return proxy
 }
@@ -6,10 +6,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/grafana/regexp"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer"
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
@@ -74,6 +77,34 @@ bouncers:
 			expectedNumDeciders: []int{0},
 			expectedError:       true,
 		},
+		{
+			serialized: `
+bouncers:
+  - method: "POST"
+    uriRegex: "cats"
+    deciders:
+      - name: AllSilencesHaveAuthor
+        config:
+          domian: "quirl.co.nz"
+`,
+			expectedNumBouncers: 0,
+			expectedNumDeciders: []int{0},
+			expectedError:       true,
+		},
+		{
+			serialized: `
+bouncers:
+  - method: "POST"
+    uriRegex: "cats"
+    deciders:
+      - name: LongSilencesHaveTicket
+        config:
+          maxLength: 24h
+`,
+			expectedNumBouncers: 1,
+			expectedNumDeciders: []int{1},
+			expectedError:       false,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -139,6 +170,203 @@ func TestTargetMatches(t *testing.T) {
 	}
 }
 
+func TestParseTarget(t *testing.T) {
+	request := func(method, uri string, modify func(req *http.Request)) *http.Request {
+		req := testutil.MustMakeRequest(t, method, uri, "")
+		req.Host = req.URL.Host
+		req.Header = http.Header{}
+		req.RemoteAddr = "10.1.2.3:51234"
+		req.Header.Set("User-Agent", "amtool/0.26.0")
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		if modify != nil {
+			modify(req)
+		}
+
+		return req
+	}
+
+	testCases := []struct {
+		name           string
+		config         string
+		request        *http.Request
+		expectedOutput bool
+	}{
+		{
+			name:           "Test targets without a method match nothing",
+			config:         `{}`,
+			request:        request(http.MethodDelete, "http://testendpoint/api/v2/silence/1", nil),
+			expectedOutput: false,
+		},
+		{
+			name:           "Test targets with only a method match everything with that method",
+			config:         `{method: delete}`,
+			request:        request(http.MethodDelete, "http://testendpoint/api/v2/silence/1", nil),
+			expectedOutput: true,
+		},
+		{
+			name:           "Test multiple methods",
+			config:         `{methods: [POST, delete]}`,
+			request:        request(http.MethodDelete, "http://testendpoint/api/v2/silence/1", nil),
+			expectedOutput: true,
+		},
+		{
+			name:           "Test legacy method is combined with methods",
+			config:         `{method: PUT, methods: [POST]}`,
+			request:        request(http.MethodGet, "http://testendpoint/api/v2/silences", nil),
+			expectedOutput: false,
+		},
+		{
+			name:           "Test path ignores the query",
+			config:         `{method: GET, pathRegex: "^/api/v2/silences$"}`,
+			request:        request(http.MethodGet, "http://testendpoint/api/v2/silences?filter=foo", nil),
+			expectedOutput: true,
+		},
+		{
+			name:           "Test query parameters",
+			config:         `{method: GET, query: {filter: "^alertname="}}`,
+			request:        request(http.MethodGet, "http://testendpoint/api/v2/silences?filter=alertname%3DFoo", nil),
+			expectedOutput: true,
+		},
+		{
+			name:           "Test missing query parameters",
+			config:         `{method: GET, query: {filter: ".*"}}`,
+			request:        request(http.MethodGet, "http://testendpoint/api/v2/silences", nil),
+			expectedOutput: false,
+		},
+		{
+			name:           "Test header contains",
+			config:         `{method: POST, headers: [{name: User-Agent, contains: amtool}]}`,
+			request:        request(http.MethodPost, "http://testendpoint/api/v2/silences", nil),
+			expectedOutput: true,
+		},
+		{
+			name:           "Test header equals",
+			config:         `{method: POST, headers: [{name: User-Agent, equals: amtool}]}`,
+			request:        request(http.MethodPost, "http://testendpoint/api/v2/silences", nil),
+			expectedOutput: false,
+		},
+		{
+			name:           "Test header absent",
+			config:         `{method: POST, headers: [{name: Authorization, present: false}]}`,
+			request:        request(http.MethodPost, "http://testendpoint/api/v2/silences", nil),
+			expectedOutput: true,
+		},
+		{
+			name:           "Test host ignores the port",
+			config:         `{method: POST, hostRegex: "^alertmanager\\.example\\.com$"}`,
+			request:        request(http.MethodPost, "http://alertmanager.example.com:9093/api/v2/silences", nil),
+			expectedOutput: true,
+		},
+		{
+			name:           "Test source CIDRs",
+			config:         `{method: POST, sourceCIDRs: [192.168.0.0/16, 10.0.0.0/8]}`,
+			request:        request(http.MethodPost, "http://testendpoint/api/v2/silences", nil),
+			expectedOutput: true,
+		},
+		{
+			name:           "Test source outside CIDRs",
+			config:         `{method: POST, sourceCIDRs: [192.168.0.0/16]}`,
+			request:        request(http.MethodPost, "http://testendpoint/api/v2/silences", nil),
+			expectedOutput: false,
+		},
+		{
+			name:           "Test content types ignore parameters",
+			config:         `{method: POST, contentTypes: [application/json]}`,
+			request:        request(http.MethodPost, "http://testendpoint/api/v2/silences", nil),
+			expectedOutput: true,
+		},
+		{
+			name:   "Test content types",
+			config: `{method: POST, contentTypes: [application/json]}`,
+			request: request(http.MethodPost, "http://testendpoint/api/v2/silences", func(req *http.Request) {
+				req.Header.Set("Content-Type", "text/plain")
+			}),
+			expectedOutput: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var config bouncer.TargetConfig
+			require.NoError(t, yaml.Unmarshal([]byte(testCase.config), &config))
+
+			target, err := bouncer.ParseTarget(config)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expectedOutput, target.Matches(testCase.request), target.Mismatch(testCase.request))
+		})
+	}
+}
+
+func TestParseBouncersRejectsSharedResources(t *testing.T) {
+	rateLimits := func(first, second string) string {
+		return `
+bouncers:
+  - name: create
+    method: POST
+    uriRegex: /api/v2/silences
+    deciders:
+      - name: RateLimit
+        config: {key: createdBy, limit: 1, ` + first + `}
+  - name: expire
+    method: DELETE
+    uriRegex: /api/v2/silence/.*
+    deciders:
+      - name: RateLimit
+        config: {key: identity, limit: 1, ` + second + `}
+`
+	}
+
+	dir := t.TempDir()
+	testCases := []struct {
+		name          string
+		serialized    string
+		expectedError bool
+	}{
+		{
+			name:       "Test deciders can own different things",
+			serialized: rateLimits("name: create, snapshotFile: "+dir+"/create.json", "name: expire, snapshotFile: "+dir+"/expire.json"),
+		},
+		{
+			name:          "Test deciders can't share a snapshot file",
+			serialized:    rateLimits("snapshotFile: "+dir+"/ratelimit.json", "snapshotFile: "+dir+"/ratelimit.json"),
+			expectedError: true,
+		},
+		{
+			name:          "Test deciders can't share a name",
+			serialized:    rateLimits("name: silences", "name: silences"),
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			bouncers, err := bouncer.ParseBouncers([]byte(tt.serialized))
+			if tt.expectedError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			for i := range bouncers {
+				bouncers[i].Close()
+			}
+		})
+	}
+}
+
+func TestParseTargetErrors(t *testing.T) {
+	for _, config := range []bouncer.TargetConfig{
+		{URIRegex: "("},
+		{Query: map[string]string{"filter": "("}},
+		{Headers: []bouncer.HeaderMatcherConfig{{Contains: "amtool"}}},
+		{Headers: []bouncer.HeaderMatcherConfig{{Name: "User-Agent", Contains: "amtool", Equals: "amtool"}}},
+		{SourceCIDRs: []string{"10.0.0.0/33"}},
+	} {
+		_, err := bouncer.ParseTarget(config)
+		require.Error(t, err)
+	}
+}
+
 func TestBouncerBounces(t *testing.T) {
 	// Heavily cribbed from https://golang.org/src/net/http/httputil/reverseproxy_test.go
 
@@ -291,3 +519,209 @@ func TestBouncerBounces(t *testing.T) {
 		require.Equal(t, testCase.expectedStatus, response.StatusCode)
 	}
 }
+
+type recordingObserver struct {
+	statuses chan int
+	bodies   chan string
+}
+
+func (r *recordingObserver) Decide(req *http.Request) *deciders.HTTPError {
+	return nil
+}
+
+func (r *recordingObserver) ObserveResponse(req *http.Request, resp *http.Response, body []byte) {
+	r.statuses <- resp.StatusCode
+	r.bodies <- string(body)
+}
+
+func TestResponseObserversSeeBackendResponse(t *testing.T) {
+	const backendResponse = "I am the backend"
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(backendResponse))
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	observer := &recordingObserver{statuses: make(chan int, 1), bodies: make(chan string, 1)}
+	bouncers := []bouncer.Bouncer{
+		{
+			Target: bouncer.Target{
+				Method:   http.MethodPost,
+				URIRegex: regexp.MustCompile(".*"),
+			},
+			Deciders: []deciders.Decider{observer},
+		},
+	}
+
+	frontend := httptest.NewServer(bouncer.NewBouncingReverseProxy(backendURL, bouncers, http.DefaultTransport))
+	defer frontend.Close()
+
+	response, err := frontend.Client().Post(frontend.URL+"/api/v2/silences", "application/json", nil)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Equal(t, backendResponse, string(body), "Expected the client to still get the body after the observers")
+
+	require.Equal(t, http.StatusAccepted, <-observer.statuses)
+	require.Equal(t, backendResponse, <-observer.bodies)
+}
+
+func TestBouncersFetchExistingSilencesFromBackend(t *testing.T) {
+	deleted := false
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v2/silence/abc":
+			w.Write([]byte(`{"id": "abc", "createdBy": "colin@example.com"}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/v2/silence/abc":
+			deleted = true
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	bouncers, err := bouncer.ParseBouncers([]byte(`
+bouncers:
+  - method: DELETE
+    pathRegex: ^/api/v2/silence/
+    deciders:
+      - name: OnlyCreatorCanExpireSilences
+`))
+	require.NoError(t, err)
+
+	frontend := httptest.NewServer(bouncer.NewBouncingReverseProxy(backendURL, bouncers, http.DefaultTransport))
+	defer frontend.Close()
+
+	for _, testCase := range []struct {
+		user           string
+		expectedStatus int
+	}{
+		{user: "mallory@example.com", expectedStatus: http.StatusForbidden},
+		{user: "colin@example.com", expectedStatus: http.StatusOK},
+	} {
+		req, err := http.NewRequest(http.MethodDelete, frontend.URL+"/api/v2/silence/abc", nil)
+		require.NoError(t, err)
+		req.Header.Set(deciders.DefaultIdentityHeader, testCase.user)
+
+		response, err := frontend.Client().Do(req)
+		require.NoError(t, err)
+		response.Body.Close()
+		require.Equal(t, testCase.expectedStatus, response.StatusCode)
+		require.Equal(t, testCase.expectedStatus == http.StatusOK, deleted)
+	}
+}
+
+func TestMutatorsRunBeforeDeciders(t *testing.T) {
+	bodies := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		require.Equal(t, int64(len(body)), r.ContentLength, "Expected the content length to match the mutated body")
+		bodies <- string(body)
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	bouncers, err := bouncer.ParseBouncers([]byte(`
+bouncers:
+  - method: POST
+    pathRegex: ^/api/v2/silences$
+    mutators:
+      - name: SilenceTemplate
+        config:
+          createdBy: "{{ or .Silence.CreatedBy .Identity }}"
+    deciders:
+      - name: AllSilencesHaveAuthor
+        config:
+          domain: "@example.com"
+`))
+	require.NoError(t, err)
+
+	frontend := httptest.NewServer(bouncer.NewBouncingReverseProxy(backendURL, bouncers, http.DefaultTransport))
+	defer frontend.Close()
+
+	for _, testCase := range []struct {
+		user           string
+		expectedStatus int
+	}{
+		{user: "", expectedStatus: http.StatusBadRequest},
+		{user: "colin@example.com", expectedStatus: http.StatusOK},
+	} {
+		req, err := http.NewRequest(http.MethodPost, frontend.URL+"/api/v2/silences", strings.NewReader(`{"comment":"Disk swap"}`))
+		require.NoError(t, err)
+		req.Header.Set(deciders.DefaultIdentityHeader, testCase.user)
+
+		response, err := frontend.Client().Do(req)
+		require.NoError(t, err)
+		response.Body.Close()
+		require.Equal(t, testCase.expectedStatus, response.StatusCode)
+	}
+
+	require.JSONEq(t, `{"comment":"Disk swap","createdBy":"colin@example.com"}`, <-bodies, "Expected the backend to get the mutated body")
+}
+
+// blockingDecider accepts requests once it's released, and records when it's closed.
+type blockingDecider struct {
+	started  chan struct{}
+	released chan struct{}
+	closed   chan struct{}
+}
+
+func (b *blockingDecider) Decide(req *http.Request) *deciders.HTTPError {
+	close(b.started)
+	<-b.released
+	return nil
+}
+
+func (b *blockingDecider) Close() error {
+	close(b.closed)
+	return nil
+}
+
+func TestSetConfigWaitsForInFlightRequests(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	decider := &blockingDecider{started: make(chan struct{}), released: make(chan struct{}), closed: make(chan struct{})}
+	proxy := bouncer.NewBouncingReverseProxy(backendURL, []bouncer.Bouncer{{Target: bouncer.Target{Method: http.MethodPost}, Deciders: []deciders.Decider{decider}}}, http.DefaultTransport)
+	frontend := httptest.NewServer(proxy)
+	defer frontend.Close()
+
+	statuses := make(chan int, 1)
+	go func() {
+		response, err := frontend.Client().Post(frontend.URL+"/api/v2/silences", "application/json", strings.NewReader(`{}`))
+		if err != nil {
+			statuses <- 0
+			return
+		}
+
+		response.Body.Close()
+		statuses <- response.StatusCode
+	}()
+
+	<-decider.started
+	require.NoError(t, bouncer.SetConfig(bouncer.Config{}, proxy))
+
+	select {
+	case <-decider.closed:
+		t.Fatal("Expected the old bouncers not to be closed while a request is using them")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(decider.released)
+	require.Equal(t, http.StatusOK, <-statuses)
+
+	select {
+	case <-decider.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the old bouncers to be closed once the request finished")
+	}
+}
@@ -0,0 +1,136 @@
+package blastradius
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/backend"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+const defaultSampleSize = 5
+
+// BlastRadius is a Decider which rejects silences that would mute too much of what is currently firing: more than MaxAlerts alerts,
+// or more than MaxDistinct[label] different values of a label, e.g. more than one team. The rejection includes a sample of
+// SampleSize of the alerts that would be silenced, so that people can see what they missed.
+type BlastRadius struct {
+	MaxAlerts   int            `mapstructure:"maxAlerts"`
+	MaxDistinct map[string]int `mapstructure:"maxDistinct"`
+	SampleSize  int            `mapstructure:"sampleSize"`
+}
+
+func New(config map[string]interface{}) (deciders.Decider, error) {
+	var decider BlastRadius
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
+		return nil, err
+	}
+
+	if decider.MaxAlerts <= 0 && len(decider.MaxDistinct) == 0 {
+		return nil, fmt.Errorf("at least one of maxAlerts or maxDistinct must be set")
+	}
+
+	for label, max := range decider.MaxDistinct {
+		if max <= 0 {
+			return nil, fmt.Errorf("maxDistinct for %q must be positive", label)
+		}
+	}
+
+	if decider.SampleSize <= 0 {
+		decider.SampleSize = defaultSampleSize
+	}
+
+	return &decider, nil
+}
+
+// Decide implements deciders.Decider.
+func (b *BlastRadius) Decide(req *http.Request) *deciders.HTTPError {
+	silence, err := deciders.ParseSilence(req.Body)
+	if err != nil {
+		return &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    err.Error(),
+			Reason: deciders.ReasonInvalidRequest,
+		}
+	}
+
+	client, ok := backend.FromContext(req.Context())
+	if !ok {
+		return deciders.SilenceChangeError(fmt.Errorf("%w: no backend to list alerts from", deciders.ErrBackendUnavailable))
+	}
+
+	alerts, err := client.ListAlerts(req.Context())
+	if err != nil {
+		return deciders.SilenceChangeError(fmt.Errorf("%w: failed to list alerts: %s", deciders.ErrBackendUnavailable, err))
+	}
+
+	var muted []model.LabelSet
+	for _, alert := range alerts {
+		if !alert.Resolved() && silence.Matchers.Matches(alert.Labels) {
+			muted = append(muted, alert.Labels)
+		}
+	}
+
+	var problems []string
+	if b.MaxAlerts > 0 && len(muted) > b.MaxAlerts {
+		problems = append(problems, fmt.Sprintf("%d alerts (more than %d)", len(muted), b.MaxAlerts))
+	}
+
+	labels := make([]string, 0, len(b.MaxDistinct))
+	for label := range b.MaxDistinct {
+		labels = append(labels, label)
+	}
+
+	sort.Strings(labels)
+	for _, label := range labels {
+		values := distinct(muted, model.LabelName(label))
+		if len(values) > b.MaxDistinct[label] {
+			problems = append(problems, fmt.Sprintf("%d values of %s (%s, more than %d)", len(values), label, strings.Join(values, ", "), b.MaxDistinct[label]))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return &deciders.HTTPError{
+		Status: http.StatusBadRequest,
+		Err:    fmt.Sprintf("silence would mute %s, e.g. %s", strings.Join(problems, " and "), b.sample(muted)),
+		Reason: "blast_radius_exceeded",
+	}
+}
+
+// distinct returns the sorted, distinct values of the given label in the given label sets, ignoring label sets without it.
+func distinct(labelSets []model.LabelSet, label model.LabelName) []string {
+	seen := make(map[string]bool)
+	for _, labelSet := range labelSets {
+		if value, ok := labelSet[label]; ok {
+			seen[string(value)] = true
+		}
+	}
+
+	values := make([]string, 0, len(seen))
+	for value := range seen {
+		values = append(values, value)
+	}
+
+	sort.Strings(values)
+	return values
+}
+
+// sample describes up to SampleSize of the given label sets, in a stable order.
+func (b *BlastRadius) sample(labelSets []model.LabelSet) string {
+	strs := make([]string, 0, len(labelSets))
+	for _, labelSet := range labelSets {
+		strs = append(strs, labelSet.String())
+	}
+
+	sort.Strings(strs)
+	if len(strs) <= b.SampleSize {
+		return strings.Join(strs, ", ")
+	}
+
+	return fmt.Sprintf("%s, and %d more", strings.Join(strs[:b.SampleSize], ", "), len(strs)-b.SampleSize)
+}
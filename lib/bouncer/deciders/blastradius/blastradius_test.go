@@ -0,0 +1,79 @@
+package blastradius_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/blastradius"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlastRadius(t *testing.T) {
+	var alerts []model.Alert
+	for i := 0; i < 10; i++ {
+		alerts = append(alerts, model.Alert{Labels: model.LabelSet{
+			"alertname": "InstanceDown",
+			"instance":  model.LabelValue(fmt.Sprintf("host-%d", i)),
+			"team":      "infra",
+		}})
+	}
+	alerts = append(alerts, model.Alert{Labels: model.LabelSet{"alertname": "InstanceDown", "instance": "db-1", "team": "databases"}})
+	backend := &testutil.FakeBackend{Alerts: alerts}
+
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(blastradius.New), map[string]interface{}{
+		"maxAlerts":   5,
+		"maxDistinct": map[string]interface{}{"team": 1},
+		"sampleSize":  2,
+	})
+
+	testCases := []struct {
+		name            string
+		input           string
+		expectedSuccess bool
+		expectedError   string
+	}{
+		{
+			name:            "Test a narrow silence works",
+			input:           `{"matchers":[{"name":"instance","value":"host-1","isRegex":false}]}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test a silence muting too many alerts is rejected",
+			input:           `{"matchers":[{"name":"team","value":"infra","isRegex":false}]}`,
+			expectedSuccess: false,
+			expectedError:   `silence would mute 10 alerts (more than 5), e.g. {alertname="InstanceDown", instance="host-0", team="infra"}, {alertname="InstanceDown", instance="host-1", team="infra"}, and 8 more`,
+		},
+		{
+			name:            "Test a silence muting too many teams is rejected",
+			input:           `{"matchers":[{"name":"instance","value":"(host-1|db-1)","isRegex":true}]}`,
+			expectedSuccess: false,
+			expectedError:   `silence would mute 2 values of team (databases, infra, more than 1), e.g. {alertname="InstanceDown", instance="db-1", team="databases"}, {alertname="InstanceDown", instance="host-1", team="infra"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := testutil.WithBackend(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", tt.input), backend)
+			response := decider.Decide(req)
+			if tt.expectedSuccess {
+				require.Nil(t, response)
+			} else {
+				require.NotNil(t, response)
+				require.Equal(t, "blast_radius_exceeded", response.Reason)
+				require.Equal(t, tt.expectedError, response.Err)
+			}
+		})
+	}
+}
+
+func TestBlastRadiusConfig(t *testing.T) {
+	_, err := blastradius.New(map[string]interface{}{})
+	require.Error(t, err, "Expected a blast radius without any limits to be rejected")
+
+	_, err = blastradius.New(map[string]interface{}{"maxDistinct": map[string]interface{}{"team": 0}})
+	require.Error(t, err)
+}
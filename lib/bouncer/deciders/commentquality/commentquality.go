@@ -0,0 +1,160 @@
+package commentquality
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/grafana/regexp"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+// CommentQuality is a Decider which rejects silences with comments that won't help the next person on call. Comments must be at
+// least MinLength characters and MinWords words long, mustn't contain any of BannedPhrases (as whole words, case insensitively),
+// must match every one of RequiredPatterns, and if RejectAlertName is set, must say more than the alertname being silenced.
+// Every rule that a comment breaks is reported separately.
+type CommentQuality struct {
+	MinLength        int              `mapstructure:"minLength"`
+	MinWords         int              `mapstructure:"minWords"`
+	BannedPhrases    []string         `mapstructure:"bannedPhrases"`
+	RequiredPatterns []*regexp.Regexp `mapstructure:"requiredPatterns"`
+	RejectAlertName  bool             `mapstructure:"rejectAlertName"`
+
+	banned []*regexp.Regexp
+}
+
+func New(config map[string]interface{}) (deciders.Decider, error) {
+	var decider CommentQuality
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
+		return nil, err
+	}
+
+	if decider.MinLength < 0 || decider.MinWords < 0 {
+		return nil, fmt.Errorf("minLength and minWords can't be negative")
+	}
+
+	for _, phrase := range decider.BannedPhrases {
+		decider.banned = append(decider.banned, regexp.MustCompile(`(?i)`+phrasePattern(phrase)))
+	}
+
+	return &decider, nil
+}
+
+// Decide implements deciders.Decider.
+func (c *CommentQuality) Decide(req *http.Request) *deciders.HTTPError {
+	silence, err := deciders.ParseSilence(req.Body)
+	if err != nil {
+		return &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    err.Error(),
+			Reason: deciders.ReasonInvalidRequest,
+		}
+	}
+
+	comment := strings.TrimSpace(silence.Comment)
+	var violations []*deciders.HTTPError
+	violate := func(reason, format string, args ...interface{}) {
+		violations = append(violations, &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    fmt.Sprintf(format, args...),
+			Reason: reason,
+		})
+	}
+
+	if length := utf8.RuneCountInString(comment); length < c.MinLength {
+		violate("comment_too_short", "comment must be at least %d characters long, got %d", c.MinLength, length)
+	}
+
+	if words := len(strings.Fields(comment)); words < c.MinWords {
+		violate("comment_too_few_words", "comment must be at least %d words long, got %d", c.MinWords, words)
+	}
+
+	for i, banned := range c.banned {
+		if banned.MatchString(comment) {
+			violate("banned_phrase", "comment mustn't contain %q", c.BannedPhrases[i])
+		}
+	}
+
+	for _, pattern := range c.RequiredPatterns {
+		if !pattern.MatchString(comment) {
+			violate("missing_required_pattern", "comment must match %q", pattern)
+		}
+	}
+
+	if c.RejectAlertName {
+		if name, ok := alertName(silence); ok && onlyRepeats(comment, name) {
+			violate("comment_repeats_alertname", "comment must say more than the name of the alert, %s", name)
+		}
+	}
+
+	switch len(violations) {
+	case 0:
+		return nil
+	case 1:
+		return violations[0]
+	}
+
+	messages := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		messages = append(messages, violation.Err)
+	}
+
+	return &deciders.HTTPError{
+		Status:     http.StatusBadRequest,
+		Err:        strings.Join(messages, "; "),
+		Reason:     "poor_comment",
+		Violations: violations,
+	}
+}
+
+// phrasePattern returns a pattern that matches the given phrase as a whole word, so that e.g. "test" doesn't match "latest".
+// Word boundaries only go next to word characters, because phrases like "n/a" or "..." would never match with one.
+func phrasePattern(phrase string) string {
+	pattern := regexp.QuoteMeta(phrase)
+	if phrase == "" {
+		return pattern
+	}
+
+	if isWordChar(phrase[0]) {
+		pattern = `\b` + pattern
+	}
+
+	if isWordChar(phrase[len(phrase)-1]) {
+		pattern += `\b`
+	}
+
+	return pattern
+}
+
+// isWordChar returns whether c is matched by \w, which is what \b looks for.
+func isWordChar(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// alertName returns the alertname that the given silence has an equality matcher for, if any.
+func alertName(silence types.Silence) (string, bool) {
+	for _, matcher := range silence.Matchers {
+		if matcher.Name == model.AlertNameLabel && matcher.Type == labels.MatchEqual {
+			return matcher.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// onlyRepeats returns whether the given comment is nothing but the given alertname, ignoring case and punctuation.
+func onlyRepeats(comment, name string) bool {
+	if name == "" {
+		return false
+	}
+
+	rest := strings.ReplaceAll(strings.ToLower(comment), strings.ToLower(name), "")
+	return strings.IndexFunc(rest, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}) == -1
+}
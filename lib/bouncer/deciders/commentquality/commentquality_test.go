@@ -0,0 +1,104 @@
+package commentquality_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/commentquality"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommentQuality(t *testing.T) {
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(commentquality.New), map[string]interface{}{
+		"minLength":        20,
+		"minWords":         4,
+		"bannedPhrases":    []string{"silence", "asdf", "n/a", "tbd.", "..."},
+		"requiredPatterns": []string{`https?://|[A-Z]+-[0-9]+`},
+		"rejectAlertName":  true,
+	})
+
+	testCases := []struct {
+		name            string
+		comment         string
+		expectedReasons []string
+	}{
+		{
+			name:    "Test a useful comment works",
+			comment: "Disk replacement on db-1 tracked in OPS-123",
+		},
+		{
+			name:            "Test every broken rule is reported",
+			comment:         "silence",
+			expectedReasons: []string{"comment_too_short", "comment_too_few_words", "banned_phrase", "missing_required_pattern"},
+		},
+		{
+			name:            "Test banned phrases only match whole words",
+			comment:         "Silenced while we replace the disk, OPS-123",
+			expectedReasons: nil,
+		},
+		{
+			name:            "Test banned phrases are case insensitive",
+			comment:         "ASDF ASDF ASDF ASDF see OPS-123",
+			expectedReasons: []string{"banned_phrase"},
+		},
+		{
+			name:            "Test banned phrases can contain punctuation",
+			comment:         "n/a, will fill this in later OPS-123",
+			expectedReasons: []string{"banned_phrase"},
+		},
+		{
+			name:            "Test banned phrases can end with punctuation",
+			comment:         "Disk replacement on db-1, tbd. OPS-123",
+			expectedReasons: []string{"banned_phrase"},
+		},
+		{
+			name:            "Test banned phrases can be only punctuation",
+			comment:         "Disk replacement on db-1 ... OPS-123",
+			expectedReasons: []string{"banned_phrase"},
+		},
+		{
+			name:            "Test banned phrases with punctuation still match whole words",
+			comment:         "Disk replacement on db-1, outbd. OPS-123",
+			expectedReasons: nil,
+		},
+		{
+			name:            "Test comments that repeat the alertname are rejected",
+			comment:         "InstanceDown - instancedown!",
+			expectedReasons: []string{"comment_too_few_words", "missing_required_pattern", "comment_repeats_alertname"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			input := `{"matchers":[{"name":"alertname","value":"InstanceDown","isRegex":false}],"comment":"` + tt.comment + `"}`
+			response := decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", input))
+			if len(tt.expectedReasons) == 0 {
+				require.Nil(t, response)
+				return
+			}
+
+			require.NotNil(t, response)
+			require.Equal(t, http.StatusBadRequest, response.Status)
+			if len(tt.expectedReasons) == 1 {
+				require.Equal(t, tt.expectedReasons[0], response.Reason)
+				return
+			}
+
+			var reasons []string
+			for _, violation := range response.Violations {
+				reasons = append(reasons, violation.Reason)
+			}
+			require.Equal(t, tt.expectedReasons, reasons)
+		})
+	}
+}
+
+func TestCommentQualityConfig(t *testing.T) {
+	_, err := commentquality.New(map[string]interface{}{"requiredPatterns": []string{"("}})
+	require.Error(t, err)
+
+	_, err = commentquality.New(map[string]interface{}{"minWords": -1})
+	require.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package deciders
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/grafana/regexp"
+	"github.com/mitchellh/mapstructure"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/internal/jsonschema"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	regexpType   = reflect.TypeOf(&regexp.Regexp{})
+	locationType = reflect.TypeOf(&time.Location{})
+)
+
+// DecodeConfig decodes the given decider config into result, which should be a pointer to a struct with `mapstructure` tags.
+// Decoding is strict, i.e. keys in the config that don't correspond to a field are an error. Strings are decoded
+// into time.Durations (e.g. "24h"), *regexp.Regexps, and *time.Locations (e.g. "Pacific/Auckland").
+func DecodeConfig(config map[string]interface{}, result interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		ErrorUnused: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			stringToRegexpHookFunc,
+			stringToLocationHookFunc,
+		),
+		Result: result,
+	})
+	if err != nil {
+		return err
+	}
+
+	return decoder.Decode(config)
+}
+
+func stringToRegexpHookFunc(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String || to != regexpType {
+		return data, nil
+	}
+
+	regex, err := regexp.Compile(data.(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %s", data, err)
+	}
+
+	return regex, nil
+}
+
+func stringToLocationHookFunc(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String || to != locationType {
+		return data, nil
+	}
+
+	location, err := time.LoadLocation(data.(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %s", data, err)
+	}
+
+	return location, nil
+}
+
+// ConfigSchema generates a JSON Schema describing the config that DecodeConfig accepts for the given struct.
+func ConfigSchema(config interface{}) map[string]interface{} {
+	return jsonschema.Reflect(config, "mapstructure")
+}
@@ -0,0 +1,82 @@
+package deciders_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/regexp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+type testConfig struct {
+	Duration time.Duration  `mapstructure:"duration"`
+	Regex    *regexp.Regexp `mapstructure:"regex"`
+	Location *time.Location `mapstructure:"location"`
+	Nested   struct {
+		Name string `mapstructure:"name"`
+	} `mapstructure:"nested"`
+}
+
+func TestDecodeConfig(t *testing.T) {
+	var config testConfig
+	require.NoError(t, deciders.DecodeConfig(map[string]interface{}{
+		"duration": "24h",
+		"regex":    "^[A-Z]+-[0-9]+",
+		"location": "Pacific/Auckland",
+		"nested":   map[string]interface{}{"name": "cats"},
+	}, &config))
+
+	require.Equal(t, 24*time.Hour, config.Duration)
+	require.True(t, config.Regex.MatchString("ABC-123"))
+	require.Equal(t, "Pacific/Auckland", config.Location.String())
+	require.Equal(t, "cats", config.Nested.Name)
+}
+
+func TestDecodeConfigErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config map[string]interface{}
+	}{
+		{
+			name:   "Unknown Keys Fail",
+			config: map[string]interface{}{"durration": "24h"},
+		},
+		{
+			name:   "Unknown Nested Keys Fail",
+			config: map[string]interface{}{"nested": map[string]interface{}{"nmae": "cats"}},
+		},
+		{
+			name:   "Invalid Durations Fail",
+			config: map[string]interface{}{"duration": "a day"},
+		},
+		{
+			name:   "Invalid Regexes Fail",
+			config: map[string]interface{}{"regex": "("},
+		},
+		{
+			name:   "Invalid Locations Fail",
+			config: map[string]interface{}{"location": "Middle/Earth"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var config testConfig
+			require.Error(t, deciders.DecodeConfig(tt.config, &config))
+		})
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	schema := deciders.ConfigSchema(testConfig{})
+	require.Equal(t, "object", schema["type"])
+	require.Equal(t, false, schema["additionalProperties"])
+
+	properties := schema["properties"].(map[string]interface{})
+	require.Len(t, properties, 4)
+	require.Equal(t, "string", properties["duration"].(map[string]interface{})["type"])
+	require.Equal(t, "regex", properties["regex"].(map[string]interface{})["format"])
+	require.Equal(t, "object", properties["nested"].(map[string]interface{})["type"])
+}
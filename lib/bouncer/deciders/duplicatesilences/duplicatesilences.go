@@ -0,0 +1,160 @@
+package duplicatesilences
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/backend"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+const (
+	// MatchExact finds existing silences with the same matchers, that last at least as long as the new one.
+	MatchExact = "exact"
+	// MatchSuperset finds existing silences whose matchers silence everything the new one would, that last at least as long as the new one.
+	MatchSuperset = "superset"
+	// MatchOverlap finds existing silences which could silence some of the same alerts as the new one, at the same time.
+	MatchOverlap = "overlap"
+
+	defaultCacheTTL = 30 * time.Second
+)
+
+// NoDuplicateSilences is a Decider which rejects silences that are already covered by an active silence in the backend.
+// Use it in warn mode to tell people about the existing silence, without stopping them.
+type NoDuplicateSilences struct {
+	CacheTTL time.Duration `mapstructure:"cacheTTL"`
+	Match    string        `mapstructure:"match"`
+
+	cache *backend.SilenceCache
+}
+
+func New(config map[string]interface{}) (deciders.Decider, error) {
+	var decider NoDuplicateSilences
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
+		return nil, err
+	}
+
+	if decider.CacheTTL == 0 {
+		decider.CacheTTL = defaultCacheTTL
+	}
+
+	switch decider.Match {
+	case "":
+		decider.Match = MatchExact
+	case MatchExact, MatchSuperset, MatchOverlap:
+	default:
+		return nil, fmt.Errorf("match must be one of %q, %q, or %q, got %q", MatchExact, MatchSuperset, MatchOverlap, decider.Match)
+	}
+
+	decider.cache = backend.NewSilenceCache(decider.CacheTTL)
+	return &decider, nil
+}
+
+// Decide implements deciders.Decider.
+func (n *NoDuplicateSilences) Decide(req *http.Request) *deciders.HTTPError {
+	silence, err := deciders.ParseSilence(req.Body)
+	if err != nil {
+		return &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    err.Error(),
+			Reason: deciders.ReasonInvalidRequest,
+		}
+	}
+
+	client, ok := backend.FromContext(req.Context())
+	if !ok {
+		return deciders.SilenceChangeError(fmt.Errorf("%w: no backend to list silences from", deciders.ErrBackendUnavailable))
+	}
+
+	existing, err := n.cache.List(req.Context(), client)
+	if err != nil {
+		return deciders.SilenceChangeError(fmt.Errorf("%w: failed to list silences: %s", deciders.ErrBackendUnavailable, err))
+	}
+
+	now := time.Now()
+	var duplicates []string
+	for _, other := range existing {
+		if other.ID == silence.ID || !deciders.IsActive(other, now) {
+			continue
+		}
+
+		if n.matches(silence, other) {
+			duplicates = append(duplicates, fmt.Sprintf("%s (created by %q)", other.ID, other.CreatedBy))
+		}
+	}
+
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	return &deciders.HTTPError{
+		Status: http.StatusConflict,
+		Err:    fmt.Sprintf("this silence is already covered by existing silences: %s", strings.Join(duplicates, ", ")),
+		Reason: "duplicate_silence",
+	}
+}
+
+// matches returns whether the existing silence counts as a duplicate of the new one, according to the configured Match strictness.
+func (n *NoDuplicateSilences) matches(silence, existing types.Silence) bool {
+	switch n.Match {
+	case MatchExact:
+		return covers(existing, silence) && sameMatchers(existing.Matchers, silence.Matchers)
+	case MatchSuperset:
+		return covers(existing, silence) && subset(existing.Matchers, silence.Matchers)
+	default:
+		return overlaps(existing, silence) && !contradicts(existing.Matchers, silence.Matchers)
+	}
+}
+
+// covers returns whether a lasts for at least the whole of b.
+func covers(a, b types.Silence) bool {
+	return !a.StartsAt.After(b.StartsAt) && !a.EndsAt.Before(b.EndsAt)
+}
+
+// overlaps returns whether a and b are active at the same time.
+func overlaps(a, b types.Silence) bool {
+	return a.StartsAt.Before(b.EndsAt) && b.StartsAt.Before(a.EndsAt)
+}
+
+func sameMatchers(a, b labels.Matchers) bool {
+	return subset(a, b) && subset(b, a)
+}
+
+// subset returns whether every matcher in a is also in b, i.e. a silence with the matchers a silences every alert that b does.
+func subset(a, b labels.Matchers) bool {
+	set := make(map[string]bool, len(b))
+	for _, matcher := range b {
+		set[matcher.String()] = true
+	}
+
+	for _, matcher := range a {
+		if !set[matcher.String()] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// contradicts returns whether no alert could be matched by both a and b, because they require different values for the same label.
+// Only equality matchers are considered, so this can miss contradictions between regexes.
+func contradicts(a, b labels.Matchers) bool {
+	values := make(map[string]string)
+	for _, matcher := range a {
+		if matcher.Type == labels.MatchEqual {
+			values[matcher.Name] = matcher.Value
+		}
+	}
+
+	for _, matcher := range b {
+		if value, ok := values[matcher.Name]; ok && matcher.Type == labels.MatchEqual && value != matcher.Value {
+			return true
+		}
+	}
+
+	return false
+}
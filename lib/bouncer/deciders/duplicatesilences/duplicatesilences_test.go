@@ -0,0 +1,147 @@
+package duplicatesilences_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/duplicatesilences"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func mustMakeMatchers(t *testing.T, pairs ...string) labels.Matchers {
+	t.Helper()
+	var matchers labels.Matchers
+	for i := 0; i < len(pairs); i += 2 {
+		matcher, err := labels.NewMatcher(labels.MatchEqual, pairs[i], pairs[i+1])
+		require.NoError(t, err)
+		matchers = append(matchers, matcher)
+	}
+
+	return matchers
+}
+
+func TestNoDuplicateSilences(t *testing.T) {
+	start := time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)
+	backend := &testutil.FakeBackend{
+		Silences: []types.Silence{
+			{
+				ID:        "abc",
+				CreatedBy: "colin",
+				Matchers:  mustMakeMatchers(t, "alertname", "Foo", "cluster", "prod"),
+				StartsAt:  start,
+				EndsAt:    start.Add(8 * time.Hour),
+				Status:    types.SilenceStatus{State: types.SilenceStateActive},
+			},
+			{
+				ID:        "def",
+				CreatedBy: "someone",
+				Matchers:  mustMakeMatchers(t, "alertname", "Bar"),
+				StartsAt:  start,
+				EndsAt:    start.Add(8 * time.Hour),
+				Status:    types.SilenceStatus{State: types.SilenceStateExpired},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name            string
+		match           string
+		input           string
+		expectedSuccess bool
+	}{
+		{
+			name:            "Test an exact duplicate is rejected",
+			match:           "exact",
+			input:           `{"matchers":[{"name":"cluster","value":"prod","isRegex":false},{"name":"alertname","value":"Foo","isRegex":false}],"startsAt":"2020-01-19T01:00:00Z","endsAt":"2020-01-19T02:00:00Z"}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "Test an exact duplicate that lasts longer works",
+			match:           "exact",
+			input:           `{"matchers":[{"name":"cluster","value":"prod","isRegex":false},{"name":"alertname","value":"Foo","isRegex":false}],"startsAt":"2020-01-19T01:00:00Z","endsAt":"2020-01-19T12:00:00Z"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test updating the existing silence works",
+			match:           "exact",
+			input:           `{"id":"abc","matchers":[{"name":"cluster","value":"prod","isRegex":false},{"name":"alertname","value":"Foo","isRegex":false}],"startsAt":"2020-01-19T01:00:00Z","endsAt":"2020-01-19T02:00:00Z"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test a narrower silence isn't an exact duplicate",
+			match:           "exact",
+			input:           `{"matchers":[{"name":"cluster","value":"prod","isRegex":false},{"name":"alertname","value":"Foo","isRegex":false},{"name":"instance","value":"a","isRegex":false}],"startsAt":"2020-01-19T01:00:00Z","endsAt":"2020-01-19T02:00:00Z"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test a narrower silence is rejected with superset matching",
+			match:           "superset",
+			input:           `{"matchers":[{"name":"cluster","value":"prod","isRegex":false},{"name":"alertname","value":"Foo","isRegex":false},{"name":"instance","value":"a","isRegex":false}],"startsAt":"2020-01-19T01:00:00Z","endsAt":"2020-01-19T02:00:00Z"}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "Test a broader silence works with superset matching",
+			match:           "superset",
+			input:           `{"matchers":[{"name":"alertname","value":"Foo","isRegex":false}],"startsAt":"2020-01-19T01:00:00Z","endsAt":"2020-01-19T02:00:00Z"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test a broader silence that starts at the same time is rejected with overlap matching",
+			match:           "overlap",
+			input:           `{"matchers":[{"name":"alertname","value":"Foo","isRegex":false}],"startsAt":"2020-01-19T07:00:00Z","endsAt":"2020-01-19T12:00:00Z"}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "Test a contradicting silence works with overlap matching",
+			match:           "overlap",
+			input:           `{"matchers":[{"name":"alertname","value":"Foo","isRegex":false},{"name":"cluster","value":"dev","isRegex":false}],"startsAt":"2020-01-19T01:00:00Z","endsAt":"2020-01-19T02:00:00Z"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test a silence after the existing one works with overlap matching",
+			match:           "overlap",
+			input:           `{"matchers":[{"name":"alertname","value":"Foo","isRegex":false}],"startsAt":"2020-01-19T09:00:00Z","endsAt":"2020-01-19T12:00:00Z"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test expired silences are ignored",
+			match:           "exact",
+			input:           `{"matchers":[{"name":"alertname","value":"Bar","isRegex":false}],"startsAt":"2020-01-19T01:00:00Z","endsAt":"2020-01-19T02:00:00Z"}`,
+			expectedSuccess: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(duplicatesilences.New), map[string]interface{}{"match": tt.match})
+			req := testutil.WithBackend(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", tt.input), backend)
+			response := decider.Decide(req)
+			if tt.expectedSuccess {
+				require.Nil(t, response)
+			} else {
+				require.NotNil(t, response)
+				require.Equal(t, http.StatusConflict, response.Status)
+				require.Equal(t, "duplicate_silence", response.Reason)
+				require.Contains(t, response.Err, "abc")
+				require.Contains(t, response.Err, "colin")
+			}
+		})
+	}
+}
+
+func TestNoDuplicateSilencesErrors(t *testing.T) {
+	_, err := duplicatesilences.New(map[string]interface{}{"match": "fuzzy"})
+	require.Error(t, err)
+
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(duplicatesilences.New), map[string]interface{}{})
+	req := testutil.WithBackend(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"matchers":[]}`), &testutil.FakeBackend{Err: errors.New("broken")})
+	response := decider.Decide(req)
+	require.NotNil(t, response)
+	require.Equal(t, http.StatusBadGateway, response.Status)
+}
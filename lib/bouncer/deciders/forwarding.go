@@ -0,0 +1,42 @@
+package deciders
+
+import "net/http"
+
+// DefaultForwardedHeaders are the request headers that deciders which hand requests to something else, e.g. a webhook or a plugin,
+// pass along when they aren't configured with their own list. Credentials like Authorization and Cookie are left out, so that they
+// are only sent to other services if they're asked for explicitly.
+var DefaultForwardedHeaders = []string{"Content-Type", "User-Agent", DefaultIdentityHeader}
+
+// ForwardedHeaders returns the headers of the given request that are in allowed, or in DefaultForwardedHeaders if allowed is empty.
+// It returns nil if the request has none of them.
+func ForwardedHeaders(header http.Header, allowed []string) http.Header {
+	if len(allowed) == 0 {
+		allowed = DefaultForwardedHeaders
+	}
+
+	var forwarded http.Header
+	for _, name := range allowed {
+		values := header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+
+		if forwarded == nil {
+			forwarded = make(http.Header, len(allowed))
+		}
+
+		forwarded[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+	}
+
+	return forwarded
+}
+
+// RejectionStatus returns the status to reject a request with, given the status that something outside the bouncer, e.g. a webhook
+// or a plugin, asked for. Anything that isn't a 4xx or 5xx would tell the client that the request worked, so it becomes a 400.
+func RejectionStatus(status int) int {
+	if status < 400 || status > 599 {
+		return http.StatusBadRequest
+	}
+
+	return status
+}
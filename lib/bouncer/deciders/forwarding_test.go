@@ -0,0 +1,36 @@
+package deciders_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Authorization", "Bearer secret")
+	header.Set("Cookie", "session=secret")
+	header.Add("X-Tenant", "a")
+	header.Add("X-Tenant", "b")
+
+	require.Equal(t, http.Header{"Content-Type": {"application/json"}}, deciders.ForwardedHeaders(header, nil), "Expected credentials not to be forwarded by default")
+	require.Equal(t, http.Header{"X-Tenant": {"a", "b"}, "Authorization": {"Bearer secret"}}, deciders.ForwardedHeaders(header, []string{"x-tenant", "Authorization"}))
+	require.Nil(t, deciders.ForwardedHeaders(http.Header{}, nil))
+}
+
+func TestRejectionStatus(t *testing.T) {
+	for status, expected := range map[int]int{
+		0:                             http.StatusBadRequest,
+		http.StatusOK:                 http.StatusBadRequest,
+		http.StatusFound:              http.StatusBadRequest,
+		http.StatusForbidden:          http.StatusForbidden,
+		http.StatusServiceUnavailable: http.StatusServiceUnavailable,
+		600:                           http.StatusBadRequest,
+	} {
+		require.Equal(t, expected, deciders.RejectionStatus(status), "status %d", status)
+	}
+}
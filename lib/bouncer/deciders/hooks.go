@@ -0,0 +1,45 @@
+package deciders
+
+import "net/http"
+
+// Event describes the outcome of a request that a bouncer handled. It is passed to Hooks once the outcome is known.
+type Event struct {
+	// Request is the request that was handled, and Body is its body. The requests Body has already been consumed, so Hooks should use Body instead.
+	Request *http.Request
+	Body    []byte
+
+	// Rejection is the error that the request was rejected with, or nil if it was accepted, and Bouncer is the name of the bouncer that rejected it.
+	Rejection *HTTPError
+	Bouncer   string
+
+	// DryRun is set when a bouncer in dry run mode would have rejected the request with Rejection. The request
+	// carries on to the other bouncers, and these events are passed to OnRejected hooks alongside real rejections.
+	DryRun bool
+
+	// Response is the response from the backend, and ResponseBody is its body. Response is nil if the request was rejected,
+	// or the backend couldn't be reached.
+	Response     *http.Response
+	ResponseBody []byte
+}
+
+// Hook is a side effect that runs after a request has been accepted or rejected, e.g. mirroring it, or sending a notification.
+// Hooks run in the request path, so anything slow should be done in the background.
+type Hook interface {
+	Run(event *Event)
+}
+
+type HookFunc func(event *Event)
+
+func (h HookFunc) Run(event *Event) {
+	h(event)
+}
+
+type HookTemplate interface {
+	Make(map[string]interface{}) (Hook, error)
+}
+
+type HookTemplateFunc func(map[string]interface{}) (Hook, error)
+
+func (h HookTemplateFunc) Make(config map[string]interface{}) (Hook, error) {
+	return h(config)
+}
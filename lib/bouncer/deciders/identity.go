@@ -0,0 +1,16 @@
+package deciders
+
+import "net/http"
+
+// DefaultIdentityHeader is the header that deciders read the identity of the person making a request from, unless they're configured
+// otherwise. It should be set by an authenticating proxy in front of the bouncer.
+const DefaultIdentityHeader = "X-Forwarded-User"
+
+// Identity returns the identity of the person making the given request from the given header, or DefaultIdentityHeader if it's empty.
+func Identity(req *http.Request, header string) string {
+	if header == "" {
+		header = DefaultIdentityHeader
+	}
+
+	return req.Header.Get(header)
+}
@@ -1,9 +1,10 @@
 package deciders
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"net/http"
-	"strings"
 )
 
 // Decider is a function which takes an HTTP request and optionally returns an HTTPError, if the given request should be rejected.
@@ -11,23 +12,103 @@ type Decider interface {
 	Decide(req *http.Request) *HTTPError
 }
 
+// ResponseObserver is an optional interface for Deciders that want to see how the backend responded to the requests that they accepted.
+// ObserveResponse is called after the backend responds, with the same request that was passed to Decide, and the full response body.
+type ResponseObserver interface {
+	ObserveResponse(req *http.Request, resp *http.Response, body []byte)
+}
+
+// ResourceOwner is an optional interface for Deciders that use something, e.g. a file, which no other Decider in the same config
+// may use. OwnedResources describes each of them, e.g. `snapshotFile "/var/lib/ratelimit.json"`, and configs that have two Deciders
+// with the same description are rejected.
+type ResourceOwner interface {
+	OwnedResources() []string
+}
+
 type DeciderFunc func(req *http.Request) *HTTPError
 
 func (d DeciderFunc) Decide(req *http.Request) *HTTPError {
 	return d(req)
 }
 
+const (
+	// ReasonRejected is the Reason of HTTPErrors that don't set one.
+	ReasonRejected = "rejected"
+	// ReasonInvalidRequest is the Reason for requests that couldn't be read, or didn't contain what a decider expected.
+	ReasonInvalidRequest = "invalid_request"
+	// ReasonDeciderFailed is the Reason for requests that were rejected because a decider failed, rather than decided to reject them.
+	ReasonDeciderFailed = "decider_failed"
+)
+
+const (
+	// HeaderBouncer is the header that rejections carry the name of the bouncer that rejected the request in.
+	HeaderBouncer = "X-Bouncer-Name"
+	// HeaderDecider is the header that rejections carry the name of the decider that rejected the request in.
+	HeaderDecider = "X-Bouncer-Decider"
+	// HeaderReason is the header that rejections carry their Reason in.
+	HeaderReason = "X-Bouncer-Reason"
+)
+
 // HTTPError represents an error, coupled with an HTTP Status Code.
 type HTTPError struct {
 	Status int
 	Err    string
+
+	// Reason is a short, machine readable code for why the request was rejected, e.g. "missing_ticket".
+	Reason string
+
+	// Headers are extra headers to send back to the client with the error.
+	Headers http.Header
+
+	// Bouncer and Decider are the names of the bouncer and decider that rejected the request. They are filled in by the Bouncer.
+	Bouncer string
+	Decider string
+
+	// Violations are the individual rejections that this error aggregates, when bouncers evaluate every decider rather than stopping at the first rejection.
+	Violations []*HTTPError
 }
 
-// ToResponse converts the given HTTPError into an HTTP Response, which can be sent back to a client.
+// ReasonCode returns the Reason of the error, or ReasonRejected if it doesn't have one.
+func (h *HTTPError) ReasonCode() string {
+	if h.Reason == "" {
+		return ReasonRejected
+	}
+
+	return h.Reason
+}
+
+// ToResponse converts the given HTTPError into a plain text HTTP Response, which can be sent back to a client.
 func (h *HTTPError) ToResponse() *http.Response {
+	return h.NewResponse("text/plain; charset=utf-8", []byte(h.Err))
+}
+
+// NewResponse converts the given HTTPError into an HTTP Response with the given body, which can be sent back to a client.
+// The response carries the errors Headers, and headers describing who rejected the request and why.
+func (h *HTTPError) NewResponse(contentType string, body []byte) *http.Response {
+	header := h.Headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	header.Set("Content-Type", contentType)
+	header.Set(HeaderReason, h.ReasonCode())
+	if h.Bouncer != "" {
+		header.Set(HeaderBouncer, h.Bouncer)
+	}
+
+	if h.Decider != "" {
+		header.Set(HeaderDecider, h.Decider)
+	}
+
 	return &http.Response{
-		StatusCode: h.Status,
-		Body:       io.NopCloser(strings.NewReader(h.Err)),
+		Status:        fmt.Sprintf("%d %s", h.Status, http.StatusText(h.Status)),
+		StatusCode:    h.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
 	}
 }
 
@@ -0,0 +1,55 @@
+package mirror
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxPendingAge is how long a request can wait to be accepted before we assume it was rejected. Requests are accepted or
+// rejected within a single round trip to the backend, so this only needs to outlast the slowest backend.
+const maxPendingAge = 5 * time.Minute
+
+type pendingRequest struct {
+	request mirrorRequest
+	added   time.Time
+}
+
+// pendingRequests holds copies of requests that will be mirrored once they have been accepted.
+type pendingRequests struct {
+	lock    sync.Mutex
+	pending map[*http.Request]pendingRequest
+}
+
+func newPendingRequests() *pendingRequests {
+	return &pendingRequests{
+		pending: make(map[*http.Request]pendingRequest),
+	}
+}
+
+func (p *pendingRequests) add(req *http.Request, request mirrorRequest) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// Rejected requests never get taken, so clean them up as we go.
+	now := time.Now()
+	for key, pending := range p.pending {
+		if now.Sub(pending.added) > maxPendingAge {
+			delete(p.pending, key)
+		}
+	}
+
+	p.pending[req] = pendingRequest{
+		request: request,
+		added:   now,
+	}
+}
+
+func (p *pendingRequests) take(req *http.Request) (mirrorRequest, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	pending, ok := p.pending[req]
+	delete(p.pending, req)
+	return pending.request, ok
+}
@@ -0,0 +1,23 @@
+package mirror
+
+import "github.com/prometheus/client_golang/prometheus"
+
+func MirrorFailures(destination string) prometheus.Collector {
+	return failuresTotal.WithLabelValues(destination)
+}
+
+func MirrorDropped(destination string) prometheus.Collector {
+	return droppedTotal.WithLabelValues(destination)
+}
+
+func ShadowComparisons(destination string) prometheus.Collector {
+	return shadowComparisonsTotal.WithLabelValues(destination)
+}
+
+func ShadowMismatches(destination, reason string) prometheus.Collector {
+	return shadowMismatchesTotal.WithLabelValues(destination, reason)
+}
+
+func MirrorTotal(destination string) prometheus.Collector {
+	return mirroredTotal.WithLabelValues(destination)
+}
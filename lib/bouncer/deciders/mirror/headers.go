@@ -0,0 +1,30 @@
+package mirror
+
+import "net/http"
+
+// HeaderRules rewrite the headers of mirrored requests, e.g. to strip credentials, or identify requests as being mirrored.
+// Rules are applied in the order remove, set, add.
+type HeaderRules struct {
+	// Remove are headers that are deleted from mirrored requests.
+	Remove []string `mapstructure:"remove"`
+
+	// Set are headers that override any existing values.
+	Set map[string]string `mapstructure:"set"`
+
+	// Add are headers that are appended to any existing values.
+	Add map[string]string `mapstructure:"add"`
+}
+
+func (h HeaderRules) apply(header http.Header) {
+	for _, name := range h.Remove {
+		header.Del(name)
+	}
+
+	for name, value := range h.Set {
+		header.Set(name, value)
+	}
+
+	for name, value := range h.Add {
+		header.Add(name, value)
+	}
+}
@@ -1,60 +1,417 @@
 package mirror
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
+	"sync"
+	"time"
 
-	"github.com/mitchellh/mapstructure"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
 )
 
-// MirrorDecider is a Decider which mirrors requests that it receives to an alternate location. This can be used for e.g. to spin up testing
-// alertmanagers which receive everything a production one does.
+const (
+	defaultTimeout      = 5 * time.Second
+	defaultQueueSize    = 100
+	defaultWorkers      = 4
+	defaultRetries      = 2
+	defaultRetryBackoff = 100 * time.Millisecond
+)
+
+var (
+	_ = deciders.ResponseObserver(&MirrorDecider{})
+	_ = deciders.Hook(&MirrorDecider{})
+)
+
+var (
+	queueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "alertmanager_bouncer_mirror_queue_depth",
+		Help: "The number of requests waiting to be mirrored",
+	}, []string{"destination"})
+	mirroredTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alertmanager_bouncer_mirror_requests_total",
+		Help: "The number of requests that have been successfully mirrored",
+	}, []string{"destination"})
+	droppedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alertmanager_bouncer_mirror_dropped_total",
+		Help: "The number of requests that weren't mirrored because the queue was full",
+	}, []string{"destination"})
+	failuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alertmanager_bouncer_mirror_failures_total",
+		Help: "The number of requests that failed to be mirrored after exhausting all their retries",
+	}, []string{"destination"})
+)
+
+// MirrorDecider is a Decider which mirrors requests that it receives to alternate locations. This can be used for e.g. to spin up testing
+// alertmanagers which receive everything a production one does. Requests are mirrored in the background by a pool of workers
+// for each destination, so a slow or broken mirror never affects the real request.
 type MirrorDecider struct {
-	Destination string `mapstructure:"destination"`
+	// Destination is a single destination to mirror every request to. It can be used alongside, or instead of, Destinations.
+	Destination  string        `mapstructure:"destination"`
+	Destinations []Destination `mapstructure:"destinations"`
+
+	// Headers are rewrites applied to the requests sent to every destination.
+	Headers HeaderRules `mapstructure:"headers"`
+
+	// OnlyAccepted delays mirroring until the request has been accepted by every bouncer, and forwarded to the backend.
+	OnlyAccepted bool `mapstructure:"onlyAccepted"`
+
+	Timeout      time.Duration `mapstructure:"timeout"`
+	QueueSize    int           `mapstructure:"queueSize"`
+	Workers      int           `mapstructure:"workers"`
+	Retries      *int          `mapstructure:"retries"`
+	RetryBackoff time.Duration `mapstructure:"retryBackoff"`
+	Shadow       ShadowConfig  `mapstructure:"shadow"`
+
+	client       *http.Client
+	destinations []*destination
+	pending      *pendingResponses
+	accepting    *pendingRequests
+	stop         chan struct{}
+	wg           sync.WaitGroup
+	once         sync.Once
+}
+
+// Destination is somewhere that requests get mirrored to.
+type Destination struct {
+	URL string `mapstructure:"url"`
+
+	// SamplePercent is the percentage of requests that get mirrored to this destination. Defaults to 100.
+	SamplePercent *float64 `mapstructure:"samplePercent"`
+
+	// Timeout overrides the timeout of requests to this destination.
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// Headers are rewrites applied to requests sent to this destination, after the global ones.
+	Headers HeaderRules `mapstructure:"headers"`
+}
+
+// destination is a Destination, along with the queue of requests waiting to be sent to it.
+type destination struct {
+	Destination
+	queue chan mirrorRequest
+}
+
+// mirrorRequest is a copy of a request that is waiting to be mirrored.
+type mirrorRequest struct {
+	method string
+	uri    string
+	header http.Header
+	body   []byte
+
+	// In shadow mode, the request that was mirrored, and the channel that its response from the primary backend is sent on.
+	original *http.Request
+	primary  chan response
+}
+
+func newMirrorRequest(req *http.Request, body []byte) mirrorRequest {
+	uri := req.RequestURI
+	if uri == "" {
+		uri = req.URL.RequestURI()
+	}
+
+	return mirrorRequest{
+		method: req.Method,
+		uri:    uri,
+		header: req.Header.Clone(),
+		body:   body,
+	}
 }
 
 func New(config map[string]interface{}) (deciders.Decider, error) {
 	var decider MirrorDecider
-	err := mapstructure.Decode(config, &decider)
-	if err != nil {
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
 		return nil, err
 	}
 
+	if decider.Destination != "" {
+		decider.Destinations = append([]Destination{{URL: decider.Destination}}, decider.Destinations...)
+	}
+
+	if len(decider.Destinations) == 0 {
+		return nil, fmt.Errorf("at least one of destination or destinations must be set")
+	}
+
+	if decider.Timeout == 0 {
+		decider.Timeout = defaultTimeout
+	}
+
+	if decider.QueueSize <= 0 {
+		decider.QueueSize = defaultQueueSize
+	}
+
+	if decider.Workers <= 0 {
+		decider.Workers = defaultWorkers
+	}
+
+	if decider.Retries == nil {
+		retries := defaultRetries
+		decider.Retries = &retries
+	}
+
+	if decider.RetryBackoff == 0 {
+		decider.RetryBackoff = defaultRetryBackoff
+	}
+
+	if decider.Shadow.Wait == 0 {
+		decider.Shadow.Wait = defaultShadowWait
+	}
+
+	decider.client = &http.Client{}
+	decider.pending = newPendingResponses()
+	decider.accepting = newPendingRequests()
+	decider.stop = make(chan struct{})
+
+	for _, config := range decider.Destinations {
+		if config.URL == "" {
+			decider.Close()
+			return nil, fmt.Errorf("destinations must have a url")
+		}
+
+		if config.SamplePercent == nil {
+			samplePercent := 100.0
+			config.SamplePercent = &samplePercent
+		} else if *config.SamplePercent < 0 || *config.SamplePercent > 100 {
+			decider.Close()
+			return nil, fmt.Errorf("samplePercent of %s must be between 0 and 100", config.URL)
+		}
+
+		if config.Timeout == 0 {
+			config.Timeout = decider.Timeout
+		}
+
+		dest := &destination{
+			Destination: config,
+			queue:       make(chan mirrorRequest, decider.QueueSize),
+		}
+
+		decider.destinations = append(decider.destinations, dest)
+		for i := 0; i < decider.Workers; i++ {
+			decider.wg.Add(1)
+			go decider.work(dest)
+		}
+	}
+
 	return &decider, nil
 }
 
-// Decide implements deciders.Decider.
+// NewHook creates a MirrorDecider to be used as a Hook, e.g. to only mirror requests that were accepted.
+func NewHook(config map[string]interface{}) (deciders.Hook, error) {
+	decider, err := New(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return decider.(*MirrorDecider), nil
+}
+
+// Run implements deciders.Hook. It queues the request to be mirrored, comparing the mirrors response with the backends
+// response in shadow mode, if there is one. Dry run rejections are ignored.
+func (m *MirrorDecider) Run(event *deciders.Event) {
+	// Requests that would have been rejected in dry run mode carry on, and will be seen again by onAccepted hooks.
+	if event.DryRun {
+		return
+	}
+
+	request := newMirrorRequest(event.Request, event.Body)
+
+	var primary *response
+	if event.Response != nil {
+		primary = &response{
+			status: event.Response.StatusCode,
+			body:   event.ResponseBody,
+		}
+	} else if m.Shadow.Enabled {
+		log.Debug().Msgf("No backend response to %s %s to compare against, not mirroring it in shadow mode", request.method, request.uri)
+		return
+	}
+
+	m.dispatch(event.Request, request, primary)
+}
+
+// Decide implements deciders.Decider. It queues the request to be mirrored, and never rejects it.
 func (m *MirrorDecider) Decide(req *http.Request) *deciders.HTTPError {
-	url := m.Destination + req.RequestURI
-	request, err := http.NewRequest(
-		req.Method,
-		url,
-		req.Body,
-	)
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to read body of request to mirror")
+			return nil
+		}
+	}
 
-	if err != nil {
-		return &deciders.HTTPError{
-			Status: http.StatusInternalServerError,
-			Err:    fmt.Sprintf("failed to create request to %s: %s", url, err),
+	request := newMirrorRequest(req, body)
+
+	if m.OnlyAccepted {
+		m.accepting.add(req, request)
+		return nil
+	}
+
+	m.dispatch(req, request, nil)
+	return nil
+}
+
+// ObserveResponse implements deciders.ResponseObserver. The request has been accepted, so in onlyAccepted mode it can now be mirrored,
+// and in shadow mode the primary response can be compared with the mirrors.
+func (m *MirrorDecider) ObserveResponse(req *http.Request, resp *http.Response, body []byte) {
+	primary := response{
+		status: resp.StatusCode,
+		body:   body,
+	}
+
+	if m.OnlyAccepted {
+		if request, ok := m.accepting.take(req); ok {
+			m.dispatch(req, request, &primary)
 		}
+
+		return
 	}
 
-	for name, values := range req.Header {
-		for _, value := range values {
-			request.Header.Add(name, value)
+	if m.Shadow.Enabled {
+		m.pending.resolve(req, primary)
+	}
+}
+
+// dispatch queues a copy of the given request for every destination that samples it. If the primary response is already known,
+// it is passed along for shadow mode. Otherwise, shadow mode waits for it to be passed to ObserveResponse.
+func (m *MirrorDecider) dispatch(req *http.Request, request mirrorRequest, primary *response) {
+	for _, dest := range m.destinations {
+		if *dest.SamplePercent < 100 && rand.Float64()*100 >= *dest.SamplePercent { //nolint:gosec // Sampling doesn't need a secure random source.
+			continue
+		}
+
+		destRequest := request
+		destRequest.header = request.header.Clone()
+		m.Headers.apply(destRequest.header)
+		dest.Headers.apply(destRequest.header)
+
+		if m.Shadow.Enabled {
+			destRequest.original = req
+			if primary != nil {
+				destRequest.primary = make(chan response, 1)
+				destRequest.primary <- *primary
+			} else {
+				destRequest.primary = m.pending.add(req)
+			}
+		}
+
+		select {
+		case dest.queue <- destRequest:
+			queueDepth.WithLabelValues(dest.URL).Set(float64(len(dest.queue)))
+		default:
+			if destRequest.primary != nil {
+				m.pending.remove(req, destRequest.primary)
+			}
+			droppedTotal.WithLabelValues(dest.URL).Inc()
+			log.Debug().Str("destination", dest.URL).Msgf("Mirror queue is full, dropping %s %s", request.method, request.uri)
+		}
+	}
+}
+
+func (m *MirrorDecider) work(dest *destination) {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case request := <-dest.queue:
+			queueDepth.WithLabelValues(dest.URL).Set(float64(len(dest.queue)))
+			mirrored, err := m.mirror(dest, request)
+			if err != nil {
+				failuresTotal.WithLabelValues(dest.URL).Inc()
+				log.Warn().Str("destination", dest.URL).Err(err).Msgf("Failed to mirror %s %s", request.method, request.uri)
+				if request.primary != nil {
+					m.pending.remove(request.original, request.primary)
+				}
+				continue
+			}
+
+			mirroredTotal.WithLabelValues(dest.URL).Inc()
+			if request.primary != nil {
+				// The primary response may take a while, so wait for it without holding up the worker.
+				m.wg.Add(1)
+				go func(request mirrorRequest) {
+					defer m.wg.Done()
+					m.compareWithPrimary(dest, request, mirrored)
+				}(request)
+			}
 		}
 	}
+}
 
-	resp, err := http.DefaultClient.Do(request)
+// mirror sends the given request to the destination, retrying with an exponential backoff if it can't be sent. Any response
+// from the destination, including server errors, is returned without retrying.
+func (m *MirrorDecider) mirror(dest *destination, request mirrorRequest) (response, error) {
+	backoff := m.RetryBackoff
+	var resp response
+	var err error
+	for attempt := 0; attempt <= *m.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-m.stop:
+				return response{}, err
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		if resp, err = m.send(dest, request); err == nil {
+			return resp, nil
+		}
+	}
+
+	return response{}, err
+}
+
+func (m *MirrorDecider) send(dest *destination, request mirrorRequest) (response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dest.Timeout)
+	defer cancel()
+
+	url := dest.URL + request.uri
+	req, err := http.NewRequestWithContext(ctx, request.method, url, bytes.NewReader(request.body))
 	if err != nil {
-		return &deciders.HTTPError{
-			Status: http.StatusBadGateway,
-			Err:    fmt.Sprintf("failed to mirror request to %s: %s", url, err),
+		return response{}, fmt.Errorf("failed to create request to %s: %s", url, err)
+	}
+
+	req.Header = request.header
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return response{}, fmt.Errorf("failed to mirror request to %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	var body []byte
+	if m.Shadow.Enabled {
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return response{}, fmt.Errorf("failed to read response from %s: %s", url, err)
 		}
+	} else {
+		io.Copy(io.Discard, resp.Body)
 	}
 
-	resp.Body.Close()
+	// Server errors from the mirror aren't retried: the mirror may have acted on the request anyway, and resending a silence
+	// could create it twice. They're passed on to shadow mode instead, where they're usually exactly what it's looking for.
+	if resp.StatusCode >= 500 {
+		log.Debug().Str("destination", dest.URL).Msgf("Mirror returned status %d for %s %s", resp.StatusCode, request.method, request.uri)
+	}
+
+	return response{status: resp.StatusCode, body: body}, nil
+}
 
+// Close stops the workers. Requests that are still queued are dropped.
+func (m *MirrorDecider) Close() error {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+	m.wg.Wait()
 	return nil
 }
@@ -3,9 +3,11 @@ package mirror_test
 import (
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/mirror"
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
 	"github.com/stretchr/testify/require"
@@ -25,6 +27,7 @@ func TestMirrorDecider(t *testing.T) {
 
 	decider, err := mirror.New(map[string]interface{}{"destination": backend.URL})
 	require.NoError(t, err)
+	defer decider.(*mirror.MirrorDecider).Close()
 	require.Nil(t, decider.Decide(testutil.MustMakeRequest(t, http.MethodGet, "/api/v1/silences", "")))
 
 	select {
@@ -33,3 +36,260 @@ func TestMirrorDecider(t *testing.T) {
 		require.FailNow(t, "Expected request to be mirrored to the backend, but it wasn't")
 	}
 }
+
+func TestMirrorDeciderDoesntRejectWhenDestinationIsDown(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	backend.Close()
+
+	decider, err := mirror.New(map[string]interface{}{"destination": backend.URL, "retries": 0})
+	require.NoError(t, err)
+	defer decider.(*mirror.MirrorDecider).Close()
+
+	require.Nil(t, decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", "{}")))
+	require.Eventually(t, func() bool {
+		return promtestutil.ToFloat64(mirror.MirrorFailures(backend.URL)) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMirrorDeciderRetries(t *testing.T) {
+	var lock sync.Mutex
+	calls := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		calls++
+		if calls < 3 {
+			// Hang up without responding, so the request fails to send.
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			conn.Close()
+		}
+	}))
+	defer backend.Close()
+
+	decider, err := mirror.New(map[string]interface{}{"destination": backend.URL, "retries": 2, "retryBackoff": "1ms"})
+	require.NoError(t, err)
+	defer decider.(*mirror.MirrorDecider).Close()
+
+	require.Nil(t, decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", "{}")))
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return calls == 3
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMirrorDeciderDoesntRetryServerErrors(t *testing.T) {
+	calls := make(chan struct{}, 3)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls <- struct{}{}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	decider, err := mirror.New(map[string]interface{}{"destination": backend.URL, "retries": 2, "retryBackoff": "1ms"})
+	require.NoError(t, err)
+
+	require.Nil(t, decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", "{}")))
+	<-calls
+	require.Eventually(t, func() bool {
+		return promtestutil.ToFloat64(mirror.MirrorTotal(backend.URL)) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Wait for the worker to finish, so that any retry would have been sent.
+	decider.(*mirror.MirrorDecider).Close()
+	require.Len(t, calls, 0, "Expected server errors not to be retried, in case the mirror created the silence anyway")
+}
+
+func TestMirrorDeciderDropsOnOverflow(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	decider, err := mirror.New(map[string]interface{}{"destination": backend.URL, "workers": 1, "queueSize": 1})
+	require.NoError(t, err)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		require.Nil(t, decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", "{}")))
+	}
+
+	require.Less(t, time.Since(start), time.Second, "Expected mirroring not to block the request")
+
+	// One request is in flight, one is queued, and the rest are dropped, although the in flight one may not
+	// have been picked up by the worker yet.
+	require.Eventually(t, func() bool {
+		return promtestutil.ToFloat64(mirror.MirrorDropped(backend.URL)) >= 3
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMirrorDeciderShadowMode(t *testing.T) {
+	testCases := []struct {
+		name             string
+		primaryStatus    int
+		primaryBody      string
+		mirrorStatus     int
+		mirrorBody       string
+		expectedMismatch string
+	}{
+		{
+			name:          "Ignored Fields Match",
+			primaryStatus: http.StatusOK,
+			primaryBody:   `{"silenceID": "a"}`,
+			mirrorBody:    `{"silenceID": "b"}`,
+		},
+		{
+			name:             "Different Bodies Mismatch",
+			primaryStatus:    http.StatusOK,
+			primaryBody:      `{"silenceID": "a", "status": "active"}`,
+			mirrorBody:       `{"silenceID": "b", "status": "expired"}`,
+			expectedMismatch: "body",
+		},
+		{
+			name:             "Different Statuses Mismatch",
+			primaryStatus:    http.StatusBadRequest,
+			primaryBody:      `{"silenceID": "a"}`,
+			mirrorBody:       `{"silenceID": "a"}`,
+			expectedMismatch: "status",
+		},
+		{
+			name:             "Mirror Server Errors Mismatch",
+			primaryStatus:    http.StatusOK,
+			primaryBody:      `{"silenceID": "a"}`,
+			mirrorStatus:     http.StatusInternalServerError,
+			mirrorBody:       `{"silenceID": "a"}`,
+			expectedMismatch: "status",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.mirrorStatus != 0 {
+					w.WriteHeader(tt.mirrorStatus)
+				}
+
+				w.Write([]byte(tt.mirrorBody))
+			}))
+			defer backend.Close()
+
+			decider, err := mirror.New(map[string]interface{}{
+				"destination": backend.URL,
+				"shadow": map[string]interface{}{
+					"enabled":      true,
+					"ignoreFields": []interface{}{"silenceID"},
+				},
+			})
+			require.NoError(t, err)
+			defer decider.(*mirror.MirrorDecider).Close()
+
+			request := testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", "{}")
+			require.Nil(t, decider.Decide(request))
+			decider.(*mirror.MirrorDecider).ObserveResponse(request, &http.Response{StatusCode: tt.primaryStatus}, []byte(tt.primaryBody))
+
+			require.Eventually(t, func() bool {
+				return promtestutil.ToFloat64(mirror.ShadowComparisons(backend.URL)) == 1
+			}, time.Second, 10*time.Millisecond)
+
+			for _, reason := range []string{"status", "body"} {
+				expected := 0.0
+				if reason == tt.expectedMismatch {
+					expected = 1
+				}
+
+				require.Equal(t, expected, promtestutil.ToFloat64(mirror.ShadowMismatches(backend.URL, reason)), "Unexpected %s mismatches", reason)
+			}
+		})
+	}
+}
+
+func TestMirrorDeciderMultipleDestinations(t *testing.T) {
+	headers := make(chan http.Header, 2)
+	sampled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+	}))
+	defer sampled.Close()
+
+	unsampled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.FailNow(t, "Expected a destination with a samplePercent of 0 not to get any requests")
+	}))
+	defer unsampled.Close()
+
+	decider, err := mirror.New(map[string]interface{}{
+		"destinations": []interface{}{
+			map[string]interface{}{
+				"url": sampled.URL,
+				"headers": map[string]interface{}{
+					"add": map[string]interface{}{"X-Destination": "sampled"},
+				},
+			},
+			map[string]interface{}{"url": unsampled.URL, "samplePercent": 0},
+		},
+		"headers": map[string]interface{}{
+			"remove": []interface{}{"Authorization"},
+			"set":    map[string]interface{}{"X-Mirrored-By": "alertmanager-bouncer"},
+		},
+	})
+	require.NoError(t, err)
+	defer decider.(*mirror.MirrorDecider).Close()
+
+	request := testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", "{}")
+	request.Header = http.Header{}
+	request.Header.Set("Authorization", "Bearer secret")
+	request.Header.Set("X-Mirrored-By", "someone else")
+	require.Nil(t, decider.Decide(request))
+
+	select {
+	case header := <-headers:
+		require.Empty(t, header.Get("Authorization"))
+		require.Equal(t, "alertmanager-bouncer", header.Get("X-Mirrored-By"))
+		require.Equal(t, "sampled", header.Get("X-Destination"))
+	case <-time.After(500 * time.Millisecond):
+		require.FailNow(t, "Expected request to be mirrored to the backend, but it wasn't")
+	}
+
+	require.Equal(t, "Bearer secret", request.Header.Get("Authorization"), "Expected the original request not to be modified")
+}
+
+func TestMirrorDeciderOnlyAccepted(t *testing.T) {
+	recChan := make(chan string, 2)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recChan <- r.URL.Path
+	}))
+	defer backend.Close()
+
+	decider, err := mirror.New(map[string]interface{}{"destination": backend.URL, "onlyAccepted": true})
+	require.NoError(t, err)
+	defer decider.(*mirror.MirrorDecider).Close()
+
+	rejected := testutil.MustMakeRequest(t, http.MethodPost, "/rejected", "{}")
+	require.Nil(t, decider.Decide(rejected))
+
+	accepted := testutil.MustMakeRequest(t, http.MethodPost, "/accepted", "{}")
+	require.Nil(t, decider.Decide(accepted))
+	decider.(*mirror.MirrorDecider).ObserveResponse(accepted, &http.Response{StatusCode: http.StatusOK}, nil)
+
+	select {
+	case path := <-recChan:
+		require.Equal(t, "/accepted", path)
+	case <-time.After(500 * time.Millisecond):
+		require.FailNow(t, "Expected the accepted request to be mirrored, but it wasn't")
+	}
+
+	select {
+	case path := <-recChan:
+		require.FailNow(t, "Expected only the accepted request to be mirrored", "got %s", path)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMirrorDeciderConfigValidation(t *testing.T) {
+	_, err := mirror.New(map[string]interface{}{})
+	require.Error(t, err)
+
+	_, err = mirror.New(map[string]interface{}{"destinations": []interface{}{map[string]interface{}{"url": "http://localhost", "samplePercent": 101}}})
+	require.Error(t, err)
+}
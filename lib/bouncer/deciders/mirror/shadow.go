@@ -0,0 +1,173 @@
+package mirror
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+const defaultShadowWait = 10 * time.Second
+
+var (
+	shadowComparisonsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alertmanager_bouncer_mirror_shadow_comparisons_total",
+		Help: "The number of mirrored responses that have been compared against the primary response",
+	}, []string{"destination"})
+	shadowMismatchesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alertmanager_bouncer_mirror_shadow_mismatches_total",
+		Help: "The number of mirrored responses that differed from the primary response, by what differed",
+	}, []string{"destination", "reason"})
+)
+
+// ShadowConfig configures comparing the responses of the mirror against the responses of the primary backend.
+type ShadowConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// IgnoreFields are JSON object keys that are removed (at any depth) from both responses before they are compared, e.g. silenceID.
+	IgnoreFields []string `mapstructure:"ignoreFields"`
+
+	// Wait is how long to wait for the primary response after the mirror has responded. Requests that get rejected
+	// by another decider never get a primary response, and are dropped after this.
+	Wait time.Duration `mapstructure:"wait"`
+}
+
+// response is a captured response from either the primary backend, or the mirror.
+type response struct {
+	status int
+	body   []byte
+}
+
+// pendingResponses matches responses from the primary backend up with the mirrored requests waiting for them.
+type pendingResponses struct {
+	lock    sync.Mutex
+	pending map[*http.Request][]chan response
+}
+
+func newPendingResponses() *pendingResponses {
+	return &pendingResponses{
+		pending: make(map[*http.Request][]chan response),
+	}
+}
+
+func (p *pendingResponses) add(req *http.Request) chan response {
+	ch := make(chan response, 1)
+	p.lock.Lock()
+	p.pending[req] = append(p.pending[req], ch)
+	p.lock.Unlock()
+	return ch
+}
+
+func (p *pendingResponses) remove(req *http.Request, ch chan response) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	waiting := p.pending[req]
+	for i := range waiting {
+		if waiting[i] == ch {
+			waiting = append(waiting[:i], waiting[i+1:]...)
+			break
+		}
+	}
+
+	if len(waiting) == 0 {
+		delete(p.pending, req)
+	} else {
+		p.pending[req] = waiting
+	}
+}
+
+func (p *pendingResponses) resolve(req *http.Request, resp response) {
+	p.lock.Lock()
+	waiting := p.pending[req]
+	delete(p.pending, req)
+	p.lock.Unlock()
+
+	for _, ch := range waiting {
+		ch <- resp
+	}
+}
+
+// compareWithPrimary waits for the primary response to the given request, and records any differences between it and the mirrors response.
+func (m *MirrorDecider) compareWithPrimary(dest *destination, request mirrorRequest, mirrored response) {
+	defer m.pending.remove(request.original, request.primary)
+
+	var primary response
+	select {
+	case primary = <-request.primary:
+	case <-time.After(m.Shadow.Wait):
+		log.Debug().Str("destination", dest.URL).Msgf("No primary response to %s %s, not comparing", request.method, request.uri)
+		return
+	case <-m.stop:
+		return
+	}
+
+	shadowComparisonsTotal.WithLabelValues(dest.URL).Inc()
+	if primary.status != mirrored.status {
+		shadowMismatchesTotal.WithLabelValues(dest.URL, "status").Inc()
+		log.Warn().
+			Str("destination", dest.URL).
+			Int("primary_status", primary.status).
+			Int("mirror_status", mirrored.status).
+			Msgf("Mirror responded to %s %s with a different status", request.method, request.uri)
+		return
+	}
+
+	if diff := m.diffBodies(primary.body, mirrored.body); diff != "" {
+		shadowMismatchesTotal.WithLabelValues(dest.URL, "body").Inc()
+		log.Warn().
+			Str("destination", dest.URL).
+			Str("diff", diff).
+			Msgf("Mirror responded to %s %s with a different body", request.method, request.uri)
+	}
+}
+
+// diffBodies compares the given bodies, returning a description of how they differ, or an empty string if they're the same.
+// JSON bodies are compared semantically, ignoring the configured fields.
+func (m *MirrorDecider) diffBodies(primary, mirrored []byte) string {
+	var primaryJSON, mirroredJSON interface{}
+	if json.Unmarshal(primary, &primaryJSON) != nil || json.Unmarshal(mirrored, &mirroredJSON) != nil {
+		if bytes.Equal(bytes.TrimSpace(primary), bytes.TrimSpace(mirrored)) {
+			return ""
+		}
+
+		return fmt.Sprintf("primary: %q, mirror: %q", primary, mirrored)
+	}
+
+	primaryJSON = stripFields(primaryJSON, m.Shadow.IgnoreFields)
+	mirroredJSON = stripFields(mirroredJSON, m.Shadow.IgnoreFields)
+	if reflect.DeepEqual(primaryJSON, mirroredJSON) {
+		return ""
+	}
+
+	normalizedPrimary, _ := json.Marshal(primaryJSON)
+	normalizedMirrored, _ := json.Marshal(mirroredJSON)
+	return fmt.Sprintf("primary: %s, mirror: %s", normalizedPrimary, normalizedMirrored)
+}
+
+// stripFields removes the given keys from every object in the given decoded JSON value.
+func stripFields(value interface{}, fields []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, field := range fields {
+			delete(v, field)
+		}
+
+		for key, child := range v {
+			v[key] = stripFields(child, fields)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = stripFields(child, fields)
+		}
+	}
+
+	return value
+}
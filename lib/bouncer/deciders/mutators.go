@@ -0,0 +1,27 @@
+package deciders
+
+import "net/http"
+
+// Mutator rewrites the body of a request before any deciders see it, e.g. to fill in fields that clients left out of silences.
+// Mutators run in the order that they're configured, and the backend gets the body from the last one.
+type Mutator interface {
+	// Mutate returns the new body for the given request. The requests Body has already been read into body, so Mutators should
+	// use that instead. Returning an error rejects the request.
+	Mutate(req *http.Request, body []byte) ([]byte, *HTTPError)
+}
+
+type MutatorFunc func(req *http.Request, body []byte) ([]byte, *HTTPError)
+
+func (m MutatorFunc) Mutate(req *http.Request, body []byte) ([]byte, *HTTPError) {
+	return m(req, body)
+}
+
+type MutatorTemplate interface {
+	Make(map[string]interface{}) (Mutator, error)
+}
+
+type MutatorTemplateFunc func(map[string]interface{}) (Mutator, error)
+
+func (m MutatorTemplateFunc) Make(config map[string]interface{}) (Mutator, error) {
+	return m(config)
+}
@@ -0,0 +1,7 @@
+package notify
+
+import "github.com/prometheus/client_golang/prometheus"
+
+func Notifications(notifierType, result string) prometheus.Collector {
+	return notificationsTotal.WithLabelValues(notifierType, result)
+}
@@ -0,0 +1,355 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+const (
+	// TypeWebhook POSTs a JSON encoded Payload to a URL.
+	TypeWebhook = "webhook"
+	// TypeSlack POSTs the message to a Slack compatible incoming webhook.
+	TypeSlack = "slack"
+	// TypeEmail sends the message as an email through an SMTP server.
+	TypeEmail = "email"
+
+	defaultTimeout   = 10 * time.Second
+	defaultQueueSize = 100
+
+	defaultTemplate = `{{ if .DryRun }}[dry run] {{ end }}{{ .Bouncer }} rejected {{ len .Events }} request(s) with {{ .Status }}: {{ .Reason }}
+{{ range .Events }}- {{ .Method }} {{ .URI }}{{ with .Silence }} by {{ .CreatedBy }} ({{ .Matchers }}): {{ .Comment }}{{ end }}
+{{ end }}`
+	defaultSubject = `{{ if .DryRun }}[dry run] {{ end }}alertmanager_bouncer: {{ .Bouncer }} rejected {{ len .Events }} request(s)`
+)
+
+var _ = deciders.Hook(&Notify{})
+
+var notificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "alertmanager_bouncer_notifications_total",
+	Help: "The number of rejection notifications, by whether they were sent, failed, dropped because the queue was full, or rate limited",
+}, []string{"type", "result"})
+
+// RateLimit caps the number of notifications that can be sent in a rolling Interval. A Count of zero disables rate limiting.
+type RateLimit struct {
+	Count    int           `mapstructure:"count"`
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// Notify is a Hook which tells people about rejected requests, by sending a templated message to a webhook, Slack, or an email address.
+// Rejections with the same bouncer and reason that happen within GroupInterval of each other are grouped into a single notification,
+// so that a flood of rejections doesn't flood the channel.
+type Notify struct {
+	Type    string            `mapstructure:"type"`
+	URL     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"`
+	SMTP    SMTPConfig        `mapstructure:"smtp"`
+
+	// Template is a text/template that renders a Notification into the message that gets sent. Subject is the same, for the subject of emails.
+	Template string `mapstructure:"template"`
+	Subject  string `mapstructure:"subject"`
+
+	// DryRun controls whether rejections from bouncers in dry run mode are notified about. Defaults to true.
+	DryRun *bool `mapstructure:"dryRun"`
+
+	GroupInterval time.Duration `mapstructure:"groupInterval"`
+	RateLimit     RateLimit     `mapstructure:"rateLimit"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+	QueueSize     int           `mapstructure:"queueSize"`
+
+	sender   sender
+	message  *template.Template
+	subject  *template.Template
+	queue    chan eventInfo
+	groups   map[groupKey]*Notification
+	order    []groupKey
+	sent     []time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// Notification is a group of rejections that get sent together. It is what Template and Subject are rendered with.
+type Notification struct {
+	Bouncer string      `json:"bouncer"`
+	Reason  string      `json:"reason"`
+	Status  int         `json:"status"`
+	DryRun  bool        `json:"dryRun"`
+	Events  []eventInfo `json:"events"`
+}
+
+type eventInfo struct {
+	Method string `json:"method"`
+	URI    string `json:"uri"`
+
+	// Silence is the silence that was rejected, if the request contained one.
+	Silence *types.Silence `json:"silence,omitempty"`
+
+	groupKey
+}
+
+type groupKey struct {
+	bouncer string
+	reason  string
+	status  int
+	dryRun  bool
+}
+
+func New(config map[string]interface{}) (deciders.Hook, error) {
+	var hook Notify
+	if err := deciders.DecodeConfig(config, &hook); err != nil {
+		return nil, err
+	}
+
+	if hook.Timeout == 0 {
+		hook.Timeout = defaultTimeout
+	}
+
+	if hook.QueueSize == 0 {
+		hook.QueueSize = defaultQueueSize
+	}
+
+	if hook.QueueSize < 0 {
+		return nil, fmt.Errorf("queueSize must not be negative")
+	}
+
+	if hook.RateLimit.Count < 0 {
+		return nil, fmt.Errorf("rateLimit.count must not be negative")
+	}
+
+	if hook.RateLimit.Count > 0 && hook.RateLimit.Interval <= 0 {
+		return nil, fmt.Errorf("rateLimit.interval must be set when rateLimit.count is")
+	}
+
+	if hook.DryRun == nil {
+		dryRun := true
+		hook.DryRun = &dryRun
+	}
+
+	if hook.Template == "" {
+		hook.Template = defaultTemplate
+	}
+
+	if hook.Subject == "" {
+		hook.Subject = defaultSubject
+	}
+
+	var err error
+	if hook.message, err = template.New("template").Parse(hook.Template); err != nil {
+		return nil, fmt.Errorf("failed to parse template: %s", err)
+	}
+
+	if hook.subject, err = template.New("subject").Parse(hook.Subject); err != nil {
+		return nil, fmt.Errorf("failed to parse subject: %s", err)
+	}
+
+	if hook.sender, err = hook.makeSender(); err != nil {
+		return nil, err
+	}
+
+	hook.queue = make(chan eventInfo, hook.QueueSize)
+	hook.groups = make(map[groupKey]*Notification)
+	hook.stop = make(chan struct{})
+	hook.wg.Add(1)
+	go hook.run()
+
+	return &hook, nil
+}
+
+func (n *Notify) makeSender() (sender, error) {
+	client := &http.Client{Timeout: n.Timeout}
+	switch n.Type {
+	case TypeWebhook, TypeSlack:
+		if n.URL == "" {
+			return nil, fmt.Errorf("url must be set for %s notifications", n.Type)
+		}
+
+		return &webhookSender{
+			url:     n.URL,
+			headers: n.Headers,
+			client:  client,
+			slack:   n.Type == TypeSlack,
+		}, nil
+	case TypeEmail:
+		if err := n.SMTP.validate(); err != nil {
+			return nil, err
+		}
+
+		return &emailSender{config: n.SMTP, timeout: n.Timeout}, nil
+	default:
+		return nil, fmt.Errorf("type must be one of %q, %q, or %q, got %q", TypeWebhook, TypeSlack, TypeEmail, n.Type)
+	}
+}
+
+// Run implements deciders.Hook. It queues rejections to be notified about, and ignores accepted requests.
+func (n *Notify) Run(event *deciders.Event) {
+	if event.Rejection == nil || (event.DryRun && !*n.DryRun) {
+		return
+	}
+
+	info := eventInfo{
+		Method: event.Request.Method,
+		URI:    event.Request.URL.RequestURI(),
+		groupKey: groupKey{
+			bouncer: event.Bouncer,
+			reason:  event.Rejection.Err,
+			status:  event.Rejection.Status,
+			dryRun:  event.DryRun,
+		},
+	}
+
+	if len(event.Body) > 0 {
+		var silence types.Silence
+		if err := json.Unmarshal(event.Body, &silence); err == nil {
+			info.Silence = &silence
+		}
+	}
+
+	select {
+	case n.queue <- info:
+	default:
+		notificationsTotal.WithLabelValues(n.Type, "dropped").Inc()
+		log.Warn().Msgf("Notification queue is full, dropping notification about %s %s", info.Method, info.URI)
+	}
+}
+
+func (n *Notify) run() {
+	defer n.wg.Done()
+
+	var tick <-chan time.Time
+	if n.GroupInterval > 0 {
+		ticker := time.NewTicker(n.GroupInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case info := <-n.queue:
+			n.add(info)
+			if tick == nil {
+				n.flush()
+			}
+		case <-tick:
+			n.flush()
+		case <-n.stop:
+			// Send anything that is still waiting, so that rejections just before a reload aren't lost.
+			for {
+				select {
+				case info := <-n.queue:
+					n.add(info)
+				default:
+					n.flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (n *Notify) add(info eventInfo) {
+	group, ok := n.groups[info.groupKey]
+	if !ok {
+		group = &Notification{
+			Bouncer: info.bouncer,
+			Reason:  info.reason,
+			Status:  info.status,
+			DryRun:  info.dryRun,
+		}
+
+		n.groups[info.groupKey] = group
+		n.order = append(n.order, info.groupKey)
+	}
+
+	group.Events = append(group.Events, info)
+}
+
+func (n *Notify) flush() {
+	for _, key := range n.order {
+		n.send(n.groups[key])
+		delete(n.groups, key)
+	}
+
+	n.order = n.order[:0]
+}
+
+func (n *Notify) send(notification *Notification) {
+	if !n.allow(time.Now()) {
+		notificationsTotal.WithLabelValues(n.Type, "rate_limited").Inc()
+		log.Warn().Msgf("Rate limited notification about %d rejection(s) from %s", len(notification.Events), notification.Bouncer)
+		return
+	}
+
+	message, err := render(n.message, notification)
+	if err != nil {
+		notificationsTotal.WithLabelValues(n.Type, "failed").Inc()
+		log.Warn().Err(err).Msg("Failed to render notification")
+		return
+	}
+
+	subject, err := render(n.subject, notification)
+	if err != nil {
+		notificationsTotal.WithLabelValues(n.Type, "failed").Inc()
+		log.Warn().Err(err).Msg("Failed to render notification subject")
+		return
+	}
+
+	if err := n.sender.send(subject, message, notification); err != nil {
+		notificationsTotal.WithLabelValues(n.Type, "failed").Inc()
+		log.Warn().Err(err).Msgf("Failed to send %s notification", n.Type)
+		return
+	}
+
+	notificationsTotal.WithLabelValues(n.Type, "sent").Inc()
+}
+
+// allow returns whether another notification can be sent at the given time without going over the RateLimit, recording it if so.
+func (n *Notify) allow(now time.Time) bool {
+	if n.RateLimit.Count == 0 {
+		return true
+	}
+
+	cutoff := now.Add(-n.RateLimit.Interval)
+	recent := n.sent[:0]
+	for _, sent := range n.sent {
+		if sent.After(cutoff) {
+			recent = append(recent, sent)
+		}
+	}
+
+	n.sent = recent
+	if len(n.sent) >= n.RateLimit.Count {
+		return false
+	}
+
+	n.sent = append(n.sent, now)
+	return true
+}
+
+func render(tmpl *template.Template, notification *Notification) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, notification); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// Close stops the Notify from accepting new rejections, and waits for any pending notifications to be sent.
+func (n *Notify) Close() error {
+	n.stopOnce.Do(func() {
+		close(n.stop)
+	})
+	n.wg.Wait()
+	return nil
+}
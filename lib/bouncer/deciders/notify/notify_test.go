@@ -0,0 +1,261 @@
+package notify_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/notify"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const silence = `{"matchers":[{"name":"alertname","value":"Foo","isRegex":false}],"createdBy":"colin","comment":"testing"}`
+
+// recorder is a local stand in for a webhook, recording the bodies that are sent to it.
+type recorder struct {
+	lock   sync.Mutex
+	bodies [][]byte
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.bodies = append(r.bodies, body)
+}
+
+func (r *recorder) received() [][]byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.bodies
+}
+
+func rejection(t *testing.T, bouncer, reason string, dryRun bool) *deciders.Event {
+	t.Helper()
+	return &deciders.Event{
+		Request: testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", silence),
+		Body:    []byte(silence),
+		Rejection: &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    reason,
+		},
+		Bouncer: bouncer,
+		DryRun:  dryRun,
+	}
+}
+
+func makeNotify(t *testing.T, config map[string]interface{}) *notify.Notify {
+	t.Helper()
+	hook, err := notify.New(config)
+	require.NoError(t, err)
+	return hook.(*notify.Notify)
+}
+
+func TestNotifyConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+	}{
+		{
+			name:   "missing type",
+			config: map[string]interface{}{"url": "http://localhost"},
+		},
+		{
+			name:   "missing url",
+			config: map[string]interface{}{"type": "slack"},
+		},
+		{
+			name:   "email without smtp",
+			config: map[string]interface{}{"type": "email"},
+		},
+		{
+			name:   "bad template",
+			config: map[string]interface{}{"type": "webhook", "url": "http://localhost", "template": "{{ .Foo"},
+		},
+		{
+			name:   "rate limit without interval",
+			config: map[string]interface{}{"type": "webhook", "url": "http://localhost", "rateLimit": map[string]interface{}{"count": 1}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := notify.New(test.config)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestNotifyWebhook(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	hook := makeNotify(t, map[string]interface{}{
+		"type":          "webhook",
+		"url":           server.URL,
+		"groupInterval": "1h",
+	})
+
+	// Accepted requests aren't notified about, and rejections with the same bouncer and reason are grouped together.
+	hook.Run(&deciders.Event{Request: testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", silence)})
+	hook.Run(rejection(t, "tickets", "silence has no ticket", false))
+	hook.Run(rejection(t, "tickets", "silence has no ticket", false))
+	hook.Run(rejection(t, "authors", "silence has no author", true))
+	require.NoError(t, hook.Close())
+
+	bodies := rec.received()
+	require.Len(t, bodies, 2)
+
+	var payload notify.Payload
+	require.NoError(t, json.Unmarshal(bodies[0], &payload))
+	require.Equal(t, "tickets", payload.Bouncer)
+	require.Equal(t, "silence has no ticket", payload.Reason)
+	require.False(t, payload.DryRun)
+	require.Len(t, payload.Events, 2)
+	require.Equal(t, "colin", payload.Events[0].Silence.CreatedBy)
+	require.Contains(t, payload.Message, "tickets rejected 2 request(s) with 400: silence has no ticket")
+	require.Contains(t, payload.Message, "by colin")
+
+	require.NoError(t, json.Unmarshal(bodies[1], &payload))
+	require.Equal(t, "authors", payload.Bouncer)
+	require.True(t, payload.DryRun)
+	require.True(t, strings.HasPrefix(payload.Message, "[dry run] "))
+}
+
+func TestNotifySlack(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	hook := makeNotify(t, map[string]interface{}{
+		"type":     "slack",
+		"url":      server.URL,
+		"template": "{{ .Bouncer }}: {{ .Reason }} ({{ (index .Events 0).Silence.CreatedBy }})",
+		"dryRun":   false,
+	})
+
+	hook.Run(rejection(t, "authors", "silence has no author", true))
+	hook.Run(rejection(t, "tickets", "silence has no ticket", false))
+	require.NoError(t, hook.Close())
+
+	bodies := rec.received()
+	require.Len(t, bodies, 1)
+	require.JSONEq(t, `{"text": "tickets: silence has no ticket (colin)"}`, string(bodies[0]))
+}
+
+func TestNotifyRateLimit(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	limited := notify.Notifications(notify.TypeWebhook, "rate_limited")
+	before := promtestutil.ToFloat64(limited)
+
+	hook := makeNotify(t, map[string]interface{}{
+		"type": "webhook",
+		"url":  server.URL,
+		"rateLimit": map[string]interface{}{
+			"count":    1,
+			"interval": "1h",
+		},
+	})
+
+	hook.Run(rejection(t, "tickets", "silence has no ticket", false))
+	hook.Run(rejection(t, "authors", "silence has no author", false))
+	require.NoError(t, hook.Close())
+
+	require.Len(t, rec.received(), 1)
+	require.Equal(t, before+1, promtestutil.ToFloat64(limited))
+}
+
+func TestNotifyEmail(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	messages := make(chan string, 1)
+	go serveSMTP(listener, messages)
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	hook := makeNotify(t, map[string]interface{}{
+		"type": "email",
+		"smtp": map[string]interface{}{
+			"host": "127.0.0.1",
+			"port": port,
+			"from": "bouncer@example.com",
+			"to":   []string{"oncall@example.com"},
+		},
+		"subject": "Rejected by {{ .Bouncer }}",
+	})
+
+	hook.Run(rejection(t, "tickets", "silence has no ticket", false))
+	require.NoError(t, hook.Close())
+
+	message := <-messages
+	require.Contains(t, message, "Subject: Rejected by tickets\r\n")
+	require.Contains(t, message, "To: oncall@example.com\r\n")
+	require.Contains(t, message, "silence has no ticket")
+}
+
+// serveSMTP is a minimal SMTP server that accepts a single message and sends it down the given channel.
+func serveSMTP(listener net.Listener, messages chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(code int, msg string) {
+		_, _ = conn.Write([]byte(strconv.Itoa(code) + " " + msg + "\r\n"))
+	}
+
+	reply(220, "localhost ready")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.Fields(line + " ")[0])
+		switch command {
+		case "EHLO", "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+			reply(250, "OK")
+		case "DATA":
+			reply(354, "go ahead")
+			var message strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+
+				if line == ".\r\n" {
+					break
+				}
+
+				message.WriteString(line)
+			}
+
+			messages <- message.String()
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			reply(500, "unknown command")
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig configures the server that email notifications are sent through.
+type SMTPConfig struct {
+	Host     string   `mapstructure:"host"`
+	Port     int      `mapstructure:"port"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+}
+
+func (s SMTPConfig) validate() error {
+	if s.Host == "" {
+		return fmt.Errorf("smtp.host must be set for email notifications")
+	}
+
+	if s.From == "" {
+		return fmt.Errorf("smtp.from must be set for email notifications")
+	}
+
+	if len(s.To) == 0 {
+		return fmt.Errorf("smtp.to must be set for email notifications")
+	}
+
+	return nil
+}
+
+// Payload is the body that gets sent to generic webhooks.
+type Payload struct {
+	Message string `json:"message"`
+	Notification
+}
+
+type sender interface {
+	send(subject, message string, notification *Notification) error
+}
+
+type webhookSender struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	slack   bool
+}
+
+func (w *webhookSender) send(_, message string, notification *Notification) error {
+	var payload interface{} = Payload{
+		Message:      message,
+		Notification: *notification,
+	}
+
+	if w.slack {
+		payload = map[string]string{"text": message}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range w.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("got status %d from %s", resp.StatusCode, w.url)
+	}
+
+	return nil
+}
+
+type emailSender struct {
+	config  SMTPConfig
+	timeout time.Duration
+}
+
+func (e *emailSender) send(subject, message string, _ *Notification) error {
+	port := e.config.Port
+	if port == 0 {
+		port = 25
+	}
+
+	addr := net.JoinHostPort(e.config.Host, strconv.Itoa(port))
+
+	var auth smtp.Auth
+	if e.config.Username != "" {
+		auth = smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.Host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.config.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", strings.ReplaceAll(strings.TrimSpace(subject), "\n", " "))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(message, "\n", "\r\n"))
+
+	// smtp.SendMail has no timeout, so guard against a hung server holding up the worker forever.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, e.config.From, e.config.To, msg.Bytes())
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(e.timeout):
+		return fmt.Errorf("timed out sending email through %s", addr)
+	}
+}
@@ -0,0 +1,11 @@
+package oncall
+
+import (
+	"time"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+func SetClock(decider deciders.Decider, now func() time.Time) {
+	decider.(*OnlyOnCallOutsideBusinessHours).now = now
+}
@@ -0,0 +1,220 @@
+package oncall
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+const defaultTeamLabel = "team"
+
+var defaultBusinessDays = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday"}
+
+// BusinessHours are when anyone can create silences. Start and End are times of day, like "09:00", in the time zone of the team.
+type BusinessHours struct {
+	Days  []string `mapstructure:"days"`
+	Start string   `mapstructure:"start"`
+	End   string   `mapstructure:"end"`
+}
+
+// Team is the configuration for a single team.
+type Team struct {
+	TimeZone *time.Location `mapstructure:"timeZone"`
+}
+
+// OnlyOnCallOutsideBusinessHours is a Decider which, outside of BusinessHours, only lets whoever is on call for the team
+// being silenced create silences. The team comes from the equality matcher on TeamLabel, and whoever is on call from the Schedules.
+// People are identified by IdentityHeader. Requests without it are rejected, unless TrustCreatedBy is set, in which case the
+// createdBy of the silence is used instead. Anyone can put anyone's name in createdBy, so that's only safe if something else checks it.
+type OnlyOnCallOutsideBusinessHours struct {
+	Schedules      []ScheduleFile  `mapstructure:"schedules"`
+	TeamLabel      string          `mapstructure:"teamLabel"`
+	IdentityHeader string          `mapstructure:"identityHeader"`
+	TrustCreatedBy bool            `mapstructure:"trustCreatedBy"`
+	BusinessHours  BusinessHours   `mapstructure:"businessHours"`
+	TimeZone       *time.Location  `mapstructure:"timeZone"`
+	Teams          map[string]Team `mapstructure:"teams"`
+
+	now      func() time.Time
+	schedule *schedule
+	days     map[time.Weekday]bool
+	start    time.Duration
+	end      time.Duration
+}
+
+func New(config map[string]interface{}) (deciders.Decider, error) {
+	var decider OnlyOnCallOutsideBusinessHours
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
+		return nil, err
+	}
+
+	if len(decider.Schedules) == 0 {
+		return nil, fmt.Errorf("at least one schedule must be set")
+	}
+
+	if decider.TeamLabel == "" {
+		decider.TeamLabel = defaultTeamLabel
+	}
+
+	if decider.TimeZone == nil {
+		decider.TimeZone = time.UTC
+	}
+
+	if err := decider.parseBusinessHours(); err != nil {
+		return nil, err
+	}
+
+	schedule, err := loadSchedule(decider.Schedules)
+	if err != nil {
+		return nil, err
+	}
+
+	decider.schedule = schedule
+	decider.now = time.Now
+	return &decider, nil
+}
+
+func (o *OnlyOnCallOutsideBusinessHours) parseBusinessHours() error {
+	hours := &o.BusinessHours
+	if len(hours.Days) == 0 {
+		hours.Days = defaultBusinessDays
+	}
+
+	if hours.Start == "" {
+		hours.Start = "09:00"
+	}
+
+	if hours.End == "" {
+		hours.End = "17:00"
+	}
+
+	o.days = make(map[time.Weekday]bool, len(hours.Days))
+	for _, day := range hours.Days {
+		weekday, ok := parseWeekday(day)
+		if !ok {
+			return fmt.Errorf("invalid business day %q", day)
+		}
+
+		o.days[weekday] = true
+	}
+
+	var err error
+	if o.start, err = parseTimeOfDay(hours.Start); err != nil {
+		return fmt.Errorf("invalid businessHours.start: %w", err)
+	}
+
+	if o.end, err = parseTimeOfDay(hours.End); err != nil {
+		return fmt.Errorf("invalid businessHours.end: %w", err)
+	}
+
+	if o.end <= o.start {
+		return fmt.Errorf("businessHours.end must be after businessHours.start")
+	}
+
+	return nil
+}
+
+func parseWeekday(day string) (time.Weekday, bool) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(day, weekday.String()) || strings.EqualFold(day, weekday.String()[:3]) {
+			return weekday, true
+		}
+	}
+
+	return 0, false
+}
+
+// parseTimeOfDay parses a time like "09:30" into how long after midnight it is.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Decide implements deciders.Decider.
+func (o *OnlyOnCallOutsideBusinessHours) Decide(req *http.Request) *deciders.HTTPError {
+	silence, err := deciders.ParseSilence(req.Body)
+	if err != nil {
+		return &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    err.Error(),
+			Reason: deciders.ReasonInvalidRequest,
+		}
+	}
+
+	team := ""
+	for _, matcher := range silence.Matchers {
+		if matcher.Name == o.TeamLabel && matcher.Type == labels.MatchEqual {
+			team = matcher.Value
+			break
+		}
+	}
+
+	now := o.now().In(o.timeZone(team))
+	if o.isBusinessHours(now) {
+		return nil
+	}
+
+	if team == "" {
+		return &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    fmt.Sprintf("silences outside of business hours must have a %s matcher, so that we know who is on call", o.TeamLabel),
+			Reason: "missing_team",
+		}
+	}
+
+	identity := deciders.Identity(req, o.IdentityHeader)
+	if identity == "" && o.TrustCreatedBy {
+		identity = silence.CreatedBy
+	}
+
+	if identity == "" {
+		return &deciders.HTTPError{
+			Status: http.StatusForbidden,
+			Err:    fmt.Sprintf("it's outside of business hours for %s, so silences need an identity to check who is on call", team),
+			Reason: "missing_identity",
+		}
+	}
+
+	onCall := o.schedule.onCall(team, now)
+	for _, user := range onCall {
+		if strings.EqualFold(user, identity) {
+			return nil
+		}
+	}
+
+	onCallDescription := "nobody is on call"
+	if len(onCall) > 0 {
+		onCallDescription = strings.Join(onCall, ", ") + " is on call"
+	}
+
+	return &deciders.HTTPError{
+		Status: http.StatusForbidden,
+		Err:    fmt.Sprintf("it's outside of business hours for %s (%s), so only whoever is on call can create silences for it, and %s", team, now.Format("Mon 15:04 MST"), onCallDescription),
+		Reason: "not_on_call",
+	}
+}
+
+func (o *OnlyOnCallOutsideBusinessHours) timeZone(team string) *time.Location {
+	if teamConfig, ok := o.Teams[team]; ok && teamConfig.TimeZone != nil {
+		return teamConfig.TimeZone
+	}
+
+	return o.TimeZone
+}
+
+func (o *OnlyOnCallOutsideBusinessHours) isBusinessHours(t time.Time) bool {
+	if !o.days[t.Weekday()] {
+		return false
+	}
+
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	return sinceMidnight >= o.start && sinceMidnight < o.end
+}
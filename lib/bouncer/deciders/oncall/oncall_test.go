@@ -0,0 +1,196 @@
+package oncall_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/oncall"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const rotations = `teams:
+  infra:
+    rotations:
+      - start: 2020-01-20T00:00:00Z
+        shiftLength: 24h
+        members: [alice, bob, carol]
+    overrides:
+      - user: dave
+        start: 2020-01-22T11:00:00Z
+        end: 2020-01-22T11:30:00Z
+`
+
+const shifts = `team,user,start,end
+storage,erin,2020-01-22T00:00:00Z,2020-01-23T00:00:00Z
+`
+
+const pagerDuty = `{"schedule": {"final_schedule": {"rendered_schedule_entries": [
+  {"start": "2020-01-22T00:00:00Z", "end": "2020-01-23T00:00:00Z", "user": {"summary": "Frank", "email": "frank@example.com"}}
+]}}}`
+
+func writeFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+	return path
+}
+
+func TestOnlyOnCallOutsideBusinessHours(t *testing.T) {
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(oncall.New), map[string]interface{}{
+		"schedules": []map[string]interface{}{
+			{"path": writeFile(t, "rotations.yml", rotations)},
+			{"path": writeFile(t, "shifts.csv", shifts)},
+			{"path": writeFile(t, "network.json", pagerDuty), "team": "network"},
+		},
+		"teams": map[string]interface{}{
+			"infra":   map[string]interface{}{"timeZone": "Pacific/Auckland"},
+			"storage": map[string]interface{}{"timeZone": "Asia/Tokyo"},
+			"network": map[string]interface{}{"timeZone": "America/New_York"},
+		},
+	})
+
+	trusting := testutil.MustMakeDecider(t, deciders.TemplateFunc(oncall.New), map[string]interface{}{
+		"schedules":      []map[string]interface{}{{"path": writeFile(t, "rotations.yml", rotations)}},
+		"teams":          map[string]interface{}{"infra": map[string]interface{}{"timeZone": "Pacific/Auckland"}},
+		"trustCreatedBy": true,
+	})
+
+	// This is Wednesday lunchtime in UTC, but outside of business hours everywhere else.
+	wednesday := time.Date(2020, 1, 22, 12, 0, 0, 0, time.UTC)
+	saturday := time.Date(2020, 1, 25, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name           string
+		now            time.Time
+		team           string
+		identity       string
+		createdBy      string
+		trustCreatedBy bool
+		expectedReason string
+	}{
+		{
+			name:     "Test anyone can silence during business hours",
+			now:      wednesday,
+			team:     "databases",
+			identity: "alice",
+		},
+		{
+			name:     "Test whoever is on call in the rotation can silence",
+			now:      wednesday,
+			team:     "infra",
+			identity: "carol",
+		},
+		{
+			name:           "Test people not on call can't silence",
+			now:            wednesday,
+			team:           "infra",
+			identity:       "alice",
+			expectedReason: "not_on_call",
+		},
+		{
+			name:           "Test overrides replace the rotation",
+			now:            wednesday.Add(-45 * time.Minute),
+			team:           "infra",
+			identity:       "carol",
+			expectedReason: "not_on_call",
+		},
+		{
+			name:           "Test createdBy is used without an identity when it's trusted",
+			now:            wednesday,
+			team:           "infra",
+			createdBy:      "carol",
+			trustCreatedBy: true,
+		},
+		{
+			name:           "Test createdBy isn't trusted by default",
+			now:            wednesday,
+			team:           "infra",
+			createdBy:      "carol",
+			expectedReason: "missing_identity",
+		},
+		{
+			name:           "Test the identity is used over a trusted createdBy",
+			now:            wednesday,
+			team:           "infra",
+			identity:       "alice",
+			createdBy:      "carol",
+			trustCreatedBy: true,
+			expectedReason: "not_on_call",
+		},
+		{
+			name:     "Test shifts from CSV schedules",
+			now:      wednesday,
+			team:     "storage",
+			identity: "erin",
+		},
+		{
+			name:     "Test shifts from PagerDuty schedules",
+			now:      wednesday,
+			team:     "network",
+			identity: "Frank@example.com",
+		},
+		{
+			name:           "Test teams without a schedule are rejected outside business hours",
+			now:            saturday,
+			team:           "databases",
+			identity:       "alice",
+			expectedReason: "not_on_call",
+		},
+		{
+			name:           "Test silences without a team are rejected outside business hours",
+			now:            saturday,
+			identity:       "alice",
+			expectedReason: "missing_team",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			input := `{"matchers":[{"name":"alertname","value":"Foo","isRegex":false}],"createdBy":"` + tt.createdBy + `"}`
+			if tt.team != "" {
+				input = `{"matchers":[{"name":"team","value":"` + tt.team + `","isRegex":false}],"createdBy":"` + tt.createdBy + `"}`
+			}
+
+			req := testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", input)
+			req.Header = http.Header{}
+			if tt.identity != "" {
+				req.Header.Set("X-Forwarded-User", tt.identity)
+			}
+
+			decider := decider
+			if tt.trustCreatedBy {
+				decider = trusting
+			}
+
+			oncall.SetClock(decider, func() time.Time { return tt.now })
+			response := decider.Decide(req)
+			if tt.expectedReason == "" {
+				require.Nil(t, response)
+			} else {
+				require.NotNil(t, response)
+				require.Equal(t, tt.expectedReason, response.Reason)
+			}
+		})
+	}
+}
+
+func TestOnlyOnCallOutsideBusinessHoursConfig(t *testing.T) {
+	schedule := writeFile(t, "rotations.yml", rotations)
+	testCases := []map[string]interface{}{
+		{},
+		{"schedules": []map[string]interface{}{{"path": schedule}}, "businessHours": map[string]interface{}{"days": []string{"Funday"}}},
+		{"schedules": []map[string]interface{}{{"path": schedule}}, "businessHours": map[string]interface{}{"start": "17:00", "end": "09:00"}},
+		{"schedules": []map[string]interface{}{{"path": writeFile(t, "network.json", pagerDuty)}}},
+		{"schedules": []map[string]interface{}{{"path": schedule, "format": "xml"}}},
+	}
+
+	for _, config := range testCases {
+		_, err := oncall.New(config)
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,230 @@
+package oncall
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FormatYAML is a file of rotations, and overrides, for each team.
+	FormatYAML = "yaml"
+	// FormatCSV is a file of shifts, with the columns team, user, start, and end.
+	FormatCSV = "csv"
+	// FormatPagerDuty is the JSON export of a single PagerDuty schedule, with its rendered entries.
+	FormatPagerDuty = "pagerduty"
+)
+
+// ScheduleFile is a file that on call shifts are read from.
+type ScheduleFile struct {
+	Path string `mapstructure:"path"`
+
+	// Format is one of FormatYAML, FormatCSV, or FormatPagerDuty. By default it's worked out from the extension of the file.
+	Format string `mapstructure:"format"`
+
+	// Team is the team that a PagerDuty export is the schedule for, because it only has one schedule in it.
+	Team string `mapstructure:"team"`
+}
+
+// shift is a time when someone is on call for a team.
+type shift struct {
+	team  string
+	user  string
+	start time.Time
+	end   time.Time
+}
+
+// rotation is a list of people that take turns being on call for a team, for shiftLength each, starting from start.
+type rotation struct {
+	Start       time.Time     `yaml:"start"`
+	ShiftLength time.Duration `yaml:"shiftLength"`
+	Members     []string      `yaml:"members"`
+}
+
+type yamlSchedule struct {
+	Teams map[string]struct {
+		Rotations []rotation `yaml:"rotations"`
+		Overrides []struct {
+			User  string    `yaml:"user"`
+			Start time.Time `yaml:"start"`
+			End   time.Time `yaml:"end"`
+		} `yaml:"overrides"`
+	} `yaml:"teams"`
+}
+
+type pagerDutySchedule struct {
+	Schedule struct {
+		FinalSchedule struct {
+			RenderedScheduleEntries []struct {
+				Start time.Time `json:"start"`
+				End   time.Time `json:"end"`
+				User  struct {
+					Summary string `json:"summary"`
+					Email   string `json:"email"`
+				} `json:"user"`
+			} `json:"rendered_schedule_entries"`
+		} `json:"final_schedule"`
+	} `json:"schedule"`
+}
+
+// schedule knows who is on call for each team.
+type schedule struct {
+	// overrides take precedence over rotations, and are checked first.
+	overrides []shift
+	rotations map[string][]rotation
+}
+
+func loadSchedule(files []ScheduleFile) (*schedule, error) {
+	s := &schedule{rotations: make(map[string][]rotation)}
+	for _, file := range files {
+		format := file.Format
+		if format == "" {
+			format = formatFromExtension(file.Path)
+		}
+
+		f, err := os.Open(file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open schedule: %w", err)
+		}
+
+		switch format {
+		case FormatYAML:
+			err = s.loadYAML(f)
+		case FormatCSV:
+			err = s.loadCSV(f)
+		case FormatPagerDuty:
+			if file.Team == "" {
+				err = fmt.Errorf("team must be set for %q schedules", FormatPagerDuty)
+			} else {
+				err = s.loadPagerDuty(f, file.Team)
+			}
+		default:
+			err = fmt.Errorf("format must be one of %q, %q, or %q, got %q", FormatYAML, FormatCSV, FormatPagerDuty, format)
+		}
+
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load schedule %s: %w", file.Path, err)
+		}
+	}
+
+	return s, nil
+}
+
+func formatFromExtension(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".json":
+		return FormatPagerDuty
+	default:
+		return FormatYAML
+	}
+}
+
+func (s *schedule) loadYAML(r io.Reader) error {
+	var contents yamlSchedule
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&contents); err != nil {
+		return err
+	}
+
+	for team, teamSchedule := range contents.Teams {
+		for _, rotation := range teamSchedule.Rotations {
+			if rotation.ShiftLength <= 0 || len(rotation.Members) == 0 {
+				return fmt.Errorf("rotations for team %q must have a shiftLength and members", team)
+			}
+
+			s.rotations[team] = append(s.rotations[team], rotation)
+		}
+
+		for _, override := range teamSchedule.Overrides {
+			s.overrides = append(s.overrides, shift{team: team, user: override.User, start: override.Start, end: override.End})
+		}
+	}
+
+	return nil
+}
+
+func (s *schedule) loadCSV(r io.Reader) error {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+
+	for i, record := range records {
+		if len(record) != 4 {
+			return fmt.Errorf("line %d: expected 4 columns (team, user, start, end), got %d", i+1, len(record))
+		}
+
+		if i == 0 && record[0] == "team" {
+			continue
+		}
+
+		start, err := time.Parse(time.RFC3339, strings.TrimSpace(record[2]))
+		if err != nil {
+			return fmt.Errorf("line %d: invalid start: %w", i+1, err)
+		}
+
+		end, err := time.Parse(time.RFC3339, strings.TrimSpace(record[3]))
+		if err != nil {
+			return fmt.Errorf("line %d: invalid end: %w", i+1, err)
+		}
+
+		s.overrides = append(s.overrides, shift{team: strings.TrimSpace(record[0]), user: strings.TrimSpace(record[1]), start: start, end: end})
+	}
+
+	return nil
+}
+
+func (s *schedule) loadPagerDuty(r io.Reader, team string) error {
+	var contents pagerDutySchedule
+	if err := json.NewDecoder(r).Decode(&contents); err != nil {
+		return err
+	}
+
+	for _, entry := range contents.Schedule.FinalSchedule.RenderedScheduleEntries {
+		user := entry.User.Email
+		if user == "" {
+			user = entry.User.Summary
+		}
+
+		s.overrides = append(s.overrides, shift{team: team, user: user, start: entry.Start, end: entry.End})
+	}
+
+	return nil
+}
+
+// onCall returns who is on call for the given team at the given time. Shifts from CSV and PagerDuty schedules, and overrides,
+// take precedence over rotations.
+func (s *schedule) onCall(team string, at time.Time) []string {
+	var users []string
+	for _, shift := range s.overrides {
+		if shift.team == team && !at.Before(shift.start) && at.Before(shift.end) {
+			users = append(users, shift.user)
+		}
+	}
+
+	if len(users) > 0 {
+		return users
+	}
+
+	for _, rotation := range s.rotations[team] {
+		if at.Before(rotation.Start) {
+			continue
+		}
+
+		turn := int64(at.Sub(rotation.Start) / rotation.ShiftLength)
+		users = append(users, rotation.Members[turn%int64(len(rotation.Members))])
+	}
+
+	return users
+}
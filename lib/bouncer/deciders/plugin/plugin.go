@@ -0,0 +1,276 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	// FailurePolicyOpen accepts requests when the plugin can't be reached, or has crashed.
+	FailurePolicyOpen = "open"
+	// FailurePolicyClosed rejects requests when the plugin can't be reached, or has crashed.
+	FailurePolicyClosed = "closed"
+
+	defaultTimeout    = 5 * time.Second
+	minRestartBackoff = 100 * time.Millisecond
+	maxRestartBackoff = 30 * time.Second
+	stopTimeout       = 5 * time.Second
+)
+
+var _ = deciders.Decider(&Plugin{})
+
+// Plugin is a Decider which delegates decisions to an out of process plugin over gRPC. The plugin is either an executable,
+// which the bouncer spawns and supervises, or a long running server listening on a unix socket.
+type Plugin struct {
+	Command       []string      `mapstructure:"command"`
+	Socket        string        `mapstructure:"socket"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+	FailurePolicy string        `mapstructure:"failurePolicy"`
+	ErrorStatus   int           `mapstructure:"errorStatus"`
+
+	// Headers are the request headers that are sent to the plugin, defaulting to deciders.DefaultForwardedHeaders.
+	Headers []string `mapstructure:"headers"`
+
+	conn   *grpc.ClientConn
+	tmpDir string
+
+	lock    sync.Mutex
+	running bool
+	lastErr error
+	cmd     *exec.Cmd
+	closed  chan struct{}
+	done    chan struct{}
+}
+
+func New(config map[string]interface{}) (deciders.Decider, error) {
+	var decider Plugin
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
+		return nil, err
+	}
+
+	if len(decider.Command) == 0 && decider.Socket == "" {
+		return nil, fmt.Errorf("one of command or socket must be set")
+	}
+
+	switch decider.FailurePolicy {
+	case "":
+		decider.FailurePolicy = FailurePolicyClosed
+	case FailurePolicyOpen, FailurePolicyClosed:
+	default:
+		return nil, fmt.Errorf("failurePolicy must be either %q or %q, got %q", FailurePolicyOpen, FailurePolicyClosed, decider.FailurePolicy)
+	}
+
+	if decider.Timeout == 0 {
+		decider.Timeout = defaultTimeout
+	}
+
+	if decider.ErrorStatus == 0 {
+		decider.ErrorStatus = http.StatusBadGateway
+	}
+
+	var err error
+	if len(decider.Command) > 0 && decider.Socket == "" {
+		decider.tmpDir, err = os.MkdirTemp("", "bouncer-plugin-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create socket directory: %s", err)
+		}
+
+		decider.Socket = filepath.Join(decider.tmpDir, "plugin.sock")
+	}
+
+	decider.conn, err = grpc.Dial(
+		"unix://"+decider.Socket,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})),
+	)
+	if err != nil {
+		decider.cleanup()
+		return nil, fmt.Errorf("failed to connect to plugin socket %s: %s", decider.Socket, err)
+	}
+
+	decider.closed = make(chan struct{})
+	decider.done = make(chan struct{})
+	if len(decider.Command) > 0 {
+		go decider.supervise()
+	} else {
+		close(decider.done)
+	}
+
+	return &decider, nil
+}
+
+// supervise runs the plugin command, restarting it with an exponential backoff whenever it exits until the Plugin is closed.
+func (p *Plugin) supervise() {
+	defer close(p.done)
+
+	backoff := minRestartBackoff
+	for {
+		// A stale socket from a previous run would stop the plugin from listening.
+		os.Remove(p.Socket)
+
+		cmd := exec.Command(p.Command[0], p.Command[1:]...) //nolint:gosec // The command comes from the operators config.
+		cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", SocketEnvVar, p.Socket))
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+
+		started := time.Now()
+		err := cmd.Start()
+		if err == nil {
+			p.lock.Lock()
+			p.running = true
+			p.cmd = cmd
+			p.lock.Unlock()
+
+			err = cmd.Wait()
+			if err == nil {
+				err = fmt.Errorf("plugin exited")
+			}
+		}
+
+		p.lock.Lock()
+		p.running = false
+		p.cmd = nil
+		p.lastErr = err
+		p.lock.Unlock()
+
+		select {
+		case <-p.closed:
+			return
+		default:
+		}
+
+		if time.Since(started) > maxRestartBackoff {
+			backoff = minRestartBackoff
+		}
+
+		log.Error().Strs("command", p.Command).Err(err).Dur("backoff", backoff).Msg("Plugin crashed, restarting")
+
+		select {
+		case <-p.closed:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+	}
+}
+
+// Decide implements deciders.Decider.
+func (p *Plugin) Decide(req *http.Request) *deciders.HTTPError {
+	request := &Request{
+		Method:  req.Method,
+		URI:     req.URL.RequestURI(),
+		Headers: deciders.ForwardedHeaders(req.Header, p.Headers),
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return &deciders.HTTPError{
+				Status: http.StatusBadRequest,
+				Err:    fmt.Sprintf("failed to read request: %s", err),
+				Reason: deciders.ReasonInvalidRequest,
+			}
+		}
+
+		request.Body = body
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), p.Timeout)
+	defer cancel()
+
+	var verdict Verdict
+	if err := p.conn.Invoke(ctx, decideMethod, request, &verdict, grpc.WaitForReady(true)); err != nil {
+		return p.fail(err)
+	}
+
+	if verdict.Allowed {
+		return nil
+	}
+
+	status := deciders.RejectionStatus(verdict.Status)
+	if verdict.Status != 0 && status != verdict.Status {
+		log.Warn().Int("status", verdict.Status).Msg("Plugin rejected a request with a status that isn't an error, using 400 instead")
+	}
+
+	if verdict.Message == "" {
+		verdict.Message = "rejected by plugin"
+	}
+
+	return &deciders.HTTPError{
+		Status: status,
+		Err:    verdict.Message,
+		Reason: verdict.Reason,
+	}
+}
+
+// fail handles a plugin that couldn't give us an answer, according to the configured FailurePolicy.
+func (p *Plugin) fail(err error) *deciders.HTTPError {
+	p.lock.Lock()
+	if len(p.Command) > 0 && !p.running && p.lastErr != nil {
+		err = fmt.Errorf("plugin crashed: %w", p.lastErr)
+	}
+	p.lock.Unlock()
+
+	if p.FailurePolicy == FailurePolicyOpen {
+		log.Warn().Str("socket", p.Socket).Err(err).Msg("Plugin failed, allowing request due to failurePolicy open")
+		return nil
+	}
+
+	return &deciders.HTTPError{
+		Status: p.ErrorStatus,
+		Err:    fmt.Sprintf("plugin failed: %s", err),
+		Reason: deciders.ReasonDeciderFailed,
+	}
+}
+
+// Close stops the plugin process (if the bouncer spawned one), and closes the connection to it.
+func (p *Plugin) Close() error {
+	select {
+	case <-p.closed:
+		return nil
+	default:
+		close(p.closed)
+	}
+
+	p.signal(os.Interrupt)
+	select {
+	case <-p.done:
+	case <-time.After(stopTimeout):
+		p.signal(os.Kill)
+		<-p.done
+	}
+
+	err := p.conn.Close()
+	p.cleanup()
+	return err
+}
+
+func (p *Plugin) signal(sig os.Signal) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.cmd != nil && p.cmd.Process != nil {
+		p.cmd.Process.Signal(sig)
+	}
+}
+
+func (p *Plugin) cleanup() {
+	if p.tmpDir != "" {
+		os.RemoveAll(p.tmpDir)
+	}
+}
@@ -0,0 +1,163 @@
+package plugin_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/plugin"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const helperModeEnvVar = "BOUNCER_TEST_PLUGIN_MODE"
+
+// rejectEmptyComments is a plugin which rejects any silence without a comment.
+var rejectEmptyComments = plugin.DeciderServerFunc(func(ctx context.Context, req *plugin.Request) (*plugin.Verdict, error) {
+	silence, err := deciders.ParseSilence(io.NopCloser(bytes.NewReader(req.Body)))
+	if err != nil {
+		return nil, err
+	}
+
+	if silence.Comment == "" {
+		return &plugin.Verdict{Allowed: false, Status: http.StatusForbidden, Message: "silences must have comments"}, nil
+	}
+
+	return &plugin.Verdict{Allowed: true}, nil
+})
+
+// TestMain lets the test binary double as a plugin executable, when it gets spawned by a Plugin decider.
+func TestMain(m *testing.M) {
+	switch os.Getenv(helperModeEnvVar) {
+	case "":
+		os.Exit(m.Run())
+	case "serve":
+		if err := plugin.Main(rejectEmptyComments); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "crash":
+		os.Exit(3)
+	}
+}
+
+func TestSpawnedPlugin(t *testing.T) {
+	t.Setenv(helperModeEnvVar, "serve")
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(plugin.New), map[string]interface{}{
+		"command": []interface{}{os.Args[0]},
+		"timeout": "10s",
+	})
+	defer decider.(*plugin.Plugin).Close()
+
+	require.Nil(t, decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"comment": "test"}`)))
+
+	response := decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{}`))
+	require.NotNil(t, response)
+	require.Equal(t, http.StatusForbidden, response.Status)
+	require.Equal(t, "silences must have comments", response.Err)
+}
+
+func TestCrashingPlugin(t *testing.T) {
+	t.Setenv(helperModeEnvVar, "crash")
+
+	testCases := []struct {
+		name           string
+		config         map[string]interface{}
+		expectedStatus int
+	}{
+		{
+			name:           "Failure Policy Closed Rejects",
+			config:         map[string]interface{}{"errorStatus": http.StatusServiceUnavailable},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Failure Policy Open Accepts",
+			config:         map[string]interface{}{"failurePolicy": "open"},
+			expectedStatus: 0,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			config := map[string]interface{}{
+				"command": []interface{}{os.Args[0]},
+				"timeout": "200ms",
+			}
+			for k, v := range tt.config {
+				config[k] = v
+			}
+
+			decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(plugin.New), config)
+			defer decider.(*plugin.Plugin).Close()
+
+			response := decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"comment": "test"}`))
+			if tt.expectedStatus == 0 {
+				require.Nil(t, response)
+			} else {
+				require.NotNil(t, response)
+				require.Equal(t, tt.expectedStatus, response.Status)
+			}
+		})
+	}
+}
+
+func TestSocketPlugin(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "plugin.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	server := plugin.NewServer(rejectEmptyComments)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(plugin.New), map[string]interface{}{"socket": socket})
+	defer decider.(*plugin.Plugin).Close()
+
+	require.Nil(t, decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"comment": "test"}`)))
+	require.NotNil(t, decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{}`)))
+}
+
+func TestPluginRequests(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "plugin.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	requests := make(chan *plugin.Request, 1)
+	server := plugin.NewServer(plugin.DeciderServerFunc(func(ctx context.Context, req *plugin.Request) (*plugin.Verdict, error) {
+		requests <- req
+		return &plugin.Verdict{Allowed: false, Status: http.StatusOK}, nil
+	}))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(plugin.New), map[string]interface{}{"socket": socket})
+	defer decider.(*plugin.Plugin).Close()
+
+	req := testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{}`)
+	req.Header = http.Header{}
+	req.Header.Set(deciders.DefaultIdentityHeader, "colin@example.com")
+	req.Header.Set("Authorization", "Bearer secret")
+
+	response := decider.Decide(req)
+	require.NotNil(t, response)
+	require.Equal(t, http.StatusBadRequest, response.Status, "Expected rejections with successful statuses to become 400s")
+
+	request := <-requests
+	require.Equal(t, map[string][]string{deciders.DefaultIdentityHeader: {"colin@example.com"}}, request.Headers, "Expected credentials not to be sent by default")
+}
+
+func TestPluginConfigValidation(t *testing.T) {
+	_, err := plugin.New(map[string]interface{}{})
+	require.Error(t, err)
+
+	_, err = plugin.New(map[string]interface{}{"socket": "/tmp/plugin.sock", "failurePolicy": "sometimes"})
+	require.Error(t, err)
+}
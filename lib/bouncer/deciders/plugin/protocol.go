@@ -0,0 +1,137 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"google.golang.org/grpc"
+)
+
+// SocketEnvVar is the environment variable which tells a spawned plugin which unix socket it should listen on.
+const SocketEnvVar = "BOUNCER_PLUGIN_SOCKET"
+
+const (
+	serviceName  = "bouncer.plugin.v1.Decider"
+	decideMethod = "/" + serviceName + "/Decide"
+)
+
+// Request is the message sent to a plugin describing the request that it should decide on.
+type Request struct {
+	Method  string              `json:"method"`
+	URI     string              `json:"uri"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    []byte              `json:"body,omitempty"`
+}
+
+// Verdict is the message that a plugin replies with.
+type Verdict struct {
+	Allowed bool   `json:"allowed"`
+	Status  int    `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// DeciderServer is the interface that plugins implement to serve the Decide RPC.
+type DeciderServer interface {
+	Decide(ctx context.Context, req *Request) (*Verdict, error)
+}
+
+// DeciderServerFunc adapts a function into a DeciderServer.
+type DeciderServerFunc func(ctx context.Context, req *Request) (*Verdict, error)
+
+func (d DeciderServerFunc) Decide(ctx context.Context, req *Request) (*Verdict, error) {
+	return d(ctx, req)
+}
+
+// codec encodes messages as JSON rather than protobuf, so that plugins can be written without a protobuf toolchain.
+// It is forced on both sides of the connection, so messages are sent with the content type application/grpc+json.
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return "json"
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*DeciderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Decide",
+			Handler:    decideHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "bouncer/plugin/v1",
+}
+
+func decideHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+
+	if interceptor == nil {
+		return srv.(DeciderServer).Decide(ctx, in)
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: decideMethod,
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeciderServer).Decide(ctx, req.(*Request))
+	}
+
+	return interceptor(ctx, in, info, handler)
+}
+
+// NewServer creates a gRPC server serving the given DeciderServer.
+func NewServer(impl DeciderServer) *grpc.Server {
+	server := grpc.NewServer(grpc.ForceServerCodec(codec{}))
+	server.RegisterService(&serviceDesc, impl)
+	return server
+}
+
+// Serve serves the given DeciderServer on the given listener, until the listener is closed.
+func Serve(listener net.Listener, impl DeciderServer) error {
+	return NewServer(impl).Serve(listener)
+}
+
+// Main is the entrypoint for plugin executables. It listens on the socket given to it by the bouncer, and serves
+// the given DeciderServer on it until the process is told to stop.
+func Main(impl DeciderServer) error {
+	socket := os.Getenv(SocketEnvVar)
+	if socket == "" {
+		return fmt.Errorf("%s is not set. Plugins should be started by the bouncer", SocketEnvVar)
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+
+	server := NewServer(impl)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		server.GracefulStop()
+	}()
+
+	return server.Serve(listener)
+}
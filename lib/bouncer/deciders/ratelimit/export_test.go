@@ -0,0 +1,11 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+func SetClock(decider deciders.Decider, now func() time.Time) {
+	decider.(*RateLimit).now = now
+}
@@ -0,0 +1,397 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+const (
+	// KeyCreatedBy limits each author, from the createdBy of the silence.
+	KeyCreatedBy = "createdBy"
+	// KeyIdentity limits each authenticated user, from IdentityHeader.
+	KeyIdentity = "identity"
+	// KeyClientIP limits each client IP address.
+	KeyClientIP = "clientIP"
+	// KeyLabelPrefix limits each value of a label, from the equality matcher for it in the silence, e.g. "label:team".
+	KeyLabelPrefix = deciders.LabelKeyPrefix
+
+	defaultInterval         = time.Minute
+	defaultSnapshotInterval = 30 * time.Second
+)
+
+// RateLimit is a Decider which limits how often requests can be made, with a token bucket for each value of Key. Each bucket holds
+// up to Burst tokens, and is refilled with Limit tokens every Interval. Requests that find their bucket empty are rejected with a
+// 429, and a Retry-After header saying when there will be a token for them. Requests that don't have a value for Key, e.g. silences
+// without the label, aren't limited, rather than all sharing one bucket.
+//
+// Buckets are kept in memory. If Name or SnapshotFile is set, the buckets are handed over to the RateLimit with the same Name and
+// SnapshotFile in the new config when the config is reloaded, so that reloading doesn't reset the limits. No two RateLimits in one
+// config can have the same Name or SnapshotFile. If SnapshotFile is set, the buckets are also written to it every SnapshotInterval
+// and when the last RateLimit using them is closed, and read back from it when the first one is created, so that restarting the
+// bouncer doesn't reset them either.
+type RateLimit struct {
+	Name             string        `mapstructure:"name"`
+	Key              string        `mapstructure:"key"`
+	IdentityHeader   string        `mapstructure:"identityHeader"`
+	Limit            int           `mapstructure:"limit"`
+	Interval         time.Duration `mapstructure:"interval"`
+	Burst            int           `mapstructure:"burst"`
+	SnapshotFile     string        `mapstructure:"snapshotFile"`
+	SnapshotInterval time.Duration `mapstructure:"snapshotInterval"`
+
+	now       func() time.Time
+	store     *store
+	closeOnce sync.Once
+}
+
+// bucket is a token bucket. Tokens are added lazily, when the bucket is next looked at.
+type bucket struct {
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+}
+
+var (
+	_ = deciders.ResourceOwner(&RateLimit{})
+
+	storesLock sync.Mutex
+	stores     = make(map[string]*store)
+)
+
+// store holds the buckets for every RateLimit with the same id, which is only ever the old and new versions of a RateLimit while
+// the config is being reloaded. It is the only thing that writes to the snapshot file, and lives until the last RateLimit using it
+// is closed, so that a reload, which creates the new deciders before closing the old ones, hands the buckets over rather than
+// starting again. RateLimits without an id get a store of their own.
+type store struct {
+	id   string
+	refs int
+
+	lock    sync.Mutex
+	buckets map[string]*bucket
+	// limiter is the newest RateLimit using the store, whose limits are used to prune the buckets.
+	limiter *RateLimit
+	// key is the Key, and IdentityHeader, that the buckets are for.
+	key string
+
+	snapshotFile string
+	stop         chan struct{}
+	wg           sync.WaitGroup
+}
+
+func New(config map[string]interface{}) (deciders.Decider, error) {
+	var decider RateLimit
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
+		return nil, err
+	}
+
+	if _, ok := deciders.ParseLabelKey(decider.Key); !ok && decider.Key != KeyCreatedBy && decider.Key != KeyIdentity && decider.Key != KeyClientIP {
+		return nil, fmt.Errorf("key must be one of %q, %q, %q, or %q followed by a label name, got %q", KeyCreatedBy, KeyIdentity, KeyClientIP, KeyLabelPrefix, decider.Key)
+	}
+
+	if decider.Limit <= 0 {
+		return nil, fmt.Errorf("limit must be set")
+	}
+
+	if decider.Interval < 0 || decider.Burst < 0 || decider.SnapshotInterval < 0 {
+		return nil, fmt.Errorf("interval, burst, and snapshotInterval must not be negative")
+	}
+
+	if decider.Interval == 0 {
+		decider.Interval = defaultInterval
+	}
+
+	if decider.Burst == 0 {
+		decider.Burst = decider.Limit
+	}
+
+	if decider.SnapshotInterval == 0 {
+		decider.SnapshotInterval = defaultSnapshotInterval
+	}
+
+	decider.now = time.Now
+	store, err := acquireStore(&decider)
+	if err != nil {
+		return nil, err
+	}
+
+	decider.store = store
+	return &decider, nil
+}
+
+// OwnedResources implements deciders.ResourceOwner, so that no two RateLimits in a config share their buckets.
+func (r *RateLimit) OwnedResources() []string {
+	var resources []string
+	if r.Name != "" {
+		resources = append(resources, fmt.Sprintf("RateLimit name %q", r.Name))
+	}
+
+	if r.SnapshotFile != "" {
+		resources = append(resources, fmt.Sprintf("snapshotFile %q", r.SnapshotFile))
+	}
+
+	return resources
+}
+
+// id returns the id of the store that the RateLimit uses, or "" if it shouldn't share one.
+func (r *RateLimit) id() string {
+	if r.Name == "" && r.SnapshotFile == "" {
+		return ""
+	}
+
+	return r.Name + "\x00" + r.SnapshotFile
+}
+
+// acquireStore returns the store for the given RateLimit, creating it, and loading its snapshot, if nothing else is using it.
+func acquireStore(r *RateLimit) (*store, error) {
+	storesLock.Lock()
+	defer storesLock.Unlock()
+
+	id := r.id()
+	key := r.Key + "/" + r.IdentityHeader
+	if s, ok := stores[id]; ok && id != "" {
+		s.lock.Lock()
+		s.limiter = r
+		if s.key != key {
+			// The old buckets were for something else, so they don't mean anything any more.
+			s.buckets = make(map[string]*bucket)
+			s.key = key
+		}
+		s.lock.Unlock()
+
+		s.refs++
+		return s, nil
+	}
+
+	s := &store{
+		id:           id,
+		refs:         1,
+		buckets:      make(map[string]*bucket),
+		limiter:      r,
+		key:          key,
+		snapshotFile: r.SnapshotFile,
+		stop:         make(chan struct{}),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	if id != "" {
+		stores[id] = s
+	}
+
+	s.wg.Add(1)
+	go s.run(r.SnapshotInterval)
+
+	return s, nil
+}
+
+// release stops using the store, stopping it and writing a final snapshot if nothing else is using it.
+func (s *store) release() {
+	storesLock.Lock()
+	s.refs--
+	last := s.refs == 0
+	if last && s.id != "" {
+		delete(stores, s.id)
+	}
+	storesLock.Unlock()
+
+	if last {
+		close(s.stop)
+		s.wg.Wait()
+	}
+}
+
+// Decide implements deciders.Decider.
+func (r *RateLimit) Decide(req *http.Request) *deciders.HTTPError {
+	key, err := r.key(req)
+	if err != nil {
+		return &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    err.Error(),
+			Reason: deciders.ReasonInvalidRequest,
+		}
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	wait := r.take(key)
+	if wait == 0 {
+		return nil
+	}
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	return &deciders.HTTPError{
+		Status:  http.StatusTooManyRequests,
+		Err:     fmt.Sprintf("too many requests for %s %q, try again in %ds", r.Key, key, seconds),
+		Reason:  "rate_limited",
+		Headers: http.Header{"Retry-After": []string{strconv.Itoa(seconds)}},
+	}
+}
+
+// key returns the value of Key for the given request, which picks the bucket that it takes a token from.
+func (r *RateLimit) key(req *http.Request) (string, error) {
+	switch r.Key {
+	case KeyIdentity:
+		return deciders.Identity(req, r.IdentityHeader), nil
+	case KeyClientIP:
+		if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+			return host, nil
+		}
+
+		return req.RemoteAddr, nil
+	}
+
+	silence, err := deciders.ParseSilence(req.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if r.Key == KeyCreatedBy {
+		return silence.CreatedBy, nil
+	}
+
+	name, _ := deciders.ParseLabelKey(r.Key)
+	value, _ := deciders.LabelValue(silence, name)
+	return value, nil
+}
+
+// rate is the number of tokens that get added to each bucket per second.
+func (r *RateLimit) rate() float64 {
+	return float64(r.Limit) / r.Interval.Seconds()
+}
+
+// take takes a token from the bucket for the given key, returning 0 if there was one, or how long until there will be one if not.
+func (r *RateLimit) take(key string) time.Duration {
+	r.store.lock.Lock()
+	defer r.store.lock.Unlock()
+
+	now := r.now()
+	b, ok := r.store.buckets[key]
+	if !ok {
+		b = &bucket{Tokens: float64(r.Burst), Updated: now}
+		r.store.buckets[key] = b
+	}
+
+	r.refill(b, now)
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.Tokens) / r.rate() * float64(time.Second))
+}
+
+func (r *RateLimit) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.Updated); elapsed > 0 {
+		b.Tokens = math.Min(float64(r.Burst), b.Tokens+elapsed.Seconds()*r.rate())
+		b.Updated = now
+	}
+}
+
+func (s *store) run(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.prune()
+			s.saveOrLog()
+		case <-s.stop:
+			s.saveOrLog()
+			return
+		}
+	}
+}
+
+// prune forgets buckets that have refilled, because they're the same as a new bucket.
+func (s *store) prune() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.limiter.now()
+	for key, b := range s.buckets {
+		s.limiter.refill(b, now)
+		if b.Tokens >= float64(s.limiter.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func (s *store) load() error {
+	if s.snapshotFile == "" {
+		return nil
+	}
+
+	contents, err := os.ReadFile(s.snapshotFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read rate limit snapshot: %w", err)
+	}
+
+	if err := json.Unmarshal(contents, &s.buckets); err != nil {
+		return fmt.Errorf("failed to parse rate limit snapshot %s: %w", s.snapshotFile, err)
+	}
+
+	return nil
+}
+
+func (s *store) saveOrLog() {
+	if err := s.save(); err != nil {
+		log.Warn().Err(err).Str("file", s.snapshotFile).Msg("Failed to save rate limit snapshot")
+	}
+}
+
+// save writes the buckets to the snapshot file, through a temporary file so that a crash half way through doesn't leave a broken snapshot.
+func (s *store) save() error {
+	if s.snapshotFile == "" {
+		return nil
+	}
+
+	s.lock.Lock()
+	contents, err := json.Marshal(s.buckets)
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.snapshotFile), filepath.Base(s.snapshotFile)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.snapshotFile)
+}
+
+// Close stops using the buckets, writing a final snapshot if nothing else is using them.
+func (r *RateLimit) Close() error {
+	r.closeOnce.Do(r.store.release)
+	return nil
+}
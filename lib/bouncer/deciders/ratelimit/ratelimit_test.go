@@ -0,0 +1,171 @@
+package ratelimit_test
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/ratelimit"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func mustMakeRateLimit(t *testing.T, config map[string]interface{}, now *time.Time) deciders.Decider {
+	t.Helper()
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(ratelimit.New), config)
+	ratelimit.SetClock(decider, func() time.Time { return *now })
+	t.Cleanup(func() { decider.(io.Closer).Close() })
+	return decider
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)
+	decider := mustMakeRateLimit(t, map[string]interface{}{"key": "createdBy", "limit": 1, "interval": "1m", "burst": 2}, &now)
+
+	silence := func(author string) *http.Request {
+		return testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"createdBy":"`+author+`"}`)
+	}
+
+	require.Nil(t, decider.Decide(silence("colin")))
+	require.Nil(t, decider.Decide(silence("colin")))
+
+	response := decider.Decide(silence("colin"))
+	require.NotNil(t, response, "Expected requests past the burst to be rejected")
+	require.Equal(t, http.StatusTooManyRequests, response.Status)
+	require.Equal(t, "rate_limited", response.Reason)
+	require.Equal(t, "60", response.Headers.Get("Retry-After"))
+
+	require.Nil(t, decider.Decide(silence("someone")), "Expected other authors to have their own limit")
+
+	now = now.Add(45 * time.Second)
+	response = decider.Decide(silence("colin"))
+	require.NotNil(t, response)
+	require.Equal(t, "15", response.Headers.Get("Retry-After"))
+
+	now = now.Add(15 * time.Second)
+	require.Nil(t, decider.Decide(silence("colin")), "Expected the bucket to refill over time")
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	now := time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name  string
+		key   string
+		first func(req *http.Request)
+		other func(req *http.Request)
+	}{
+		{
+			name:  "Test limiting by identity",
+			key:   "identity",
+			first: func(req *http.Request) { req.Header = http.Header{"X-Forwarded-User": []string{"colin"}} },
+			other: func(req *http.Request) { req.Header = http.Header{"X-Forwarded-User": []string{"someone"}} },
+		},
+		{
+			name:  "Test limiting by client IP",
+			key:   "clientIP",
+			first: func(req *http.Request) { req.RemoteAddr = "10.0.0.1:1234" },
+			other: func(req *http.Request) { req.RemoteAddr = "10.0.0.2:1234" },
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			decider := mustMakeRateLimit(t, map[string]interface{}{"key": tt.key, "limit": 1}, &now)
+			request := func(setup func(req *http.Request)) *http.Request {
+				req := testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{}`)
+				setup(req)
+				return req
+			}
+
+			require.Nil(t, decider.Decide(request(tt.first)))
+			require.NotNil(t, decider.Decide(request(tt.first)))
+			require.Nil(t, decider.Decide(request(tt.other)))
+		})
+	}
+
+	t.Run("Test limiting by label", func(t *testing.T) {
+		decider := mustMakeRateLimit(t, map[string]interface{}{"key": "label:team", "limit": 1}, &now)
+		request := func(team string) *http.Request {
+			return testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"matchers":[{"name":"team","value":"`+team+`","isRegex":false}]}`)
+		}
+
+		require.Nil(t, decider.Decide(request("infra")))
+		require.NotNil(t, decider.Decide(request("infra")))
+		require.Nil(t, decider.Decide(request("databases")))
+	})
+}
+
+func TestRateLimitSnapshot(t *testing.T) {
+	now := time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)
+	config := map[string]interface{}{"key": "createdBy", "limit": 1, "snapshotFile": filepath.Join(t.TempDir(), "snapshot.json")}
+	request := func() *http.Request {
+		return testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"createdBy":"colin"}`)
+	}
+
+	decider := mustMakeRateLimit(t, config, &now)
+	require.Nil(t, decider.Decide(request()))
+	require.NoError(t, decider.(io.Closer).Close())
+
+	decider = mustMakeRateLimit(t, config, &now)
+	require.NotNil(t, decider.Decide(request()), "Expected the limit to survive a restart")
+}
+
+func TestRateLimitSurvivesReloads(t *testing.T) {
+	now := time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)
+	config := map[string]interface{}{"name": "silences", "key": "createdBy", "limit": 1}
+	request := func() *http.Request {
+		return testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"createdBy":"colin"}`)
+	}
+
+	old := mustMakeRateLimit(t, config, &now)
+	require.Nil(t, old.Decide(request()))
+
+	// Reloads create the new deciders before closing the old ones.
+	decider := mustMakeRateLimit(t, config, &now)
+	require.NoError(t, old.(io.Closer).Close())
+	require.NotNil(t, decider.Decide(request()), "Expected the limit to survive a reload")
+
+	unnamed := mustMakeRateLimit(t, map[string]interface{}{"key": "createdBy", "limit": 1}, &now)
+	require.Nil(t, unnamed.Decide(request()), "Expected deciders without a name to have their own buckets")
+	unnamed = mustMakeRateLimit(t, map[string]interface{}{"key": "createdBy", "limit": 1}, &now)
+	require.Nil(t, unnamed.Decide(request()), "Expected deciders without a name not to share buckets, even with the same config")
+
+	reKeyed := mustMakeRateLimit(t, map[string]interface{}{"name": "silences", "key": "identity", "limit": 1}, &now)
+	req := request()
+	req.Header = http.Header{"X-Forwarded-User": []string{"colin"}}
+	require.Nil(t, reKeyed.Decide(req), "Expected changing the key to start with new buckets")
+}
+
+func TestRateLimitSkipsRequestsWithoutAKey(t *testing.T) {
+	now := time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)
+	decider := mustMakeRateLimit(t, map[string]interface{}{"key": "label:team", "limit": 1}, &now)
+
+	for i := 0; i < 3; i++ {
+		req := testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"matchers":[{"name":"alertname","value":"Foo","isRegex":false}]}`)
+		require.Nil(t, decider.Decide(req), "Expected silences without the label not to share a bucket")
+	}
+}
+
+func TestRateLimitConfig(t *testing.T) {
+	_, err := ratelimit.New(map[string]interface{}{"key": "createdBy"})
+	require.Error(t, err, "Expected a missing limit to be rejected")
+
+	_, err = ratelimit.New(map[string]interface{}{"key": "label:", "limit": 1})
+	require.Error(t, err, "Expected a label key without a label to be rejected")
+
+	_, err = ratelimit.New(map[string]interface{}{"key": "colour", "limit": 1})
+	require.Error(t, err)
+
+	for _, field := range []string{"interval", "burst", "snapshotInterval"} {
+		value := interface{}(-1)
+		if field != "burst" {
+			value = "-1m"
+		}
+
+		_, err = ratelimit.New(map[string]interface{}{"key": "createdBy", "limit": 1, field: value})
+		require.Error(t, err, "Expected a negative %s to be rejected", field)
+	}
+}
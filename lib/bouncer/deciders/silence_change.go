@@ -0,0 +1,102 @@
+package deciders
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/grafana/regexp"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/backend"
+)
+
+// ErrBackendUnavailable is returned by ParseSilenceChange when it couldn't fetch the existing silence from the backend.
+var ErrBackendUnavailable = errors.New("failed to fetch silence from the backend")
+
+// silenceIDPath matches the path of requests for a single silence, e.g. DELETE /api/v2/silence/{id}.
+var silenceIDPath = regexp.MustCompile(`/api/v[12]/silence/([^/]+)/?$`)
+
+// SilenceChange describes a request that creates, updates, or expires a silence.
+type SilenceChange struct {
+	// Old is the silence as it currently exists in the backend, for updates and expiries.
+	Old *types.Silence
+
+	// New is the silence in the body of the request, for creations and updates.
+	New *types.Silence
+}
+
+// IsCreate returns whether the request creates a new silence.
+func (s SilenceChange) IsCreate() bool {
+	return s.Old == nil && s.New != nil
+}
+
+// IsUpdate returns whether the request updates an existing silence.
+func (s SilenceChange) IsUpdate() bool {
+	return s.Old != nil && s.New != nil
+}
+
+// IsExpire returns whether the request expires an existing silence.
+func (s SilenceChange) IsExpire() bool {
+	return s.Old != nil && s.New == nil
+}
+
+// ParseSilenceChange works out what silence the given request creates, updates, or expires. Expiries (DELETE requests) have no body,
+// and the body of updates only has the new version of the silence, so the existing silence is fetched from the backend.
+// Requests for silences that don't exist in the backend are treated as creations, or have neither silence in the case of expiries.
+func ParseSilenceChange(req *http.Request) (SilenceChange, error) {
+	var change SilenceChange
+	var id string
+	if req.Method == http.MethodDelete {
+		match := silenceIDPath.FindStringSubmatch(req.URL.Path)
+		if match == nil {
+			return SilenceChange{}, fmt.Errorf("failed to find a silence ID in %s", req.URL.Path)
+		}
+
+		id = match[1]
+	} else {
+		silence, err := ParseSilence(req.Body)
+		if err != nil {
+			return SilenceChange{}, err
+		}
+
+		change.New = &silence
+		id = silence.ID
+	}
+
+	if id == "" {
+		return change, nil
+	}
+
+	client, ok := backend.FromContext(req.Context())
+	if !ok {
+		return SilenceChange{}, fmt.Errorf("%w: no backend to fetch silence %s from", ErrBackendUnavailable, id)
+	}
+
+	old, err := client.GetSilence(req.Context(), id)
+	if errors.Is(err, backend.ErrNotFound) {
+		return change, nil
+	} else if err != nil {
+		return SilenceChange{}, fmt.Errorf("%w: failed to fetch silence %s: %s", ErrBackendUnavailable, id, err)
+	}
+
+	change.Old = &old
+	return change, nil
+}
+
+// SilenceChangeError converts an error from ParseSilenceChange into an HTTPError. Failing to reach the backend is a Bad Gateway,
+// anything else is a bad request.
+func SilenceChangeError(err error) *HTTPError {
+	if errors.Is(err, ErrBackendUnavailable) {
+		return &HTTPError{
+			Status: http.StatusBadGateway,
+			Err:    err.Error(),
+			Reason: ReasonDeciderFailed,
+		}
+	}
+
+	return &HTTPError{
+		Status: http.StatusBadRequest,
+		Err:    err.Error(),
+		Reason: ReasonInvalidRequest,
+	}
+}
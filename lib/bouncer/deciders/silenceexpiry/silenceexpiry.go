@@ -0,0 +1,65 @@
+package silenceexpiry
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+// OnlyCreatorCanExpire is a Decider which rejects requests to expire silences from anyone but the person who created them, or an admin.
+// The person expiring the silence is read from IdentityHeader, which should be set by an authenticating proxy.
+type OnlyCreatorCanExpire struct {
+	IdentityHeader string   `mapstructure:"identityHeader"`
+	Admins         []string `mapstructure:"admins"`
+}
+
+func New(config map[string]interface{}) (deciders.Decider, error) {
+	var decider OnlyCreatorCanExpire
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
+		return nil, err
+	}
+
+	if decider.IdentityHeader == "" {
+		decider.IdentityHeader = deciders.DefaultIdentityHeader
+	}
+
+	return &decider, nil
+}
+
+// Decide implements deciders.Decider.
+func (o *OnlyCreatorCanExpire) Decide(req *http.Request) *deciders.HTTPError {
+	change, err := deciders.ParseSilenceChange(req)
+	if err != nil {
+		return deciders.SilenceChangeError(err)
+	}
+
+	if !change.IsExpire() {
+		return nil
+	}
+
+	identity := deciders.Identity(req, o.IdentityHeader)
+	if identity == "" {
+		return &deciders.HTTPError{
+			Status: http.StatusUnauthorized,
+			Err:    fmt.Sprintf("couldn't tell who is expiring the silence, because the %s header is missing", o.IdentityHeader),
+			Reason: "missing_identity",
+		}
+	}
+
+	if identity == change.Old.CreatedBy {
+		return nil
+	}
+
+	for _, admin := range o.Admins {
+		if identity == admin {
+			return nil
+		}
+	}
+
+	return &deciders.HTTPError{
+		Status: http.StatusForbidden,
+		Err:    fmt.Sprintf("silence %s can only be expired by its creator %q, or an admin", change.Old.ID, change.Old.CreatedBy),
+		Reason: "not_silence_creator",
+	}
+}
@@ -0,0 +1,103 @@
+package silenceexpiry_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/silenceexpiry"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnlyCreatorCanExpire(t *testing.T) {
+	fakeBackend := &testutil.FakeBackend{
+		Silences: []types.Silence{{ID: "abc", CreatedBy: "colin@example.com"}},
+	}
+
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(silenceexpiry.New), map[string]interface{}{
+		"admins": []string{"admin@example.com"},
+	})
+
+	testCases := []struct {
+		name           string
+		method         string
+		uri            string
+		body           string
+		user           string
+		backend        *testutil.FakeBackend
+		expectedStatus int
+	}{
+		{
+			name:   "Test creator can expire",
+			method: http.MethodDelete,
+			uri:    "/api/v2/silence/abc",
+			user:   "colin@example.com",
+		},
+		{
+			name:   "Test admins can expire",
+			method: http.MethodDelete,
+			uri:    "/api/v1/silence/abc",
+			user:   "admin@example.com",
+		},
+		{
+			name:           "Test others can't expire",
+			method:         http.MethodDelete,
+			uri:            "/api/v2/silence/abc",
+			user:           "mallory@example.com",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Test anonymous users can't expire",
+			method:         http.MethodDelete,
+			uri:            "/api/v2/silence/abc",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "Test missing silences are left to the backend",
+			method: http.MethodDelete,
+			uri:    "/api/v2/silence/def",
+			user:   "mallory@example.com",
+		},
+		{
+			name:   "Test creations are ignored",
+			method: http.MethodPost,
+			uri:    "/api/v2/silences",
+			body:   `{"createdBy": "mallory@example.com"}`,
+			user:   "mallory@example.com",
+		},
+		{
+			name:           "Test backend failures",
+			method:         http.MethodDelete,
+			uri:            "/api/v2/silence/abc",
+			user:           "colin@example.com",
+			backend:        &testutil.FakeBackend{Err: errors.New("connection refused")},
+			expectedStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := fakeBackend
+			if tt.backend != nil {
+				backend = tt.backend
+			}
+
+			req := testutil.WithBackend(testutil.MustMakeRequest(t, tt.method, tt.uri, tt.body), backend)
+			req.Header = http.Header{}
+			if tt.user != "" {
+				req.Header.Set(deciders.DefaultIdentityHeader, tt.user)
+			}
+
+			err := decider.Decide(req)
+			if tt.expectedStatus == 0 {
+				require.Nil(t, err)
+			} else {
+				require.NotNil(t, err)
+				require.Equal(t, tt.expectedStatus, err.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package silencequota
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/backend"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+const (
+	// KeyCreatedBy gives each author a quota, from the createdBy of the silences.
+	KeyCreatedBy = "createdBy"
+	// KeyLabelPrefix gives each value of a label a quota, from the equality matcher for it in the silences, e.g. "label:team".
+	KeyLabelPrefix = deciders.LabelKeyPrefix
+
+	defaultListSize = 5
+)
+
+// SilenceQuota is a Decider which limits how many active silences each value of Key can have at once. New silences that would
+// go over the quota are rejected, with a list of the ListSize oldest silences that could be expired to make room. Overrides
+// sets different quotas for specific values of Key.
+type SilenceQuota struct {
+	Key       string         `mapstructure:"key"`
+	Max       int            `mapstructure:"max"`
+	Overrides map[string]int `mapstructure:"overrides"`
+	ListSize  int            `mapstructure:"listSize"`
+}
+
+func New(config map[string]interface{}) (deciders.Decider, error) {
+	var decider SilenceQuota
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
+		return nil, err
+	}
+
+	if _, ok := deciders.ParseLabelKey(decider.Key); !ok && decider.Key != KeyCreatedBy {
+		return nil, fmt.Errorf("key must be %q, or %q followed by a label name, got %q", KeyCreatedBy, KeyLabelPrefix, decider.Key)
+	}
+
+	if decider.Max <= 0 {
+		return nil, fmt.Errorf("max must be set")
+	}
+
+	if decider.ListSize <= 0 {
+		decider.ListSize = defaultListSize
+	}
+
+	return &decider, nil
+}
+
+// Decide implements deciders.Decider.
+func (s *SilenceQuota) Decide(req *http.Request) *deciders.HTTPError {
+	silence, err := deciders.ParseSilence(req.Body)
+	if err != nil {
+		return &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    err.Error(),
+			Reason: deciders.ReasonInvalidRequest,
+		}
+	}
+
+	key, ok := s.key(silence)
+	if !ok {
+		return nil
+	}
+
+	client, ok := backend.FromContext(req.Context())
+	if !ok {
+		return deciders.SilenceChangeError(fmt.Errorf("%w: no backend to list silences from", deciders.ErrBackendUnavailable))
+	}
+
+	existing, err := client.ListSilences(req.Context())
+	if err != nil {
+		return deciders.SilenceChangeError(fmt.Errorf("%w: failed to list silences: %s", deciders.ErrBackendUnavailable, err))
+	}
+
+	now := time.Now()
+	var active []types.Silence
+	for _, other := range existing {
+		if !deciders.IsActive(other, now) {
+			continue
+		}
+
+		// Updates replace the silence they update, so they don't use any more of the quota, unless they move it to another key.
+		if silence.ID != "" && other.ID == silence.ID {
+			if otherKey, ok := s.key(other); ok && otherKey == key {
+				return nil
+			}
+
+			continue
+		}
+
+		if otherKey, ok := s.key(other); ok && otherKey == key {
+			active = append(active, other)
+		}
+	}
+
+	max := s.max(key)
+	if len(active) < max {
+		return nil
+	}
+
+	return &deciders.HTTPError{
+		Status: http.StatusForbidden,
+		Err:    fmt.Sprintf("%s %q already has %d active silences, the most allowed is %d. Consider expiring the oldest ones: %s", s.Key, key, len(active), max, s.oldest(active)),
+		Reason: "quota_exceeded",
+	}
+}
+
+// key returns the value of Key for the given silence, if it has one.
+func (s *SilenceQuota) key(silence types.Silence) (string, bool) {
+	if s.Key == KeyCreatedBy {
+		return silence.CreatedBy, silence.CreatedBy != ""
+	}
+
+	name, _ := deciders.ParseLabelKey(s.Key)
+	return deciders.LabelValue(silence, name)
+}
+
+func (s *SilenceQuota) max(key string) int {
+	if max, ok := s.Overrides[key]; ok {
+		return max
+	}
+
+	return s.Max
+}
+
+// oldest describes the ListSize silences that started first.
+func (s *SilenceQuota) oldest(silences []types.Silence) string {
+	sort.Slice(silences, func(i, j int) bool {
+		return silences[i].StartsAt.Before(silences[j].StartsAt)
+	})
+
+	if len(silences) > s.ListSize {
+		silences = silences[:s.ListSize]
+	}
+
+	descriptions := make([]string, 0, len(silences))
+	for _, silence := range silences {
+		descriptions = append(descriptions, fmt.Sprintf("%s %s (started %s)", silence.ID, silence.Matchers, silence.StartsAt.Format(time.RFC3339)))
+	}
+
+	return strings.Join(descriptions, ", ")
+}
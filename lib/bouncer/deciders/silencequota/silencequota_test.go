@@ -0,0 +1,124 @@
+package silencequota_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/silencequota"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func makeSilence(t *testing.T, id, author, team string, start time.Time, state types.SilenceState) types.Silence {
+	t.Helper()
+	matcher, err := labels.NewMatcher(labels.MatchEqual, "team", team)
+	require.NoError(t, err)
+	return types.Silence{
+		ID:        id,
+		CreatedBy: author,
+		Matchers:  labels.Matchers{matcher},
+		StartsAt:  start,
+		EndsAt:    start.Add(time.Hour),
+		Status:    types.SilenceStatus{State: state},
+	}
+}
+
+func TestSilenceQuota(t *testing.T) {
+	start := time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)
+	backend := &testutil.FakeBackend{
+		Silences: []types.Silence{
+			makeSilence(t, "newest", "colin", "infra", start.Add(2*time.Hour), types.SilenceStateActive),
+			makeSilence(t, "oldest", "someone", "infra", start, types.SilenceStateActive),
+			makeSilence(t, "middle", "colin", "infra", start.Add(time.Hour), types.SilenceStatePending),
+			makeSilence(t, "expired", "colin", "databases", start, types.SilenceStateExpired),
+			makeSilence(t, "storage", "colin", "storage", start, types.SilenceStateActive),
+		},
+	}
+
+	testCases := []struct {
+		name            string
+		config          map[string]interface{}
+		input           string
+		expectedSuccess bool
+		expectedError   string
+	}{
+		{
+			name:            "Test a team under quota can create silences",
+			config:          map[string]interface{}{"key": "label:team", "max": 4},
+			input:           `{"matchers":[{"name":"team","value":"infra","isRegex":false}],"createdBy":"colin"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test a team at quota is rejected with its oldest silences",
+			config:          map[string]interface{}{"key": "label:team", "max": 3, "listSize": 2},
+			input:           `{"matchers":[{"name":"team","value":"infra","isRegex":false}],"createdBy":"colin"}`,
+			expectedSuccess: false,
+			expectedError:   `label:team "infra" already has 3 active silences, the most allowed is 3. Consider expiring the oldest ones: oldest {team="infra"} (started 2020-01-19T00:00:00Z), middle {team="infra"} (started 2020-01-19T01:00:00Z)`,
+		},
+		{
+			name:            "Test overrides raise the quota",
+			config:          map[string]interface{}{"key": "label:team", "max": 3, "overrides": map[string]interface{}{"infra": 4}},
+			input:           `{"matchers":[{"name":"team","value":"infra","isRegex":false}],"createdBy":"colin"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test expired silences don't count",
+			config:          map[string]interface{}{"key": "label:team", "max": 1},
+			input:           `{"matchers":[{"name":"team","value":"databases","isRegex":false}],"createdBy":"colin"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test updating an active silence works at quota",
+			config:          map[string]interface{}{"key": "label:team", "max": 3},
+			input:           `{"id":"newest","matchers":[{"name":"team","value":"infra","isRegex":false}],"createdBy":"colin"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test updating a silence onto a team at quota is rejected",
+			config:          map[string]interface{}{"key": "label:team", "max": 3},
+			input:           `{"id":"storage","matchers":[{"name":"team","value":"infra","isRegex":false}],"createdBy":"colin"}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "Test an author at quota is rejected",
+			config:          map[string]interface{}{"key": "createdBy", "max": 2},
+			input:           `{"matchers":[{"name":"team","value":"databases","isRegex":false}],"createdBy":"colin"}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "Test silences without the key are ignored",
+			config:          map[string]interface{}{"key": "label:team", "max": 1},
+			input:           `{"matchers":[{"name":"alertname","value":"Foo","isRegex":false}],"createdBy":"colin"}`,
+			expectedSuccess: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(silencequota.New), tt.config)
+			req := testutil.WithBackend(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", tt.input), backend)
+			response := decider.Decide(req)
+			if tt.expectedSuccess {
+				require.Nil(t, response)
+			} else {
+				require.NotNil(t, response)
+				require.Equal(t, "quota_exceeded", response.Reason)
+				if tt.expectedError != "" {
+					require.Equal(t, tt.expectedError, response.Err)
+				}
+			}
+		})
+	}
+}
+
+func TestSilenceQuotaConfig(t *testing.T) {
+	_, err := silencequota.New(map[string]interface{}{"key": "createdBy"})
+	require.Error(t, err, "Expected a missing max to be rejected")
+
+	_, err = silencequota.New(map[string]interface{}{"key": "identity", "max": 1})
+	require.Error(t, err)
+}
@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/mitchellh/mapstructure"
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
 )
 
@@ -17,8 +16,7 @@ type SilencesHaveAuthor struct {
 
 func New(config map[string]interface{}) (deciders.Decider, error) {
 	var decider SilencesHaveAuthor
-	err := mapstructure.Decode(config, &decider)
-	if err != nil {
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
 		return nil, err
 	}
 
@@ -36,6 +34,7 @@ func (a *SilencesHaveAuthor) Decide(req *http.Request) *deciders.HTTPError {
 		return &deciders.HTTPError{
 			Status: 400,
 			Err:    "failed to parse silence",
+			Reason: deciders.ReasonInvalidRequest,
 		}
 	}
 
@@ -43,6 +42,7 @@ func (a *SilencesHaveAuthor) Decide(req *http.Request) *deciders.HTTPError {
 		return &deciders.HTTPError{
 			Status: 400,
 			Err:    fmt.Sprintf("creators must be %q emails. Got %q", a.Domain, silence.CreatedBy),
+			Reason: "invalid_author",
 		}
 	}
 
@@ -6,20 +6,23 @@ import (
 	"time"
 
 	"github.com/grafana/regexp"
-	"github.com/mitchellh/mapstructure"
+	"github.com/rs/zerolog/log"
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
 )
 
 type SilencesHaveTicket struct {
-	MaxLength   time.Duration `mapstructure:"maxLength"`
-	TicketRegex string        `mapstructure:"ticketRegex"`
+	MaxLength   time.Duration  `mapstructure:"maxLength"`
+	TicketRegex *regexp.Regexp `mapstructure:"ticketRegex"`
 
-	ticketRegex *regexp.Regexp
+	// Verify optionally checks that the tickets exist, and aren't closed, with the trackers API.
+	Verify *VerifyConfig `mapstructure:"verify"`
+
+	verifier *verifier
 }
 
 func New(config map[string]interface{}) (deciders.Decider, error) {
 	var decider SilencesHaveTicket
-	if err := mapstructure.Decode(config, &decider); err != nil {
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
 		return nil, err
 	}
 
@@ -27,14 +30,17 @@ func New(config map[string]interface{}) (deciders.Decider, error) {
 		return nil, fmt.Errorf("maxLength must be set")
 	}
 
-	if decider.TicketRegex == "" {
-		decider.ticketRegex = regexp.MustCompile("^[A-Z]+-[0-9]+")
-	} else {
-		regex, err := regexp.Compile(decider.TicketRegex)
+	if decider.TicketRegex == nil {
+		decider.TicketRegex = regexp.MustCompile("^[A-Z]+-[0-9]+")
+	}
+
+	if decider.Verify != nil {
+		verifier, err := newVerifier(*decider.Verify)
 		if err != nil {
-			return nil, fmt.Errorf("failed to compile ticketRegex: %s", err)
+			return nil, err
 		}
-		decider.ticketRegex = regex
+
+		decider.verifier = verifier
 	}
 
 	return &decider, nil
@@ -49,16 +55,68 @@ func (a *SilencesHaveTicket) Decide(req *http.Request) *deciders.HTTPError {
 		return &deciders.HTTPError{
 			Status: http.StatusBadRequest,
 			Err:    err.Error(),
+			Reason: deciders.ReasonInvalidRequest,
 		}
 	}
 
 	tooLong := silence.EndsAt.Sub(silence.StartsAt) > a.MaxLength
-	hasTicket := a.ticketRegex.MatchString(silence.Comment)
+	hasTicket := a.TicketRegex.MatchString(silence.Comment)
 
 	if tooLong && !hasTicket {
 		return &deciders.HTTPError{
 			Status: http.StatusBadRequest,
 			Err:    fmt.Sprintf("silences longer than %s must have tickets attached to them to track ongoing work", a.MaxLength),
+			Reason: "missing_ticket",
+		}
+	}
+
+	if tooLong && a.verifier != nil {
+		return a.verify(req, silence.Comment)
+	}
+
+	return nil
+}
+
+// verify checks that every ticket in the given comment exists, and isn't closed.
+func (a *SilencesHaveTicket) verify(req *http.Request, comment string) *deciders.HTTPError {
+	ids := a.verifier.ticketIDs(comment)
+	if len(ids) == 0 {
+		return &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    "failed to find any ticket IDs to verify in the comment",
+			Reason: "missing_ticket",
+		}
+	}
+
+	for _, id := range ids {
+		ticket, err := a.verifier.lookup(req.Context(), id)
+		if err != nil {
+			if a.verifier.config.FailurePolicy == FailurePolicyOpen {
+				log.Warn().Err(err).Str("ticket", id).Msg("Failed to verify ticket, allowing request due to failurePolicy open")
+				continue
+			}
+
+			return &deciders.HTTPError{
+				Status: http.StatusBadGateway,
+				Err:    fmt.Sprintf("failed to verify ticket %s: %s", id, err),
+				Reason: deciders.ReasonDeciderFailed,
+			}
+		}
+
+		if !ticket.exists {
+			return &deciders.HTTPError{
+				Status: http.StatusBadRequest,
+				Err:    fmt.Sprintf("ticket %s doesn't exist", id),
+				Reason: "invalid_ticket",
+			}
+		}
+
+		if a.verifier.isClosed(ticket.status) {
+			return &deciders.HTTPError{
+				Status: http.StatusBadRequest,
+				Err:    fmt.Sprintf("ticket %s is %s, silences need an open ticket to track ongoing work", id, ticket.status),
+				Reason: "closed_ticket",
+			}
 		}
 	}
 
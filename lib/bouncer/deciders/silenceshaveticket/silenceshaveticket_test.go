@@ -2,6 +2,7 @@ package silenceshaveticket_test
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -62,3 +63,133 @@ func TestLongSilencesHaveTicketDecider(t *testing.T) {
 		})
 	}
 }
+
+func TestLongSilencesHaveTicketVerification(t *testing.T) {
+	lookups := 0
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/tickets/OPS-1":
+			w.Write([]byte(`{"ticket": {"status": "In Progress"}}`))
+		case "/tickets/OPS-2":
+			w.Write([]byte(`{"ticket": {"status": "Closed"}}`))
+		case "/tickets/OPS-3":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/rest/api/2/issue/JIRA-1":
+			w.Write([]byte(`{"fields": {"status": {"statusCategory": {"key": "indeterminate"}}}}`))
+		case "/rest/api/2/issue/JIRA-2":
+			w.Write([]byte(`{"fields": {"status": {"statusCategory": {"key": "done"}}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer tracker.Close()
+
+	generic := func(failurePolicy string) map[string]interface{} {
+		return map[string]interface{}{
+			"maxLength": "8h",
+			"verify": map[string]interface{}{
+				"urlTemplate":   tracker.URL + "/tickets/{{.ID}}",
+				"statusPath":    "$.ticket.status",
+				"auth":          map[string]interface{}{"token": "secret"},
+				"failurePolicy": failurePolicy,
+			},
+		}
+	}
+
+	jira := map[string]interface{}{
+		"maxLength": "8h",
+		"verify": map[string]interface{}{
+			"type": "jira",
+			"url":  tracker.URL,
+			"auth": map[string]interface{}{"token": "secret"},
+		},
+	}
+
+	testCases := []struct {
+		name           string
+		config         map[string]interface{}
+		comment        string
+		expectedReason string
+	}{
+		{
+			name:    "Test open tickets work",
+			config:  generic(""),
+			comment: "OPS-1",
+		},
+		{
+			name:           "Test closed tickets are rejected",
+			config:         generic(""),
+			comment:        "OPS-1, see also OPS-2",
+			expectedReason: "closed_ticket",
+		},
+		{
+			name:           "Test tickets that don't exist are rejected",
+			config:         generic(""),
+			comment:        "OPS-404",
+			expectedReason: "invalid_ticket",
+		},
+		{
+			name:           "Test tracker failures are rejected by default",
+			config:         generic(""),
+			comment:        "OPS-3",
+			expectedReason: deciders.ReasonDeciderFailed,
+		},
+		{
+			name:    "Test tracker failures are allowed with failurePolicy open",
+			config:  generic("open"),
+			comment: "OPS-3",
+		},
+		{
+			name:    "Test open Jira tickets work",
+			config:  jira,
+			comment: "JIRA-1",
+		},
+		{
+			name:           "Test done Jira tickets are rejected",
+			config:         jira,
+			comment:        "JIRA-2",
+			expectedReason: "closed_ticket",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(silenceshaveticket.New), tt.config)
+			input := `{"startsAt":"2020-01-19T00:23:55.242Z", "endsAt":"2020-01-20T00:23:55.242Z", "comment": "` + tt.comment + `"}`
+			response := decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", input))
+			if tt.expectedReason == "" {
+				require.Nil(t, response)
+			} else {
+				require.NotNil(t, response)
+				require.Equal(t, tt.expectedReason, response.Reason)
+			}
+		})
+	}
+
+	t.Run("Test tickets are cached", func(t *testing.T) {
+		decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(silenceshaveticket.New), generic(""))
+		lookups = 0
+		for i := 0; i < 3; i++ {
+			input := `{"startsAt":"2020-01-19T00:23:55.242Z", "endsAt":"2020-01-20T00:23:55.242Z", "comment": "OPS-1"}`
+			require.Nil(t, decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", input)))
+		}
+		require.Equal(t, 1, lookups)
+	})
+}
+
+func TestLongSilencesHaveTicketVerificationConfig(t *testing.T) {
+	_, err := silenceshaveticket.New(map[string]interface{}{"maxLength": "8h", "verify": map[string]interface{}{"type": "jira"}})
+	require.Error(t, err, "Expected Jira without a URL to be rejected")
+
+	_, err = silenceshaveticket.New(map[string]interface{}{"maxLength": "8h", "verify": map[string]interface{}{}})
+	require.Error(t, err, "Expected a generic tracker without a URL template to be rejected")
+
+	_, err = silenceshaveticket.New(map[string]interface{}{"maxLength": "8h", "verify": map[string]interface{}{"urlTemplate": "http://example.com/{{.ID}}", "failurePolicy": "sometimes"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,305 @@
+package silenceshaveticket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/grafana/regexp"
+)
+
+const (
+	// TrackerGeneric looks tickets up at URLTemplate, and finds their status at StatusPath in the JSON response.
+	TrackerGeneric = "generic"
+	// TrackerJira looks tickets up with the Jira REST API at URL.
+	TrackerJira = "jira"
+
+	// FailurePolicyOpen accepts silences when the tracker can't be reached, or returns garbage.
+	FailurePolicyOpen = "open"
+	// FailurePolicyClosed rejects silences when the tracker can't be reached, or returns garbage.
+	FailurePolicyClosed = "closed"
+
+	defaultVerifyTimeout  = 10 * time.Second
+	defaultVerifyCacheTTL = 5 * time.Minute
+	defaultStatusPath     = "$.status"
+)
+
+var (
+	defaultTicketIDRegex  = regexp.MustCompile(`[A-Z][A-Z0-9]*-[0-9]+`)
+	defaultClosedStatuses = []string{"closed", "done", "resolved"}
+)
+
+// AuthConfig is how the verifier authenticates to the tracker. Username and Password are sent with basic auth, and Token as a bearer token.
+type AuthConfig struct {
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	Token    string `mapstructure:"token"`
+}
+
+// VerifyConfig configures checking that the tickets in silences exist, and aren't closed, with the trackers REST API.
+type VerifyConfig struct {
+	Type string `mapstructure:"type"`
+
+	// URL is the base URL of the tracker, for presets like Jira.
+	URL string `mapstructure:"url"`
+
+	// URLTemplate is a text/template for the URL that a ticket is fetched from, with the ID of the ticket in {{.ID}}.
+	URLTemplate string `mapstructure:"urlTemplate"`
+
+	// StatusPath is where the status of the ticket is in the JSON response, e.g. "$.fields.status.name".
+	StatusPath string `mapstructure:"statusPath"`
+
+	// ClosedStatuses are the statuses (compared case insensitively) that tickets can't be in.
+	ClosedStatuses []string `mapstructure:"closedStatuses"`
+
+	// TicketIDRegex finds all the ticket IDs in the comment of a silence.
+	TicketIDRegex *regexp.Regexp `mapstructure:"ticketIDRegex"`
+
+	Auth          AuthConfig    `mapstructure:"auth"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+	CacheTTL      time.Duration `mapstructure:"cacheTTL"`
+	FailurePolicy string        `mapstructure:"failurePolicy"`
+}
+
+// ticket is what we know about a ticket from the tracker.
+type ticket struct {
+	exists bool
+	status string
+}
+
+// verifier checks tickets against a tracker, remembering the answers for CacheTTL.
+type verifier struct {
+	config VerifyConfig
+	url    *template.Template
+	client *http.Client
+
+	lock  sync.Mutex
+	cache map[string]cachedTicket
+}
+
+type cachedTicket struct {
+	ticket  ticket
+	expires time.Time
+}
+
+func newVerifier(config VerifyConfig) (*verifier, error) {
+	switch config.Type {
+	case "", TrackerGeneric:
+		config.Type = TrackerGeneric
+	case TrackerJira:
+		if config.URL == "" {
+			return nil, fmt.Errorf("verify.url must be set for %q", TrackerJira)
+		}
+
+		if config.URLTemplate == "" {
+			config.URLTemplate = strings.TrimSuffix(config.URL, "/") + "/rest/api/2/issue/{{.ID | urlquery}}?fields=status"
+		}
+
+		if config.StatusPath == "" {
+			config.StatusPath = "$.fields.status.statusCategory.key"
+		}
+	default:
+		return nil, fmt.Errorf("verify.type must be either %q or %q, got %q", TrackerGeneric, TrackerJira, config.Type)
+	}
+
+	if config.URLTemplate == "" {
+		return nil, fmt.Errorf("verify.urlTemplate must be set")
+	}
+
+	urlTemplate, err := template.New("url").Parse(config.URLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verify.urlTemplate: %w", err)
+	}
+
+	switch config.FailurePolicy {
+	case "":
+		config.FailurePolicy = FailurePolicyClosed
+	case FailurePolicyOpen, FailurePolicyClosed:
+	default:
+		return nil, fmt.Errorf("verify.failurePolicy must be either %q or %q, got %q", FailurePolicyOpen, FailurePolicyClosed, config.FailurePolicy)
+	}
+
+	if config.StatusPath == "" {
+		config.StatusPath = defaultStatusPath
+	}
+
+	if len(config.ClosedStatuses) == 0 {
+		config.ClosedStatuses = defaultClosedStatuses
+	}
+
+	if config.TicketIDRegex == nil {
+		config.TicketIDRegex = defaultTicketIDRegex
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = defaultVerifyTimeout
+	}
+
+	if config.CacheTTL == 0 {
+		config.CacheTTL = defaultVerifyCacheTTL
+	}
+
+	return &verifier{
+		config: config,
+		url:    urlTemplate,
+		client: &http.Client{Timeout: config.Timeout},
+		cache:  make(map[string]cachedTicket),
+	}, nil
+}
+
+// ticketIDs returns the distinct ticket IDs in the given comment.
+func (v *verifier) ticketIDs(comment string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, id := range v.config.TicketIDRegex.FindAllString(comment, -1) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// isClosed returns whether the given status is one of the ClosedStatuses.
+func (v *verifier) isClosed(status string) bool {
+	for _, closed := range v.config.ClosedStatuses {
+		if strings.EqualFold(closed, status) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookup fetches the ticket with the given ID from the tracker, or the cache.
+func (v *verifier) lookup(ctx context.Context, id string) (ticket, error) {
+	v.lock.Lock()
+	cached, ok := v.cache[id]
+	v.lock.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.ticket, nil
+	}
+
+	t, err := v.fetch(ctx, id)
+	if err != nil {
+		return ticket{}, err
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	now := time.Now()
+	for k, entry := range v.cache {
+		if now.After(entry.expires) {
+			delete(v.cache, k)
+		}
+	}
+
+	v.cache[id] = cachedTicket{ticket: t, expires: now.Add(v.config.CacheTTL)}
+	return t, nil
+}
+
+func (v *verifier) fetch(ctx context.Context, id string) (ticket, error) {
+	var url strings.Builder
+	if err := v.url.Execute(&url, struct{ ID string }{ID: id}); err != nil {
+		return ticket{}, fmt.Errorf("failed to render the URL for ticket %s: %w", id, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return ticket{}, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if v.config.Auth.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+v.config.Auth.Token)
+	} else if v.config.Auth.Username != "" {
+		req.SetBasicAuth(v.config.Auth.Username, v.config.Auth.Password)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return ticket{}, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return ticket{exists: false}, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return ticket{}, fmt.Errorf("got status %d from tracker for ticket %s", resp.StatusCode, id)
+	}
+
+	var body interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return ticket{}, fmt.Errorf("failed to decode response from tracker for ticket %s: %w", id, err)
+	}
+
+	status, err := lookupPath(body, v.config.StatusPath)
+	if err != nil {
+		return ticket{}, fmt.Errorf("failed to find the status of ticket %s: %w", id, err)
+	}
+
+	return ticket{exists: true, status: fmt.Sprint(status)}, nil
+}
+
+// lookupPath finds the value at the given path in a decoded JSON document. Paths are a small subset of JSONPath: a leading "$",
+// followed by ".key" to look up a key in an object, and "[n]" to look up an index in an array, e.g. "$.fields.labels[0]".
+func lookupPath(doc interface{}, path string) (interface{}, error) {
+	rest := strings.TrimPrefix(path, "$")
+	current := doc
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+
+			key := rest[:end]
+			rest = rest[end:]
+			object, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("can't look up %q in a non-object", key)
+			}
+
+			if current, ok = object[key]; !ok {
+				return nil, fmt.Errorf("no key %q", key)
+			}
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, errors.New("unterminated [ in path")
+			}
+
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %q: %w", rest[1:end], err)
+			}
+
+			rest = rest[end+1:]
+			array, ok := current.([]interface{})
+			if !ok || index < 0 || index >= len(array) {
+				return nil, fmt.Errorf("no index %d", index)
+			}
+
+			current = array[index]
+		default:
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+	}
+
+	return current, nil
+}
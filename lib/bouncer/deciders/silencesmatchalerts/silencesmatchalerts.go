@@ -0,0 +1,165 @@
+package silencesmatchalerts
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/backend"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultOverrideTag = "#no-alerts-ok"
+
+// SilencesMatchAlerts is a Decider which rejects silences that don't match any of the alerts in the backend, which usually means
+// that there's a typo in the matchers. If RuleFiles is set, silences whose alertname matches one of the alerts defined in the
+// Prometheus rule files are also allowed, so that people can silence alerts before they fire. Silences with OverrideTag in their
+// comment are always allowed.
+type SilencesMatchAlerts struct {
+	RuleFiles   []string `mapstructure:"ruleFiles"`
+	OverrideTag string   `mapstructure:"overrideTag"`
+
+	knownAlerts []string
+}
+
+// ruleFile is the part of a Prometheus rule file that we care about.
+type ruleFile struct {
+	Groups []struct {
+		Rules []struct {
+			Alert string `yaml:"alert"`
+		} `yaml:"rules"`
+	} `yaml:"groups"`
+}
+
+func New(config map[string]interface{}) (deciders.Decider, error) {
+	var decider SilencesMatchAlerts
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
+		return nil, err
+	}
+
+	if decider.OverrideTag == "" {
+		decider.OverrideTag = defaultOverrideTag
+	}
+
+	knownAlerts, err := loadAlertNames(decider.RuleFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	decider.knownAlerts = knownAlerts
+	return &decider, nil
+}
+
+// loadAlertNames returns the names of all the alerting rules in the rule files that match the given globs.
+func loadAlertNames(globs []string) ([]string, error) {
+	var names []string
+	for _, glob := range globs {
+		paths, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule file glob %q: %w", glob, err)
+		}
+
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no rule files match %q", glob)
+		}
+
+		for _, path := range paths {
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read rule file: %w", err)
+			}
+
+			var rules ruleFile
+			if err := yaml.Unmarshal(contents, &rules); err != nil {
+				return nil, fmt.Errorf("failed to parse rule file %s: %w", path, err)
+			}
+
+			for _, group := range rules.Groups {
+				for _, rule := range group.Rules {
+					if rule.Alert != "" {
+						names = append(names, rule.Alert)
+					}
+				}
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// Decide implements deciders.Decider.
+func (s *SilencesMatchAlerts) Decide(req *http.Request) *deciders.HTTPError {
+	silence, err := deciders.ParseSilence(req.Body)
+	if err != nil {
+		return &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    err.Error(),
+			Reason: deciders.ReasonInvalidRequest,
+		}
+	}
+
+	if strings.Contains(silence.Comment, s.OverrideTag) {
+		return nil
+	}
+
+	client, ok := backend.FromContext(req.Context())
+	if !ok {
+		return deciders.SilenceChangeError(fmt.Errorf("%w: no backend to list alerts from", deciders.ErrBackendUnavailable))
+	}
+
+	alerts, err := client.ListAlerts(req.Context())
+	if err != nil {
+		return deciders.SilenceChangeError(fmt.Errorf("%w: failed to list alerts: %s", deciders.ErrBackendUnavailable, err))
+	}
+
+	for _, alert := range alerts {
+		if silence.Matchers.Matches(alert.Labels) {
+			return nil
+		}
+	}
+
+	if s.matchesKnownAlert(silence) {
+		return nil
+	}
+
+	return &deciders.HTTPError{
+		Status: http.StatusBadRequest,
+		Err:    fmt.Sprintf("silence %s doesn't match any alerts. Check the matchers for typos, or add %q to the comment to create it anyway", silence.Matchers, s.OverrideTag),
+		Reason: "matches_no_alerts",
+	}
+}
+
+// matchesKnownAlert returns whether the alertname matchers of the given silence match any of the alerts in the rule files.
+// Rule files don't say what other labels alerts will have, so the rest of the matchers are ignored, and silences without
+// an alertname matcher never match.
+func (s *SilencesMatchAlerts) matchesKnownAlert(silence types.Silence) bool {
+	hasAlertName := false
+	for _, matcher := range silence.Matchers {
+		hasAlertName = hasAlertName || matcher.Name == model.AlertNameLabel
+	}
+
+	if !hasAlertName {
+		return false
+	}
+
+	for _, name := range s.knownAlerts {
+		matches := true
+		for _, matcher := range silence.Matchers {
+			if matcher.Name == model.AlertNameLabel && !matcher.Matches(name) {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			return true
+		}
+	}
+
+	return false
+}
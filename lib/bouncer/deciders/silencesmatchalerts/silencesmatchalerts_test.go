@@ -0,0 +1,108 @@
+package silencesmatchalerts_test
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/silencesmatchalerts"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const rules = `groups:
+  - name: example
+    rules:
+      - alert: DiskFull
+        expr: disk_free < 0.1
+      - record: job:up:sum
+        expr: sum(up) by (job)
+`
+
+func TestSilencesMatchAlerts(t *testing.T) {
+	ruleFile := filepath.Join(t.TempDir(), "rules.yml")
+	require.NoError(t, os.WriteFile(ruleFile, []byte(rules), 0o600))
+
+	backend := &testutil.FakeBackend{
+		Alerts: []model.Alert{{Labels: model.LabelSet{"alertname": "Foo", "cluster": "prod"}}},
+	}
+
+	testCases := []struct {
+		name            string
+		config          map[string]interface{}
+		input           string
+		expectedSuccess bool
+	}{
+		{
+			name:            "Test a silence matching a firing alert works",
+			config:          map[string]interface{}{},
+			input:           `{"matchers":[{"name":"alertname","value":"Foo","isRegex":false}],"comment":"testing"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test a silence with a typo is rejected",
+			config:          map[string]interface{}{},
+			input:           `{"matchers":[{"name":"alertname","value":"Fooo","isRegex":false}],"comment":"testing"}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "Test a silence with the override tag works",
+			config:          map[string]interface{}{},
+			input:           `{"matchers":[{"name":"alertname","value":"Fooo","isRegex":false}],"comment":"testing #no-alerts-ok"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test a custom override tag works",
+			config:          map[string]interface{}{"overrideTag": "[override]"},
+			input:           `{"matchers":[{"name":"alertname","value":"Fooo","isRegex":false}],"comment":"[override] testing"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test a silence matching an alert in the rule files works",
+			config:          map[string]interface{}{"ruleFiles": []string{ruleFile}},
+			input:           `{"matchers":[{"name":"alertname","value":"DiskFull","isRegex":false},{"name":"cluster","value":"prod","isRegex":false}],"comment":"testing"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test recording rules aren't known alerts",
+			config:          map[string]interface{}{"ruleFiles": []string{ruleFile}},
+			input:           `{"matchers":[{"name":"alertname","value":"job:up:sum","isRegex":false}],"comment":"testing"}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "Test a silence without an alertname doesn't match the rule files",
+			config:          map[string]interface{}{"ruleFiles": []string{ruleFile}},
+			input:           `{"matchers":[{"name":"cluster","value":"prdo","isRegex":false}],"comment":"testing"}`,
+			expectedSuccess: false,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(silencesmatchalerts.New), tt.config)
+			req := testutil.WithBackend(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", tt.input), backend)
+			response := decider.Decide(req)
+			if tt.expectedSuccess {
+				require.Nil(t, response)
+			} else {
+				require.NotNil(t, response)
+				require.Equal(t, "matches_no_alerts", response.Reason)
+			}
+		})
+	}
+}
+
+func TestSilencesMatchAlertsErrors(t *testing.T) {
+	_, err := silencesmatchalerts.New(map[string]interface{}{"ruleFiles": []string{filepath.Join(t.TempDir(), "*.yml")}})
+	require.Error(t, err)
+
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(silencesmatchalerts.New), map[string]interface{}{})
+	req := testutil.WithBackend(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"matchers":[]}`), &testutil.FakeBackend{Err: errors.New("broken")})
+	response := decider.Decide(req)
+	require.NotNil(t, response)
+	require.Equal(t, http.StatusBadGateway, response.Status)
+}
@@ -11,7 +11,12 @@ type SilencesNotOnWeekends struct {
 }
 
 func New(config map[string]interface{}) (deciders.Decider, error) {
-	return &SilencesNotOnWeekends{}, nil
+	var decider SilencesNotOnWeekends
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
+		return nil, err
+	}
+
+	return &decider, nil
 }
 
 // SilencesNotOnWeekendsDecider returns a decider that rejects silences that do not have authors which end in the given domain string.
@@ -21,6 +26,7 @@ func (a *SilencesNotOnWeekends) Decide(req *http.Request) *deciders.HTTPError {
 		return &deciders.HTTPError{
 			Status: http.StatusBadRequest,
 			Err:    err.Error(),
+			Reason: deciders.ReasonInvalidRequest,
 		}
 	}
 
@@ -29,6 +35,7 @@ func (a *SilencesNotOnWeekends) Decide(req *http.Request) *deciders.HTTPError {
 		return &deciders.HTTPError{
 			Status: http.StatusBadRequest,
 			Err:    "by policy, silences can't expire on weekends. Be nice to people oncall over the weekend!",
+			Reason: "expires_on_weekend",
 		}
 	}
 
@@ -0,0 +1,305 @@
+package silencetemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+var _ = deciders.Mutator(&SilenceTemplate{})
+
+// SilenceTemplate is a Mutator which fills in fields of silences from text/templates, so that automation can submit minimal silences
+// and have the rest filled in from the request, e.g. the author from the authenticated user, or a matcher from a tenant header.
+// Templates are executed with Data. Each template that renders to something other than whitespace replaces its field, so templates
+// that should only fill in empty fields have to say so, e.g. `{{ or .Silence.CreatedBy .Identity }}`.
+type SilenceTemplate struct {
+	CreatedBy string `mapstructure:"createdBy"`
+	Comment   string `mapstructure:"comment"`
+
+	// DefaultDuration is how long silences without an end time last. Silences without a start time start now.
+	DefaultDuration time.Duration `mapstructure:"defaultDuration"`
+
+	// Matchers are added to silences that don't already have a matcher for the same label.
+	Matchers []MatcherTemplate `mapstructure:"matchers"`
+
+	IdentityHeader string `mapstructure:"identityHeader"`
+
+	createdBy *template.Template
+	comment   *template.Template
+	matchers  []*template.Template
+}
+
+// MatcherTemplate is a matcher to add to silences. Its value is a template, and it isn't added if the value renders to nothing.
+type MatcherTemplate struct {
+	Name    string `mapstructure:"name"`
+	Value   string `mapstructure:"value"`
+	IsRegex bool   `mapstructure:"isRegex"`
+}
+
+// Data is what templates are executed with.
+type Data struct {
+	// Silence is the silence from the request, before any of its fields have been filled in.
+	Silence types.Silence
+
+	// Identity is the authenticated user making the request, from IdentityHeader.
+	Identity string
+
+	// Method and Path are from the request.
+	Method string
+	Path   string
+
+	// Now is when the request was received.
+	Now time.Time
+
+	header http.Header
+}
+
+// Header returns the first value of the given header in the request, e.g. `{{ .Header "X-Ticket" }}`.
+func (d Data) Header(name string) string {
+	return d.header.Get(name)
+}
+
+// Label returns the value that the silence requires the given label to have, e.g. `{{ .Label "alertname" }}`, or an empty string
+// if it doesn't have an equality matcher for it.
+func (d Data) Label(name string) string {
+	for _, matcher := range d.Silence.Matchers {
+		if matcher.Name == name && matcher.Type == labels.MatchEqual {
+			return matcher.Value
+		}
+	}
+
+	return ""
+}
+
+func New(config map[string]interface{}) (deciders.Mutator, error) {
+	var mutator SilenceTemplate
+	if err := deciders.DecodeConfig(config, &mutator); err != nil {
+		return nil, err
+	}
+
+	if mutator.DefaultDuration < 0 {
+		return nil, fmt.Errorf("defaultDuration must be positive, got %s", mutator.DefaultDuration)
+	}
+
+	var err error
+	if mutator.createdBy, err = parseTemplate("createdBy", mutator.CreatedBy); err != nil {
+		return nil, err
+	}
+
+	if mutator.comment, err = parseTemplate("comment", mutator.Comment); err != nil {
+		return nil, err
+	}
+
+	for i, matcher := range mutator.Matchers {
+		if matcher.Name == "" {
+			return nil, fmt.Errorf("matchers[%d].name must be set", i)
+		}
+
+		if matcher.Value == "" {
+			return nil, fmt.Errorf("matchers[%d].value must be set", i)
+		}
+
+		tmpl, err := parseTemplate(fmt.Sprintf("matchers[%d].value", i), matcher.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		mutator.matchers = append(mutator.matchers, tmpl)
+	}
+
+	return &mutator, nil
+}
+
+// parseTemplate parses the given template, returning nil if it's empty.
+func parseTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+
+	return tmpl, nil
+}
+
+// Mutate implements deciders.Mutator.
+func (s *SilenceTemplate) Mutate(req *http.Request, body []byte) ([]byte, *deciders.HTTPError) {
+	// Requests without a body, e.g. expiring a silence, have nothing to fill in.
+	if len(body) == 0 {
+		return body, nil
+	}
+
+	// We only change the fields that the templates are for, so that fields the bouncer doesn't know about make it to the backend.
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, invalidSilence(err)
+	}
+
+	var silence types.Silence
+	if err := json.Unmarshal(body, &silence); err != nil {
+		return nil, invalidSilence(err)
+	}
+
+	data := Data{
+		Silence:  silence,
+		Identity: deciders.Identity(req, s.IdentityHeader),
+		Method:   req.Method,
+		Path:     req.URL.Path,
+		Now:      time.Now().UTC(),
+		header:   req.Header,
+	}
+
+	if err := s.fill(fields, data); err != nil {
+		return nil, &deciders.HTTPError{
+			Status: http.StatusInternalServerError,
+			Err:    err.Error(),
+			Reason: deciders.ReasonDeciderFailed,
+		}
+	}
+
+	mutated, err := json.Marshal(fields)
+	if err != nil {
+		return nil, &deciders.HTTPError{
+			Status: http.StatusInternalServerError,
+			Err:    fmt.Sprintf("failed to encode silence: %s", err),
+			Reason: deciders.ReasonDeciderFailed,
+		}
+	}
+
+	return mutated, nil
+}
+
+// fill sets the fields of the silence that the templates are for.
+func (s *SilenceTemplate) fill(fields map[string]json.RawMessage, data Data) error {
+	if err := setTemplated(fields, "createdBy", s.createdBy, data); err != nil {
+		return err
+	}
+
+	if err := setTemplated(fields, "comment", s.comment, data); err != nil {
+		return err
+	}
+
+	if s.DefaultDuration > 0 && data.Silence.EndsAt.IsZero() {
+		startsAt := data.Silence.StartsAt
+		if startsAt.IsZero() {
+			startsAt = data.Now
+			if err := set(fields, "startsAt", startsAt); err != nil {
+				return err
+			}
+		}
+
+		if err := set(fields, "endsAt", startsAt.Add(s.DefaultDuration)); err != nil {
+			return err
+		}
+	}
+
+	return s.addMatchers(fields, data)
+}
+
+// addMatchers adds the configured matchers for labels that the silence doesn't already have a matcher for.
+func (s *SilenceTemplate) addMatchers(fields map[string]json.RawMessage, data Data) error {
+	if len(s.Matchers) == 0 {
+		return nil
+	}
+
+	matchers := append(labels.Matchers{}, data.Silence.Matchers...)
+	added := false
+	for i, config := range s.Matchers {
+		if hasMatcher(matchers, config.Name) {
+			continue
+		}
+
+		value, err := render(s.matchers[i], data)
+		if err != nil {
+			return err
+		}
+
+		if value == "" {
+			continue
+		}
+
+		matchType := labels.MatchEqual
+		if config.IsRegex {
+			matchType = labels.MatchRegexp
+		}
+
+		matcher, err := labels.NewMatcher(matchType, config.Name, value)
+		if err != nil {
+			return fmt.Errorf("invalid matcher for %q: %w", config.Name, err)
+		}
+
+		matchers = append(matchers, matcher)
+		added = true
+	}
+
+	if !added {
+		return nil
+	}
+
+	return set(fields, "matchers", matchers)
+}
+
+func hasMatcher(matchers labels.Matchers, name string) bool {
+	for _, matcher := range matchers {
+		if matcher.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setTemplated sets the given field to the output of the given template, unless the template is nil, or renders to nothing.
+func setTemplated(fields map[string]json.RawMessage, field string, tmpl *template.Template, data Data) error {
+	if tmpl == nil {
+		return nil
+	}
+
+	value, err := render(tmpl, data)
+	if err != nil {
+		return err
+	}
+
+	if value == "" {
+		return nil
+	}
+
+	return set(fields, field, value)
+}
+
+// render executes the given template, trimming whitespace from the output so that templates can be written as YAML block scalars.
+func render(tmpl *template.Template, data Data) (string, error) {
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to execute %s template: %w", tmpl.Name(), err)
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
+
+func set(fields map[string]json.RawMessage, field string, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", field, err)
+	}
+
+	fields[field] = encoded
+	return nil
+}
+
+func invalidSilence(err error) *deciders.HTTPError {
+	return &deciders.HTTPError{
+		Status: http.StatusBadRequest,
+		Err:    fmt.Sprintf("failed to decode silence: %s", err),
+		Reason: deciders.ReasonInvalidRequest,
+	}
+}
@@ -0,0 +1,129 @@
+package silencetemplate_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/silencetemplate"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSilenceTemplate(t *testing.T) {
+	mutator, err := silencetemplate.New(map[string]interface{}{
+		"createdBy":       "{{ or .Silence.CreatedBy .Identity }}",
+		"comment":         `{{ .Silence.Comment }}{{ with .Header "X-Ticket" }} ({{ . }}){{ end }}`,
+		"defaultDuration": "2h",
+		"matchers": []map[string]interface{}{
+			{"name": "cluster", "value": `{{ .Header "X-Tenant" }}`},
+		},
+	})
+	require.NoError(t, err)
+
+	startsAt := time.Date(2023, 4, 5, 10, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name              string
+		body              string
+		headers           map[string]string
+		expectedCreatedBy string
+		expectedComment   string
+		expectedMatchers  string
+		expectedDuration  time.Duration
+	}{
+		{
+			name:              "Test minimal silences are filled in from the request",
+			body:              `{"matchers":[{"name":"alertname","value":"InstanceDown","isRegex":false}],"startsAt":"2023-04-05T10:00:00Z","comment":"Disk swap"}`,
+			headers:           map[string]string{deciders.DefaultIdentityHeader: "colin@example.com", "X-Ticket": "OPS-123", "X-Tenant": "prod-1"},
+			expectedCreatedBy: "colin@example.com",
+			expectedComment:   "Disk swap (OPS-123)",
+			expectedMatchers:  `{alertname="InstanceDown",cluster="prod-1"}`,
+			expectedDuration:  2 * time.Hour,
+		},
+		{
+			name:              "Test fields that are already set are kept",
+			body:              `{"matchers":[{"name":"cluster","value":"prod-2","isRegex":false}],"startsAt":"2023-04-05T10:00:00Z","endsAt":"2023-04-05T10:30:00Z","createdBy":"automation","comment":"Deploy"}`,
+			headers:           map[string]string{deciders.DefaultIdentityHeader: "colin@example.com", "X-Tenant": "prod-1"},
+			expectedCreatedBy: "automation",
+			expectedComment:   "Deploy",
+			expectedMatchers:  `{cluster="prod-2"}`,
+			expectedDuration:  30 * time.Minute,
+		},
+		{
+			name:              "Test templates that render to nothing don't change anything",
+			body:              `{"matchers":[{"name":"alertname","value":"InstanceDown","isRegex":false}],"startsAt":"2023-04-05T10:00:00Z","comment":"Disk swap"}`,
+			expectedCreatedBy: "",
+			expectedComment:   "Disk swap",
+			expectedMatchers:  `{alertname="InstanceDown"}`,
+			expectedDuration:  2 * time.Hour,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", tt.body)
+			req.Header = http.Header{}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			body, rejection := mutator.Mutate(req, []byte(tt.body))
+			require.Nil(t, rejection)
+
+			var silence types.Silence
+			require.NoError(t, json.Unmarshal(body, &silence))
+			require.Equal(t, tt.expectedCreatedBy, silence.CreatedBy)
+			require.Equal(t, tt.expectedComment, silence.Comment)
+			require.Equal(t, tt.expectedMatchers, silence.Matchers.String())
+			require.True(t, startsAt.Equal(silence.StartsAt))
+			require.Equal(t, tt.expectedDuration, silence.EndsAt.Sub(silence.StartsAt))
+		})
+	}
+}
+
+func TestSilenceTemplateKeepsUnknownFields(t *testing.T) {
+	mutator, err := silencetemplate.New(map[string]interface{}{
+		"comment":         `Silencing {{ .Label "alertname" }}`,
+		"defaultDuration": "1h",
+	})
+	require.NoError(t, err)
+
+	input := `{"matchers":[{"name":"alertname","value":"InstanceDown","isRegex":false}],"somethingNew":{"a":1}}`
+	before := time.Now()
+	body, rejection := mutator.Mutate(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", input), []byte(input))
+	require.Nil(t, rejection)
+
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(body, &fields))
+	require.JSONEq(t, `{"a":1}`, string(fields["somethingNew"]))
+	require.JSONEq(t, `"Silencing InstanceDown"`, string(fields["comment"]))
+
+	var silence types.Silence
+	require.NoError(t, json.Unmarshal(body, &silence))
+	require.False(t, silence.StartsAt.Before(before.Truncate(time.Second)), "Expected silences without a start time to start now")
+	require.Equal(t, time.Hour, silence.EndsAt.Sub(silence.StartsAt))
+}
+
+func TestSilenceTemplateErrors(t *testing.T) {
+	_, err := silencetemplate.New(map[string]interface{}{"comment": "{{ .Silence"})
+	require.Error(t, err, "Expected invalid templates to be rejected")
+
+	_, err = silencetemplate.New(map[string]interface{}{"matchers": []map[string]interface{}{{"value": "prod"}}})
+	require.Error(t, err, "Expected matchers without names to be rejected")
+
+	mutator, err := silencetemplate.New(map[string]interface{}{"createdBy": "{{ .Identity }}"})
+	require.NoError(t, err)
+
+	input := "not a silence"
+	_, rejection := mutator.Mutate(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", input), []byte(input))
+	require.NotNil(t, rejection)
+	require.Equal(t, http.StatusBadRequest, rejection.Status)
+	require.Equal(t, deciders.ReasonInvalidRequest, rejection.Reason)
+
+	body, rejection := mutator.Mutate(testutil.MustMakeRequest(t, http.MethodDelete, "/api/v2/silence/abc", ""), nil)
+	require.Nil(t, rejection, "Expected requests without a body to be left alone")
+	require.Empty(t, body)
+}
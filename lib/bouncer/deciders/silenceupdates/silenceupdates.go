@@ -0,0 +1,57 @@
+package silenceupdates
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+// UpdatesDontExceedMaxDuration is a Decider which rejects updates that extend a silence so that it lasts longer than MaxDuration,
+// measured from when the original silence started. This stops people from getting around limits on the length of silences by
+// creating a short silence, and then extending it.
+type UpdatesDontExceedMaxDuration struct {
+	MaxDuration time.Duration `mapstructure:"maxDuration"`
+}
+
+func New(config map[string]interface{}) (deciders.Decider, error) {
+	var decider UpdatesDontExceedMaxDuration
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
+		return nil, err
+	}
+
+	if decider.MaxDuration <= 0 {
+		return nil, fmt.Errorf("maxDuration must be set")
+	}
+
+	return &decider, nil
+}
+
+// Decide implements deciders.Decider.
+func (u *UpdatesDontExceedMaxDuration) Decide(req *http.Request) *deciders.HTTPError {
+	change, err := deciders.ParseSilenceChange(req)
+	if err != nil {
+		return deciders.SilenceChangeError(err)
+	}
+
+	if !change.IsUpdate() || !change.New.EndsAt.After(change.Old.EndsAt) {
+		return nil
+	}
+
+	// Updates to silences that haven't started yet can move their start time, so measure from whichever start is earlier.
+	start := change.Old.StartsAt
+	if change.New.StartsAt.Before(start) {
+		start = change.New.StartsAt
+	}
+
+	if change.New.EndsAt.Sub(start) > u.MaxDuration {
+		return &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    fmt.Sprintf("silence %s can't be extended past %s from when it started", change.Old.ID, u.MaxDuration),
+			Reason: "silence_too_long",
+		}
+	}
+
+	return nil
+}
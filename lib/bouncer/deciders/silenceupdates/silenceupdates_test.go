@@ -0,0 +1,62 @@
+package silenceupdates_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/silenceupdates"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdatesDontExceedMaxDuration(t *testing.T) {
+	start := time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)
+	backend := &testutil.FakeBackend{
+		Silences: []types.Silence{{ID: "abc", StartsAt: start, EndsAt: start.Add(4 * time.Hour)}},
+	}
+
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(silenceupdates.New), map[string]interface{}{"maxDuration": "8h"})
+
+	testCases := []struct {
+		name            string
+		input           string
+		expectedSuccess bool
+	}{
+		{
+			name:            "Test extending within the max duration works",
+			input:           `{"id": "abc", "startsAt": "2020-01-19T02:00:00Z", "endsAt": "2020-01-19T08:00:00Z"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test extending past the max duration from the original start is rejected",
+			input:           `{"id": "abc", "startsAt": "2020-01-19T02:00:00Z", "endsAt": "2020-01-19T09:00:00Z"}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "Test shortening works",
+			input:           `{"id": "abc", "startsAt": "2020-01-17T00:00:00Z", "endsAt": "2020-01-19T03:00:00Z"}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Test new silences are ignored",
+			input:           `{"startsAt": "2020-01-19T00:00:00Z", "endsAt": "2020-01-29T00:00:00Z"}`,
+			expectedSuccess: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := testutil.WithBackend(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", tt.input), backend)
+			response := decider.Decide(req)
+			if tt.expectedSuccess {
+				require.Nil(t, response)
+			} else {
+				require.NotNil(t, response)
+				require.Equal(t, "silence_too_long", response.Reason)
+			}
+		})
+	}
+}
@@ -4,10 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
+	"github.com/prometheus/alertmanager/pkg/labels"
 	"github.com/prometheus/alertmanager/types"
 )
 
+// LabelKeyPrefix is the prefix of keys that pick out the value of a label in a silence, e.g. "label:team".
+const LabelKeyPrefix = "label:"
+
 func ParseSilence(body io.ReadCloser) (types.Silence, error) {
 	silence := types.Silence{}
 	if err := json.NewDecoder(body).Decode(&silence); err != nil {
@@ -16,3 +22,29 @@ func ParseSilence(body io.ReadCloser) (types.Silence, error) {
 
 	return silence, nil
 }
+
+// IsActive returns whether the given silence is active, or pending, at the given time.
+func IsActive(silence types.Silence, now time.Time) bool {
+	if silence.Status.State != "" {
+		return silence.Status.State != types.SilenceStateExpired
+	}
+
+	return silence.EndsAt.After(now)
+}
+
+// ParseLabelKey returns the name of the label in a key like "label:team", or false if the key isn't one.
+func ParseLabelKey(key string) (string, bool) {
+	name := strings.TrimPrefix(key, LabelKeyPrefix)
+	return name, name != key && name != ""
+}
+
+// LabelValue returns the value of the equality matcher for the given label in the silence, or false if it doesn't have one.
+func LabelValue(silence types.Silence, name string) (string, bool) {
+	for _, matcher := range silence.Matchers {
+		if matcher.Name == name && matcher.Type == labels.MatchEqual {
+			return matcher.Value, true
+		}
+	}
+
+	return "", false
+}
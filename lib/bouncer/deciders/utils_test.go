@@ -0,0 +1,70 @@
+package deciders_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsActive(t *testing.T) {
+	now := time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name           string
+		silence        types.Silence
+		expectedOutput bool
+	}{
+		{
+			name:           "Test the state is used when it's set",
+			silence:        types.Silence{EndsAt: now.Add(time.Hour), Status: types.SilenceStatus{State: types.SilenceStateExpired}},
+			expectedOutput: false,
+		},
+		{
+			name:           "Test pending silences are active",
+			silence:        types.Silence{EndsAt: now.Add(-time.Hour), Status: types.SilenceStatus{State: types.SilenceStatePending}},
+			expectedOutput: true,
+		},
+		{
+			name:           "Test the end time is used without a state",
+			silence:        types.Silence{EndsAt: now.Add(-time.Hour)},
+			expectedOutput: false,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expectedOutput, deciders.IsActive(tt.silence, now))
+		})
+	}
+}
+
+func TestParseLabelKey(t *testing.T) {
+	name, ok := deciders.ParseLabelKey("label:team")
+	require.True(t, ok)
+	require.Equal(t, "team", name)
+
+	_, ok = deciders.ParseLabelKey("label:")
+	require.False(t, ok, "Expected a key without a label name to be rejected")
+
+	_, ok = deciders.ParseLabelKey("createdBy")
+	require.False(t, ok)
+}
+
+func TestLabelValue(t *testing.T) {
+	silence := types.Silence{
+		Matchers: labels.Matchers{
+			{Type: labels.MatchRegexp, Name: "team", Value: "infra|databases"},
+			{Type: labels.MatchEqual, Name: "alertname", Value: "Foo"},
+		},
+	}
+
+	value, ok := deciders.LabelValue(silence, "alertname")
+	require.True(t, ok)
+	require.Equal(t, "Foo", value)
+
+	_, ok = deciders.LabelValue(silence, "team")
+	require.False(t, ok, "Expected regex matchers to be ignored")
+}
@@ -0,0 +1,255 @@
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+const (
+	// FailurePolicyOpen accepts requests when the module fails, e.g. by trapping or running out of time.
+	FailurePolicyOpen = "open"
+	// FailurePolicyClosed rejects requests when the module fails, e.g. by trapping or running out of time.
+	FailurePolicyClosed = "closed"
+
+	defaultTimeout     = time.Second
+	defaultMaxMemoryMB = 16
+
+	// wasmPagesPerMB is the number of 64KiB WebAssembly pages in a MiB.
+	wasmPagesPerMB = 16
+)
+
+var _ = deciders.Decider(&Wasm{})
+
+// Wasm is a Decider which runs a policy compiled to WebAssembly in a sandbox. Every request gets a fresh instance of the module,
+// so modules can't keep state between calls, and each call is limited in both memory and execution time.
+//
+// Modules must export:
+//   - memory: their linear memory.
+//   - alloc(size i32) -> i32: which returns a pointer to size bytes of memory that the request can be written into.
+//   - decide(ptr i32, len i32) -> i64: which takes the JSON encoded Input at ptr, and returns a pointer to a JSON encoded Verdict
+//     in the upper 32 bits of the result, and its length in the lower 32 bits.
+type Wasm struct {
+	Path          string        `mapstructure:"path"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+	MaxMemoryMB   uint32        `mapstructure:"maxMemoryMB"`
+	FailurePolicy string        `mapstructure:"failurePolicy"`
+
+	// Headers are the request headers that are passed to the module, defaulting to deciders.DefaultForwardedHeaders.
+	Headers []string `mapstructure:"headers"`
+
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+}
+
+// Input is the JSON document that is passed to the modules decide function.
+type Input struct {
+	Method  string              `json:"method"`
+	URI     string              `json:"uri"`
+	Headers map[string][]string `json:"headers,omitempty"`
+
+	// Body is the body of the request (usually a silence), if it is valid JSON.
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// Verdict is the JSON document that the modules decide function is expected to return.
+type Verdict struct {
+	Allowed bool   `json:"allowed"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+}
+
+func New(config map[string]interface{}) (deciders.Decider, error) {
+	var decider Wasm
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
+		return nil, err
+	}
+
+	if decider.Path == "" {
+		return nil, fmt.Errorf("path must be set")
+	}
+
+	switch decider.FailurePolicy {
+	case "":
+		decider.FailurePolicy = FailurePolicyClosed
+	case FailurePolicyOpen, FailurePolicyClosed:
+	default:
+		return nil, fmt.Errorf("failurePolicy must be either %q or %q, got %q", FailurePolicyOpen, FailurePolicyClosed, decider.FailurePolicy)
+	}
+
+	if decider.Timeout == 0 {
+		decider.Timeout = defaultTimeout
+	}
+
+	if decider.MaxMemoryMB == 0 {
+		decider.MaxMemoryMB = defaultMaxMemoryMB
+	}
+
+	code, err := os.ReadFile(decider.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module: %s", err)
+	}
+
+	ctx := context.Background()
+	decider.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(decider.MaxMemoryMB*wasmPagesPerMB).
+		WithCloseOnContextDone(true))
+
+	// Modules built with e.g. TinyGo or Rust targeting WASI expect these imports to exist.
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, decider.runtime); err != nil {
+		decider.runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to instantiate WASI: %s", err)
+	}
+
+	decider.compiled, err = decider.runtime.CompileModule(ctx, code)
+	if err != nil {
+		decider.runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to compile module %s: %s", decider.Path, err)
+	}
+
+	if err := checkExports(decider.compiled); err != nil {
+		decider.runtime.Close(ctx)
+		return nil, fmt.Errorf("invalid module %s: %s", decider.Path, err)
+	}
+
+	return &decider, nil
+}
+
+func checkExports(module wazero.CompiledModule) error {
+	if _, ok := module.ExportedMemories()["memory"]; !ok {
+		return fmt.Errorf("module must export its memory as \"memory\"")
+	}
+
+	functions := module.ExportedFunctions()
+	for _, name := range []string{"alloc", "decide"} {
+		if _, ok := functions[name]; !ok {
+			return fmt.Errorf("module must export a %q function", name)
+		}
+	}
+
+	return nil
+}
+
+// Decide implements deciders.Decider.
+func (w *Wasm) Decide(req *http.Request) *deciders.HTTPError {
+	input := Input{
+		Method:  req.Method,
+		URI:     req.URL.RequestURI(),
+		Headers: deciders.ForwardedHeaders(req.Header, w.Headers),
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return &deciders.HTTPError{
+				Status: http.StatusBadRequest,
+				Err:    fmt.Sprintf("failed to read request: %s", err),
+				Reason: deciders.ReasonInvalidRequest,
+			}
+		}
+
+		if json.Valid(body) {
+			input.Body = body
+		}
+	}
+
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return w.fail(fmt.Errorf("failed to encode input: %w", err))
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), w.Timeout)
+	defer cancel()
+
+	verdict, err := w.run(ctx, payload)
+	if err != nil {
+		return w.fail(err)
+	}
+
+	if verdict.Allowed {
+		return nil
+	}
+
+	status := deciders.RejectionStatus(verdict.Status)
+	if verdict.Status != 0 && status != verdict.Status {
+		log.Warn().Int("status", verdict.Status).Msg("Wasm policy rejected a request with a status that isn't an error, using 400 instead")
+	}
+
+	if verdict.Message == "" {
+		verdict.Message = "rejected by wasm policy"
+	}
+
+	return &deciders.HTTPError{
+		Status: status,
+		Err:    verdict.Message,
+		Reason: verdict.Reason,
+	}
+}
+
+// run instantiates a fresh copy of the module, and calls its decide function with the given payload.
+func (w *Wasm) run(ctx context.Context, payload []byte) (Verdict, error) {
+	module, err := w.runtime.InstantiateModule(ctx, w.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize"))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to instantiate module: %w", err)
+	}
+	defer module.Close(ctx)
+
+	results, err := module.ExportedFunction("alloc").Call(ctx, uint64(len(payload)))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("alloc failed: %w", err)
+	}
+
+	ptr := uint32(results[0])
+	if !module.Memory().Write(ptr, payload) {
+		return Verdict{}, fmt.Errorf("alloc returned an out of range pointer %d", ptr)
+	}
+
+	results, err = module.ExportedFunction("decide").Call(ctx, uint64(ptr), uint64(len(payload)))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("decide failed: %w", err)
+	}
+
+	verdictPtr, verdictLen := uint32(results[0]>>32), uint32(results[0])
+	rawVerdict, ok := module.Memory().Read(verdictPtr, verdictLen)
+	if !ok {
+		return Verdict{}, fmt.Errorf("decide returned an out of range verdict (ptr %d, len %d)", verdictPtr, verdictLen)
+	}
+
+	var verdict Verdict
+	if err := json.Unmarshal(rawVerdict, &verdict); err != nil {
+		return Verdict{}, fmt.Errorf("failed to decode verdict: %w", err)
+	}
+
+	return verdict, nil
+}
+
+// fail handles a module that couldn't give us an answer, according to the configured FailurePolicy.
+func (w *Wasm) fail(err error) *deciders.HTTPError {
+	if w.FailurePolicy == FailurePolicyOpen {
+		log.Warn().Str("path", w.Path).Err(err).Msg("Wasm policy failed, allowing request due to failurePolicy open")
+		return nil
+	}
+
+	return &deciders.HTTPError{
+		Status: http.StatusInternalServerError,
+		Err:    fmt.Sprintf("wasm policy failed: %s", err),
+		Reason: deciders.ReasonDeciderFailed,
+	}
+}
+
+// Close releases the WebAssembly runtime.
+func (w *Wasm) Close() error {
+	return w.runtime.Close(context.Background())
+}
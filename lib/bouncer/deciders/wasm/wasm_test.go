@@ -0,0 +1,193 @@
+package wasm_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/wasm"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const verdictOffset = 32768
+
+// The tests build their modules by hand, rather than shipping opaque binaries. Each module exports a single page memory,
+// an alloc function that always returns 0, and the given decide function body.
+
+func uleb128(v uint64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			out = append(out, b|0x80)
+		} else {
+			return append(out, b)
+		}
+	}
+}
+
+func sleb128(v int64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func section(id byte, contents ...byte) []byte {
+	return append(append([]byte{id}, uleb128(uint64(len(contents)))...), contents...)
+}
+
+func vec(items ...[]byte) []byte {
+	out := uleb128(uint64(len(items)))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func name(s string) []byte {
+	return append(uleb128(uint64(len(s))), s...)
+}
+
+func buildModule(minPages byte, decideBody []byte, data []byte) []byte {
+	const i32, i64 = 0x7f, 0x7e
+
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	module = append(module, section(1, vec(
+		[]byte{0x60, 1, i32, 1, i32},
+		[]byte{0x60, 2, i32, i32, 1, i64},
+	)...)...)
+	module = append(module, section(3, vec([]byte{0}, []byte{1})...)...)
+	module = append(module, section(5, vec([]byte{0x00, minPages})...)...)
+	module = append(module, section(7, vec(
+		append(name("memory"), 0x02, 0),
+		append(name("alloc"), 0x00, 0),
+		append(name("decide"), 0x00, 1),
+	)...)...)
+
+	allocBody := []byte{0x00, 0x41, 0x00, 0x0b}
+	decideBody = append([]byte{0x00}, decideBody...)
+	module = append(module, section(10, vec(
+		append(uleb128(uint64(len(allocBody))), allocBody...),
+		append(uleb128(uint64(len(decideBody))), decideBody...),
+	)...)...)
+
+	if data != nil {
+		segment := append([]byte{0x00, 0x41}, sleb128(verdictOffset)...)
+		segment = append(segment, 0x0b)
+		segment = append(segment, uleb128(uint64(len(data)))...)
+		segment = append(segment, data...)
+		module = append(module, section(11, vec(segment)...)...)
+	}
+
+	return module
+}
+
+// verdictModule builds a module whose decide function always returns the given verdict.
+func verdictModule(verdict string) []byte {
+	result := int64(verdictOffset)<<32 | int64(len(verdict))
+	decideBody := append([]byte{0x42}, sleb128(result)...)
+	decideBody = append(decideBody, 0x0b)
+	return buildModule(1, decideBody, []byte(verdict))
+}
+
+// loopModule builds a module whose decide function never returns.
+func loopModule() []byte {
+	return buildModule(1, []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00, 0x0b}, nil)
+}
+
+func writeModule(t *testing.T, module []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.wasm")
+	require.NoError(t, os.WriteFile(path, module, 0o600))
+	return path
+}
+
+func TestWasmDecider(t *testing.T) {
+	testCases := []struct {
+		name           string
+		module         []byte
+		config         map[string]interface{}
+		expectedStatus int
+		expectedErr    string
+	}{
+		{
+			name:           "Allowed Passes",
+			module:         verdictModule(`{"allowed": true}`),
+			expectedStatus: 0,
+		},
+		{
+			name:           "Rejected Fails",
+			module:         verdictModule(`{"allowed": false, "status": 403, "message": "nope"}`),
+			expectedStatus: http.StatusForbidden,
+			expectedErr:    "nope",
+		},
+		{
+			name:           "Rejected With A Successful Status Uses 400",
+			module:         verdictModule(`{"allowed": false, "status": 204}`),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Garbage Verdict Fails",
+			module:         verdictModule(`cats`),
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "Timeout Fails",
+			module:         loopModule(),
+			config:         map[string]interface{}{"timeout": "50ms"},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "Timeout With Failure Policy Open Passes",
+			module:         loopModule(),
+			config:         map[string]interface{}{"timeout": "50ms", "failurePolicy": "open"},
+			expectedStatus: 0,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			config := map[string]interface{}{"path": writeModule(t, tt.module)}
+			for k, v := range tt.config {
+				config[k] = v
+			}
+
+			decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(wasm.New), config)
+			defer decider.(*wasm.Wasm).Close()
+
+			response := decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"comment": "test"}`))
+			if tt.expectedStatus == 0 {
+				require.Nil(t, response)
+				return
+			}
+
+			require.NotNil(t, response)
+			require.Equal(t, tt.expectedStatus, response.Status)
+			if tt.expectedErr != "" {
+				require.Equal(t, tt.expectedErr, response.Err)
+			}
+		})
+	}
+}
+
+func TestWasmConfigValidation(t *testing.T) {
+	_, err := wasm.New(map[string]interface{}{})
+	require.Error(t, err)
+
+	_, err = wasm.New(map[string]interface{}{"path": writeModule(t, []byte("not wasm"))})
+	require.Error(t, err)
+
+	// Modules asking for more memory than they're allowed are rejected up front.
+	_, err = wasm.New(map[string]interface{}{"path": writeModule(t, buildModule(32, []byte{0x42, 0x00, 0x0b}, nil)), "maxMemoryMB": 1})
+	require.Error(t, err)
+}
@@ -0,0 +1,22 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+func SetClock(decider deciders.Decider, now func() time.Time) {
+	decider.(*Webhook).cache.now = now
+}
+
+func Backoff(decider deciders.Decider, attempt int) time.Duration {
+	return decider.(*Webhook).backoff(attempt)
+}
+
+func CacheSize(decider deciders.Decider) int {
+	cache := decider.(*Webhook).cache
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return len(cache.entries)
+}
@@ -0,0 +1,401 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+const (
+	// FailurePolicyOpen accepts requests when the webhook can't be reached, or returns garbage.
+	FailurePolicyOpen = "open"
+	// FailurePolicyClosed rejects requests when the webhook can't be reached, or returns garbage.
+	FailurePolicyClosed = "closed"
+
+	defaultTimeout = 10 * time.Second
+
+	defaultRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff     = 5 * time.Second
+)
+
+var _ = deciders.Decider(&Webhook{})
+
+// TLSConfig configures the client that the Webhook uses to talk to its endpoint.
+type TLSConfig struct {
+	CAFile             string `mapstructure:"caFile"`
+	CertFile           string `mapstructure:"certFile"`
+	KeyFile            string `mapstructure:"keyFile"`
+	ServerName         string `mapstructure:"serverName"`
+	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify"`
+}
+
+// Webhook is a Decider which delegates the decision to an external HTTP service. Every request is POSTed to the configured URL
+// as a JSON encoded Review, and the service replies with a Verdict saying whether it should be accepted.
+type Webhook struct {
+	URL           string        `mapstructure:"url"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+	Retries       int           `mapstructure:"retries"`
+	RetryBackoff  time.Duration `mapstructure:"retryBackoff"`
+	CacheTTL      time.Duration `mapstructure:"cacheTTL"`
+	FailurePolicy string        `mapstructure:"failurePolicy"`
+	TLS           TLSConfig     `mapstructure:"tls"`
+
+	// Headers are the request headers that are sent to the webhook, defaulting to deciders.DefaultForwardedHeaders.
+	// Credentials like Authorization are only sent if they're listed here.
+	Headers []string `mapstructure:"headers"`
+
+	client *http.Client
+	cache  *verdictCache
+}
+
+// Review is the body that gets sent to the webhook.
+type Review struct {
+	Method  string              `json:"method"`
+	URI     string              `json:"uri"`
+	Headers map[string][]string `json:"headers,omitempty"`
+
+	// Body is the body of the request, if it is valid JSON. Otherwise, the raw body is sent in RawBody.
+	Body    json.RawMessage `json:"body,omitempty"`
+	RawBody string          `json:"rawBody,omitempty"`
+}
+
+// Verdict is the response that the webhook is expected to send back.
+type Verdict struct {
+	Allowed bool   `json:"allowed"`
+	Message string `json:"message"`
+	Status  int    `json:"status"`
+	Reason  string `json:"reason"`
+}
+
+func New(config map[string]interface{}) (deciders.Decider, error) {
+	var decider Webhook
+	if err := deciders.DecodeConfig(config, &decider); err != nil {
+		return nil, err
+	}
+
+	if decider.URL == "" {
+		return nil, fmt.Errorf("url must be set")
+	}
+
+	if decider.Retries < 0 || decider.RetryBackoff < 0 {
+		return nil, fmt.Errorf("retries and retryBackoff must not be negative")
+	}
+
+	if decider.RetryBackoff == 0 {
+		decider.RetryBackoff = defaultRetryBackoff
+	}
+
+	switch decider.FailurePolicy {
+	case "":
+		decider.FailurePolicy = FailurePolicyClosed
+	case FailurePolicyOpen, FailurePolicyClosed:
+	default:
+		return nil, fmt.Errorf("failurePolicy must be either %q or %q, got %q", FailurePolicyOpen, FailurePolicyClosed, decider.FailurePolicy)
+	}
+
+	if decider.Timeout == 0 {
+		decider.Timeout = defaultTimeout
+	}
+
+	tlsConfig, err := decider.TLS.build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tls config: %s", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	decider.client = &http.Client{
+		Transport: transport,
+		Timeout:   decider.Timeout,
+	}
+
+	if decider.CacheTTL > 0 {
+		decider.cache = newVerdictCache(decider.CacheTTL)
+	}
+
+	return &decider, nil
+}
+
+func (t TLSConfig) build() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify, //nolint:gosec // Explicitly opted into by the config.
+	}
+
+	if t.CAFile != "" {
+		ca, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CAFile)
+		}
+
+		config.RootCAs = pool
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, fmt.Errorf("certFile and keyFile must be set together")
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// Decide implements deciders.Decider.
+func (w *Webhook) Decide(req *http.Request) *deciders.HTTPError {
+	review, err := makeReview(req, w.Headers)
+	if err != nil {
+		return &deciders.HTTPError{
+			Status: http.StatusBadRequest,
+			Err:    fmt.Sprintf("failed to read request: %s", err),
+			Reason: deciders.ReasonInvalidRequest,
+		}
+	}
+
+	payload, err := json.Marshal(review)
+	if err != nil {
+		return w.fail(fmt.Errorf("failed to encode review: %w", err))
+	}
+
+	var cacheKey string
+	if w.cache != nil {
+		hash := sha256.Sum256(payload)
+		cacheKey = hex.EncodeToString(hash[:])
+		if verdict, ok := w.cache.get(cacheKey); ok {
+			return verdict.toHTTPError()
+		}
+	}
+
+	verdict, err := w.callWithRetries(req.Context(), payload)
+	if err != nil {
+		return w.fail(err)
+	}
+
+	if w.cache != nil {
+		w.cache.put(cacheKey, verdict)
+	}
+
+	return verdict.toHTTPError()
+}
+
+// fail handles a webhook that couldn't give us an answer, according to the configured FailurePolicy.
+func (w *Webhook) fail(err error) *deciders.HTTPError {
+	if w.FailurePolicy == FailurePolicyOpen {
+		log.Warn().Str("url", w.URL).Err(err).Msg("Webhook failed, allowing request due to failurePolicy open")
+		return nil
+	}
+
+	return &deciders.HTTPError{
+		Status: http.StatusBadGateway,
+		Err:    fmt.Sprintf("failed to call webhook %s: %s", w.URL, err),
+		Reason: deciders.ReasonDeciderFailed,
+	}
+}
+
+func (w *Webhook) callWithRetries(ctx context.Context, payload []byte) (Verdict, error) {
+	var lastErr error
+	for attempt := 0; attempt <= w.Retries; attempt++ {
+		verdict, retryable, err := w.call(ctx, payload)
+		if err == nil {
+			return verdict, nil
+		}
+
+		lastErr = err
+		if !retryable || attempt == w.Retries {
+			break
+		}
+
+		timer := time.NewTimer(w.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return Verdict{}, lastErr
+		case <-timer.C:
+		}
+	}
+
+	return Verdict{}, lastErr
+}
+
+// backoff returns how long to wait after the given attempt before retrying. It starts at RetryBackoff and doubles with every attempt,
+// up to maxRetryBackoff, and half of it is random, so that requests that failed together don't all retry at the same time.
+func (w *Webhook) backoff(attempt int) time.Duration {
+	wait := w.RetryBackoff
+	for i := 0; i < attempt && wait < maxRetryBackoff; i++ {
+		wait *= 2
+	}
+
+	wait = min(wait, maxRetryBackoff)
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1)) //nolint:gosec // Jitter doesn't need a secure random source.
+}
+
+// call makes a single request to the webhook, returning the verdict, or an error and whether or not that error is worth retrying.
+func (w *Webhook) call(ctx context.Context, payload []byte) (Verdict, bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return Verdict{}, false, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(request)
+	if err != nil {
+		return Verdict{}, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return Verdict{}, true, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, false, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	var verdict Verdict
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return Verdict{}, false, fmt.Errorf("failed to decode webhook response: %s", err)
+	}
+
+	return verdict, false, nil
+}
+
+// makeReview describes the given request for the webhook, with only the given headers. Reviews are also the key that verdicts are
+// cached under, so any headers that change on every request would stop the cache from working.
+func makeReview(req *http.Request, headers []string) (Review, error) {
+	review := Review{
+		Method:  req.Method,
+		URI:     req.URL.RequestURI(),
+		Headers: deciders.ForwardedHeaders(req.Header, headers),
+	}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return review, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return Review{}, err
+	}
+
+	if json.Valid(body) {
+		review.Body = body
+	} else if len(body) > 0 {
+		review.RawBody = string(body)
+	}
+
+	return review, nil
+}
+
+func (v Verdict) toHTTPError() *deciders.HTTPError {
+	if v.Allowed {
+		return nil
+	}
+
+	status := deciders.RejectionStatus(v.Status)
+	if v.Status != 0 && status != v.Status {
+		log.Warn().Int("status", v.Status).Msg("Webhook rejected a request with a status that isn't an error, using 400 instead")
+	}
+
+	message := v.Message
+	if message == "" {
+		message = "rejected by webhook"
+	}
+
+	return &deciders.HTTPError{
+		Status: status,
+		Err:    message,
+		Reason: v.Reason,
+	}
+}
+
+type cachedVerdict struct {
+	verdict Verdict
+	expires time.Time
+}
+
+// verdictCache is a simple TTL cache of webhook responses, keyed by a hash of the review that was sent. Expired entries are
+// removed when they're looked up, and the rest are swept out at most once every ttl, so that entries that are never looked
+// up again don't pile up.
+type verdictCache struct {
+	ttl       time.Duration
+	now       func() time.Time
+	lock      sync.Mutex
+	entries   map[string]cachedVerdict
+	nextSweep time.Time
+}
+
+func newVerdictCache(ttl time.Duration) *verdictCache {
+	return &verdictCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cachedVerdict),
+	}
+}
+
+func (c *verdictCache) get(key string) (Verdict, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return Verdict{}, false
+	}
+
+	if c.now().After(entry.expires) {
+		delete(c.entries, key)
+		return Verdict{}, false
+	}
+
+	return entry.verdict, true
+}
+
+func (c *verdictCache) put(key string, verdict Verdict) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now()
+	if now.After(c.nextSweep) {
+		c.sweep(now)
+		c.nextSweep = now.Add(c.ttl)
+	}
+
+	c.entries[key] = cachedVerdict{
+		verdict: verdict,
+		expires: now.Add(c.ttl),
+	}
+}
+
+// sweep removes every entry that has expired by the given time. The lock must be held.
+func (c *verdictCache) sweep(now time.Time) {
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/webhook"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type countingHandler struct {
+	lock    sync.Mutex
+	calls   int
+	handler func(calls int, w http.ResponseWriter, r *http.Request)
+}
+
+func (c *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.lock.Lock()
+	c.calls++
+	calls := c.calls
+	c.lock.Unlock()
+	c.handler(calls, w, r)
+}
+
+func (c *countingHandler) Calls() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.calls
+}
+
+func writeVerdict(w http.ResponseWriter, verdict webhook.Verdict) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(verdict)
+}
+
+func TestWebhookDecider(t *testing.T) {
+	testCases := []struct {
+		name           string
+		config         map[string]interface{}
+		handler        func(calls int, w http.ResponseWriter, r *http.Request)
+		expectedStatus int
+		expectedCalls  int
+	}{
+		{
+			name: "Allowed Passes",
+			handler: func(calls int, w http.ResponseWriter, r *http.Request) {
+				writeVerdict(w, webhook.Verdict{Allowed: true})
+			},
+			expectedStatus: 0,
+			expectedCalls:  1,
+		},
+		{
+			name: "Rejected Fails With Given Status",
+			handler: func(calls int, w http.ResponseWriter, r *http.Request) {
+				writeVerdict(w, webhook.Verdict{Allowed: false, Status: http.StatusForbidden, Message: "ticket is closed"})
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedCalls:  1,
+		},
+		{
+			name: "Rejected Without Status Defaults",
+			handler: func(calls int, w http.ResponseWriter, r *http.Request) {
+				writeVerdict(w, webhook.Verdict{Allowed: false})
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  1,
+		},
+		{
+			name: "Rejected With A Successful Status Uses 400",
+			handler: func(calls int, w http.ResponseWriter, r *http.Request) {
+				writeVerdict(w, webhook.Verdict{Allowed: false, Status: http.StatusOK})
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  1,
+		},
+		{
+			name: "Failure Policy Closed Rejects",
+			handler: func(calls int, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			expectedStatus: http.StatusBadGateway,
+			expectedCalls:  1,
+		},
+		{
+			name:   "Failure Policy Open Accepts",
+			config: map[string]interface{}{"failurePolicy": "open"},
+			handler: func(calls int, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			expectedStatus: 0,
+			expectedCalls:  1,
+		},
+		{
+			name:   "Garbage Responses Aren't Retried",
+			config: map[string]interface{}{"retries": 3},
+			handler: func(calls int, w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("not json"))
+			},
+			expectedStatus: http.StatusBadGateway,
+			expectedCalls:  1,
+		},
+		{
+			name:   "Server Errors Are Retried",
+			config: map[string]interface{}{"retries": 2},
+			handler: func(calls int, w http.ResponseWriter, r *http.Request) {
+				if calls < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+
+				writeVerdict(w, webhook.Verdict{Allowed: true})
+			},
+			expectedStatus: 0,
+			expectedCalls:  3,
+		},
+		{
+			name:   "Timeouts Fail",
+			config: map[string]interface{}{"timeout": "50ms"},
+			handler: func(calls int, w http.ResponseWriter, r *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+				writeVerdict(w, webhook.Verdict{Allowed: true})
+			},
+			expectedStatus: http.StatusBadGateway,
+			expectedCalls:  1,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &countingHandler{handler: tt.handler}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			config := map[string]interface{}{"url": server.URL}
+			for k, v := range tt.config {
+				config[k] = v
+			}
+
+			decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(webhook.New), config)
+			response := decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"comment": "test"}`))
+
+			if tt.expectedStatus == 0 {
+				require.Nil(t, response)
+			} else {
+				require.NotNil(t, response)
+				require.Equal(t, tt.expectedStatus, response.Status)
+			}
+
+			require.Equal(t, tt.expectedCalls, handler.Calls())
+		})
+	}
+}
+
+func TestWebhookSendsReview(t *testing.T) {
+	reviews := make(chan webhook.Review, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review webhook.Review
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&review))
+		reviews <- review
+		writeVerdict(w, webhook.Verdict{Allowed: true})
+	}))
+	defer server.Close()
+
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(webhook.New), map[string]interface{}{"url": server.URL})
+	req := testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"comment":"test"}`)
+	req.Header = http.Header{}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "session=secret")
+	require.Nil(t, decider.Decide(req))
+
+	review := <-reviews
+	require.Equal(t, http.MethodPost, review.Method)
+	require.Equal(t, "/api/v2/silences", review.URI)
+	require.JSONEq(t, `{"comment":"test"}`, string(review.Body))
+	require.Equal(t, map[string][]string{"Content-Type": {"application/json"}}, review.Headers, "Expected credentials not to be sent by default")
+}
+
+func TestWebhookCacheIgnoresUnforwardedHeaders(t *testing.T) {
+	handler := &countingHandler{handler: func(calls int, w http.ResponseWriter, r *http.Request) {
+		writeVerdict(w, webhook.Verdict{Allowed: true})
+	}}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(webhook.New), map[string]interface{}{"url": server.URL, "cacheTTL": "1m"})
+	for _, requestID := range []string{"a", "b", "c"} {
+		req := testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"comment":"test"}`)
+		req.Header = http.Header{"X-Request-Id": {requestID}}
+		require.Nil(t, decider.Decide(req))
+	}
+
+	require.Equal(t, 1, handler.Calls(), "Expected headers that aren't sent to the webhook not to affect the cache")
+}
+
+func TestWebhookCachesVerdicts(t *testing.T) {
+	handler := &countingHandler{handler: func(calls int, w http.ResponseWriter, r *http.Request) {
+		writeVerdict(w, webhook.Verdict{Allowed: false, Message: "no"})
+	}}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(webhook.New), map[string]interface{}{"url": server.URL, "cacheTTL": "1m"})
+	for i := 0; i < 3; i++ {
+		require.NotNil(t, decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"comment":"test"}`)))
+	}
+
+	require.Equal(t, 1, handler.Calls())
+
+	require.NotNil(t, decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"comment":"different"}`)))
+	require.Equal(t, 2, handler.Calls())
+}
+
+func TestWebhookCacheEvictsExpiredVerdicts(t *testing.T) {
+	server := httptest.NewServer(&countingHandler{handler: func(calls int, w http.ResponseWriter, r *http.Request) {
+		writeVerdict(w, webhook.Verdict{Allowed: true})
+	}})
+	defer server.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(webhook.New), map[string]interface{}{"url": server.URL, "cacheTTL": "1m"})
+	webhook.SetClock(decider, func() time.Time { return now })
+
+	decide := func(comment string) {
+		require.Nil(t, decider.Decide(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"comment":"`+comment+`"}`)))
+	}
+
+	decide("first")
+	decide("second")
+	require.Equal(t, 2, webhook.CacheSize(decider))
+
+	now = now.Add(30 * time.Second)
+	decide("third")
+	require.Equal(t, 3, webhook.CacheSize(decider), "Expected verdicts not to be swept until they expire")
+
+	now = now.Add(45 * time.Second)
+	decide("first")
+	require.Equal(t, 2, webhook.CacheSize(decider), "Expected the expired second verdict to be swept, and the third to be kept")
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(webhook.New), map[string]interface{}{"url": "http://localhost", "retryBackoff": "1s"})
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		wait := webhook.Backoff(decider, attempt)
+		require.GreaterOrEqual(t, wait, expected/2, "Expected attempt %d to wait for at least half of its backoff", attempt)
+		require.LessOrEqual(t, wait, expected, "Expected attempt %d to wait for at most its backoff", attempt)
+	}
+
+	require.LessOrEqual(t, webhook.Backoff(decider, 1000), 5*time.Second, "Expected the backoff not to overflow")
+}
+
+func TestWebhookRetriesStopWhenTheRequestIsDone(t *testing.T) {
+	handler := &countingHandler{handler: func(calls int, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	decider := testutil.MustMakeDecider(t, deciders.TemplateFunc(webhook.New), map[string]interface{}{"url": server.URL, "retries": 100, "retryBackoff": "50ms"})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	req := testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", `{"comment":"test"}`).WithContext(ctx)
+	response := decider.Decide(req)
+	require.NotNil(t, response)
+	require.Equal(t, http.StatusBadGateway, response.Status)
+	require.Less(t, time.Since(start), time.Second, "Expected retries to stop when the request's context is done")
+	require.Less(t, handler.Calls(), 5, "Expected retries to back off")
+}
+
+func TestWebhookConfigValidation(t *testing.T) {
+	_, err := webhook.New(map[string]interface{}{})
+	require.Error(t, err)
+
+	_, err = webhook.New(map[string]interface{}{"url": "http://localhost", "failurePolicy": "sometimes"})
+	require.Error(t, err)
+
+	_, err = webhook.New(map[string]interface{}{"url": "http://localhost", "tls": map[string]interface{}{"certFile": "cert.pem"}})
+	require.Error(t, err)
+
+	_, err = webhook.New(map[string]interface{}{"url": "http://localhost", "retryBackoff": "-1s"})
+	require.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package bouncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+const (
+	// ErrorFormatAuto formats rejections like the Alertmanager API version that the request was for would, falling back to plain text.
+	ErrorFormatAuto = "auto"
+	// ErrorFormatText sends rejections back as plain text.
+	ErrorFormatText = "text"
+	// ErrorFormatJSON sends rejections back as an ErrorBody.
+	ErrorFormatJSON = "json"
+
+	// V2ShapeString sends v2 API rejections back as a JSON string, like the Alertmanager does.
+	V2ShapeString = "string"
+	// V2ShapeObject sends v2 API rejections back as an ErrorBody.
+	V2ShapeObject = "object"
+)
+
+// ErrorResponses configures how rejections are sent back to clients. The zero value formats them automatically.
+type ErrorResponses struct {
+	Format  string `yaml:"format"`
+	V2Shape string `yaml:"v2Shape"`
+}
+
+// ErrorBody is the JSON object that rejections are sent back as with the json format, or the object v2Shape.
+type ErrorBody struct {
+	Error   string `json:"error"`
+	Reason  string `json:"reason"`
+	Bouncer string `json:"bouncer,omitempty"`
+	Decider string `json:"decider,omitempty"`
+
+	// Violations are the individual rejections, when bouncers evaluate every decider.
+	Violations []ErrorBody `json:"violations,omitempty"`
+}
+
+// v1ErrorBody is the error format of the Alertmanagers v1 API.
+type v1ErrorBody struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+}
+
+func (e *ErrorResponses) setDefaults() error {
+	switch e.Format {
+	case "":
+		e.Format = ErrorFormatAuto
+	case ErrorFormatAuto, ErrorFormatText, ErrorFormatJSON:
+	default:
+		return fmt.Errorf("errorResponses.format must be one of %q, %q, or %q, got %q", ErrorFormatAuto, ErrorFormatText, ErrorFormatJSON, e.Format)
+	}
+
+	switch e.V2Shape {
+	case "":
+		e.V2Shape = V2ShapeString
+	case V2ShapeString, V2ShapeObject:
+	default:
+		return fmt.Errorf("errorResponses.v2Shape must be either %q or %q, got %q", V2ShapeString, V2ShapeObject, e.V2Shape)
+	}
+
+	return nil
+}
+
+// response converts the given error into a response to the given request.
+func (e ErrorResponses) response(req *http.Request, err *deciders.HTTPError) *http.Response {
+	var response *http.Response
+	switch {
+	case e.Format == ErrorFormatJSON:
+		response = jsonResponse(err, errorBody(err))
+	case e.Format == ErrorFormatText:
+		response = err.ToResponse()
+	case strings.Contains(req.URL.Path, "/api/v1/"):
+		response = jsonResponse(err, v1ErrorBody{
+			Status:    "error",
+			ErrorType: v1ErrorType(err.Status),
+			Error:     err.Err,
+		})
+	case strings.Contains(req.URL.Path, "/api/v2/"):
+		if e.V2Shape == V2ShapeObject {
+			response = jsonResponse(err, errorBody(err))
+		} else {
+			response = jsonResponse(err, err.Err)
+		}
+	default:
+		response = err.ToResponse()
+	}
+
+	response.Request = req
+	return response
+}
+
+func errorBody(err *deciders.HTTPError) ErrorBody {
+	body := ErrorBody{
+		Error:   err.Err,
+		Reason:  err.ReasonCode(),
+		Bouncer: err.Bouncer,
+		Decider: err.Decider,
+	}
+
+	for _, violation := range err.Violations {
+		body.Violations = append(body.Violations, errorBody(violation))
+	}
+
+	return body
+}
+
+func jsonResponse(err *deciders.HTTPError, body interface{}) *http.Response {
+	encoded, jsonErr := json.Marshal(body)
+	if jsonErr != nil {
+		return err.ToResponse()
+	}
+
+	return err.NewResponse("application/json", encoded)
+}
+
+// v1ErrorType maps a status code to the closest errorType that the Alertmanagers v1 API uses.
+func v1ErrorType(status int) string {
+	switch {
+	case status == http.StatusServiceUnavailable:
+		return "unavailable"
+	case status == http.StatusGatewayTimeout:
+		return "timeout"
+	case status >= 500:
+		return "server_error"
+	default:
+		return "bad_data"
+	}
+}
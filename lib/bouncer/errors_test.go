@@ -0,0 +1,144 @@
+package bouncer_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+func TestErrorResponses(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	registry := bouncer.NewRegistry()
+	require.NoError(t, registry.Register("RejectAll", rejectAll))
+
+	testCases := []struct {
+		name                string
+		errorResponses      string
+		uri                 string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "auto v1",
+			uri:                 "/api/v1/silences",
+			expectedContentType: "application/json",
+			expectedBody:        `{"status": "error", "errorType": "bad_data", "error": "No"}`,
+		},
+		{
+			name:                "auto v2",
+			uri:                 "/api/v2/silences",
+			expectedContentType: "application/json",
+			expectedBody:        `"No"`,
+		},
+		{
+			name:                "auto v2 object",
+			errorResponses:      "v2Shape: object",
+			uri:                 "/alertmanager/api/v2/silences",
+			expectedContentType: "application/json",
+			expectedBody:        `{"error": "No", "reason": "rejected", "bouncer": "silences", "decider": "RejectAll"}`,
+		},
+		{
+			name:                "auto other",
+			uri:                 "/-/reload",
+			expectedContentType: "text/plain; charset=utf-8",
+			expectedBody:        "No",
+		},
+		{
+			name:                "text",
+			errorResponses:      "format: text",
+			uri:                 "/api/v2/silences",
+			expectedContentType: "text/plain; charset=utf-8",
+			expectedBody:        "No",
+		},
+		{
+			name:                "json",
+			errorResponses:      "format: json",
+			uri:                 "/-/reload",
+			expectedContentType: "application/json",
+			expectedBody:        `{"error": "No", "reason": "rejected", "bouncer": "silences", "decider": "RejectAll"}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			serialized := `
+bouncers:
+  - name: silences
+    method: POST
+    uriRegex: .*
+    deciders:
+      - name: RejectAll
+`
+			if testCase.errorResponses != "" {
+				serialized += "errorResponses:\n  " + testCase.errorResponses + "\n"
+			}
+
+			config, err := bouncer.ParseConfigWithRegistry([]byte(serialized), registry)
+			require.NoError(t, err)
+
+			frontend := httptest.NewServer(bouncer.NewBouncingReverseProxyWithConfig(backendURL, config, http.DefaultTransport))
+			defer frontend.Close()
+
+			response, err := frontend.Client().Post(frontend.URL+testCase.uri, "application/json", strings.NewReader("{}"))
+			require.NoError(t, err)
+			body, err := io.ReadAll(response.Body)
+			response.Body.Close()
+			require.NoError(t, err)
+
+			require.Equal(t, http.StatusForbidden, response.StatusCode)
+			require.Equal(t, testCase.expectedContentType, response.Header.Get("Content-Type"))
+			require.Equal(t, "silences", response.Header.Get(deciders.HeaderBouncer))
+			require.Equal(t, "RejectAll", response.Header.Get(deciders.HeaderDecider))
+			require.Equal(t, deciders.ReasonRejected, response.Header.Get(deciders.HeaderReason))
+
+			if testCase.expectedContentType == "application/json" {
+				require.JSONEq(t, testCase.expectedBody, string(body))
+			} else {
+				require.Equal(t, testCase.expectedBody, string(body))
+			}
+		})
+	}
+}
+
+func TestErrorResponsesConfig(t *testing.T) {
+	_, err := bouncer.ParseConfig([]byte(`
+errorResponses:
+  format: xml
+`))
+	require.Error(t, err)
+
+	_, err = bouncer.ParseConfig([]byte(`
+errorResponses:
+  v2Shape: array
+`))
+	require.Error(t, err)
+}
+
+func TestHTTPErrorToResponse(t *testing.T) {
+	err := &deciders.HTTPError{
+		Status:  http.StatusTooManyRequests,
+		Err:     "slow down",
+		Reason:  "rate_limited",
+		Headers: http.Header{"Retry-After": []string{"10"}},
+	}
+
+	response := err.ToResponse()
+	require.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+	require.Equal(t, "429 Too Many Requests", response.Status)
+	require.Equal(t, int64(len("slow down")), response.ContentLength)
+	require.Equal(t, "10", response.Header.Get("Retry-After"))
+	require.Equal(t, "rate_limited", response.Header.Get(deciders.HeaderReason))
+	require.Empty(t, response.Header.Get(deciders.HeaderBouncer))
+}
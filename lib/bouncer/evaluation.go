@@ -0,0 +1,122 @@
+package bouncer
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+const (
+	// EvaluationFirst rejects requests as soon as any decider rejects them. This is the default.
+	EvaluationFirst = "first"
+	// EvaluationAll runs every decider, and rejects requests with every violation they had, so they can all be fixed at once.
+	EvaluationAll = "all"
+)
+
+// statusPrecedence is the order in which status codes are picked for aggregated rejections, highest first.
+// Policy violations beat the request being malformed, which beats being rate limited, which beats a decider failing,
+// because the caller has to fix them before anything else matters.
+var statusPrecedence = []int{
+	http.StatusForbidden,
+	http.StatusUnauthorized,
+	http.StatusConflict,
+	http.StatusUnprocessableEntity,
+	http.StatusBadRequest,
+	http.StatusTooManyRequests,
+}
+
+func validateEvaluation(evaluation string) error {
+	switch evaluation {
+	case "", EvaluationFirst, EvaluationAll:
+		return nil
+	default:
+		return fmt.Errorf("evaluation must be either %q or %q, got %q", EvaluationFirst, EvaluationAll, evaluation)
+	}
+}
+
+// aggregate combines the given violations into a single error. Its status is picked from the violations by statusPrecedence,
+// falling back to the lowest 4xx status, and then the highest 5xx status.
+func aggregate(violations []*deciders.HTTPError) *deciders.HTTPError {
+	aggregated := &deciders.HTTPError{
+		Status:  violations[0].Status,
+		Headers: http.Header{},
+	}
+
+	var messages, reasons, bouncers, decidersNames []string
+	for _, violation := range violations {
+		// Violations from bouncers that evaluated all their deciders are already aggregates, so flatten them.
+		if len(violation.Violations) > 0 {
+			aggregated.Violations = append(aggregated.Violations, violation.Violations...)
+		} else {
+			aggregated.Violations = append(aggregated.Violations, violation)
+		}
+
+		if higherPrecedence(violation.Status, aggregated.Status) {
+			aggregated.Status = violation.Status
+		}
+
+		for name, values := range violation.Headers {
+			for _, value := range values {
+				aggregated.Headers.Add(name, value)
+			}
+		}
+	}
+
+	for _, violation := range aggregated.Violations {
+		messages = append(messages, violation.Err)
+		reasons = appendUnique(reasons, violation.ReasonCode())
+		bouncers = appendUnique(bouncers, violation.Bouncer)
+		decidersNames = appendUnique(decidersNames, violation.Decider)
+	}
+
+	aggregated.Err = strings.Join(messages, "; ")
+	aggregated.Reason = strings.Join(reasons, ",")
+	aggregated.Bouncer = strings.Join(bouncers, ",")
+	aggregated.Decider = strings.Join(decidersNames, ",")
+	return aggregated
+}
+
+// higherPrecedence returns whether status a should be picked over status b for an aggregated rejection.
+func higherPrecedence(a, b int) bool {
+	rank := func(status int) int {
+		for i, s := range statusPrecedence {
+			if s == status {
+				return i
+			}
+		}
+
+		return len(statusPrecedence)
+	}
+
+	rankA, rankB := rank(a), rank(b)
+	if rankA != rankB {
+		return rankA < rankB
+	}
+
+	// Neither is in statusPrecedence. Prefer client errors, the most general of them, or the most severe server error.
+	if (a < 500) != (b < 500) {
+		return a < 500
+	}
+
+	if a < 500 {
+		return a < b
+	}
+
+	return a > b
+}
+
+func appendUnique(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+
+	return append(values, value)
+}
@@ -0,0 +1,231 @@
+package bouncer_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+// rejectWith returns a decider that rejects every request. Like most deciders, it reads the body first.
+func rejectWith(status int, reason string) deciders.Template {
+	return deciders.TemplateFunc(func(config map[string]interface{}) (deciders.Decider, error) {
+		return deciders.DeciderFunc(func(req *http.Request) *deciders.HTTPError {
+			if req.Body != nil {
+				_, _ = io.Copy(io.Discard, req.Body)
+			}
+
+			return &deciders.HTTPError{
+				Status: status,
+				Err:    reason + " failed",
+				Reason: reason,
+			}
+		}), nil
+	})
+}
+
+// rejectTwice returns a decider that rejects requests with two violations, like deciders that check more than one thing do.
+func rejectTwice() deciders.Template {
+	return deciders.TemplateFunc(func(config map[string]interface{}) (deciders.Decider, error) {
+		return deciders.DeciderFunc(func(req *http.Request) *deciders.HTTPError {
+			return &deciders.HTTPError{
+				Status: http.StatusBadRequest,
+				Err:    "first failed; second failed",
+				Reason: "twice",
+				Violations: []*deciders.HTTPError{
+					{Status: http.StatusBadRequest, Err: "first failed", Reason: "first"},
+					{Status: http.StatusBadRequest, Err: "second failed", Reason: "second"},
+				},
+			}
+		}), nil
+	})
+}
+
+// requireSilence returns a decider that rejects requests whose body isn't a silence, like most deciders do.
+func requireSilence() deciders.Template {
+	return deciders.TemplateFunc(func(config map[string]interface{}) (deciders.Decider, error) {
+		return deciders.DeciderFunc(func(req *http.Request) *deciders.HTTPError {
+			if _, err := deciders.ParseSilence(req.Body); err != nil {
+				return &deciders.HTTPError{
+					Status: http.StatusBadRequest,
+					Err:    err.Error(),
+					Reason: deciders.ReasonInvalidRequest,
+				}
+			}
+
+			return nil
+		}), nil
+	})
+}
+
+func TestEvaluation(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	registry := bouncer.NewRegistry()
+	require.NoError(t, registry.Register("BadRequest", rejectWith(http.StatusBadRequest, "bad_request")))
+	require.NoError(t, registry.Register("Forbidden", rejectWith(http.StatusForbidden, "forbidden")))
+	require.NoError(t, registry.Register("Broken", rejectWith(http.StatusBadGateway, "broken")))
+	require.NoError(t, registry.Register("Twice", rejectTwice()))
+	require.NoError(t, registry.Register("RequireSilence", requireSilence()))
+
+	testCases := []struct {
+		name               string
+		serialized         string
+		expectedStatus     int
+		expectedViolations []bouncer.ErrorBody
+	}{
+		{
+			name: "first by default",
+			serialized: `
+bouncers:
+  - name: one
+    method: POST
+    uriRegex: .*
+    deciders:
+      - name: BadRequest
+      - name: Forbidden
+  - name: two
+    method: POST
+    uriRegex: .*
+    deciders:
+      - name: Broken
+`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "all in one bouncer",
+			serialized: `
+bouncers:
+  - name: one
+    method: POST
+    uriRegex: .*
+    evaluation: all
+    deciders:
+      - name: BadRequest
+      - name: Forbidden
+  - name: two
+    method: POST
+    uriRegex: .*
+    deciders:
+      - name: Broken
+`,
+			expectedStatus: http.StatusForbidden,
+			expectedViolations: []bouncer.ErrorBody{
+				{Error: "bad_request failed", Reason: "bad_request", Bouncer: "one", Decider: "BadRequest"},
+				{Error: "forbidden failed", Reason: "forbidden", Bouncer: "one", Decider: "Forbidden"},
+			},
+		},
+		{
+			name: "all globally",
+			serialized: `
+evaluation: all
+bouncers:
+  - name: one
+    method: POST
+    uriRegex: .*
+    deciders:
+      - name: Broken
+  - name: two
+    method: POST
+    uriRegex: .*
+    evaluation: first
+    deciders:
+      - name: BadRequest
+      - name: Forbidden
+`,
+			expectedStatus: http.StatusBadRequest,
+			expectedViolations: []bouncer.ErrorBody{
+				{Error: "broken failed", Reason: "broken", Bouncer: "one", Decider: "Broken"},
+				{Error: "bad_request failed", Reason: "bad_request", Bouncer: "two", Decider: "BadRequest"},
+			},
+		},
+		{
+			name: "all globally after a bouncer that stops at the first rejection",
+			serialized: `
+evaluation: all
+bouncers:
+  - name: one
+    method: POST
+    uriRegex: .*
+    evaluation: first
+    deciders:
+      - name: RequireSilence
+      - name: Forbidden
+      - name: Broken
+  - name: two
+    method: POST
+    uriRegex: .*
+    deciders:
+      - name: RequireSilence
+      - name: BadRequest
+`,
+			expectedStatus: http.StatusForbidden,
+			expectedViolations: []bouncer.ErrorBody{
+				{Error: "forbidden failed", Reason: "forbidden", Bouncer: "one", Decider: "Forbidden"},
+				{Error: "bad_request failed", Reason: "bad_request", Bouncer: "two", Decider: "BadRequest"},
+			},
+		},
+		{
+			name: "all with deciders that report more than one violation",
+			serialized: `
+bouncers:
+  - name: one
+    method: POST
+    uriRegex: .*
+    evaluation: all
+    deciders:
+      - name: Twice
+      - name: Forbidden
+`,
+			expectedStatus: http.StatusForbidden,
+			expectedViolations: []bouncer.ErrorBody{
+				{Error: "first failed", Reason: "first", Bouncer: "one", Decider: "Twice"},
+				{Error: "second failed", Reason: "second", Bouncer: "one", Decider: "Twice"},
+				{Error: "forbidden failed", Reason: "forbidden", Bouncer: "one", Decider: "Forbidden"},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config, err := bouncer.ParseConfigWithRegistry([]byte(testCase.serialized+"errorResponses:\n  format: json\n"), registry)
+			require.NoError(t, err)
+
+			frontend := httptest.NewServer(bouncer.NewBouncingReverseProxyWithConfig(backendURL, config, http.DefaultTransport))
+			defer frontend.Close()
+
+			response, err := frontend.Client().Post(frontend.URL+"/api/v2/silences", "application/json", strings.NewReader("{}"))
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			var body bouncer.ErrorBody
+			require.NoError(t, json.NewDecoder(response.Body).Decode(&body))
+			require.Equal(t, testCase.expectedStatus, response.StatusCode)
+			require.Equal(t, testCase.expectedViolations, body.Violations)
+		})
+	}
+}
+
+func TestEvaluationConfig(t *testing.T) {
+	_, err := bouncer.ParseConfig([]byte(`evaluation: some`))
+	require.Error(t, err)
+
+	_, err = bouncer.ParseConfig([]byte(`
+bouncers:
+  - method: POST
+    uriRegex: .*
+    evaluation: most
+`))
+	require.Error(t, err)
+}
@@ -0,0 +1,22 @@
+package bouncer
+
+import (
+	"net/http/httputil"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var Sampled = sampled
+
+func DryRunRejections(bouncer, decider, reason string) prometheus.Collector {
+	return dryRunRejectionsTotal.WithLabelValues(bouncer, decider, reason)
+}
+
+func Warnings(bouncer, decider, reason string) prometheus.Collector {
+	return warningsTotal.WithLabelValues(bouncer, decider, reason)
+}
+
+func SetApprovalsClock(proxy *httputil.ReverseProxy, now func() time.Time) {
+	proxy.Transport.(bouncingTransport).active.Load().approvals.now = now
+}
@@ -0,0 +1,133 @@
+package bouncer
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+type hooksSerialized struct {
+	OnAccepted         []deciderSerialized `yaml:"onAccepted"`
+	OnRejected         []deciderSerialized `yaml:"onRejected"`
+	OnUpstreamResponse []deciderSerialized `yaml:"onUpstreamResponse"`
+}
+
+// Hooks are side effects that a Bouncer runs once the outcome of a request that it matched is known.
+type Hooks struct {
+	// OnAccepted hooks run when every bouncer has accepted a request, after the backend has responded (or failed to).
+	OnAccepted []deciders.Hook
+
+	// OnRejected hooks run when any bouncer has rejected a request, or would have if it wasn't in dry run mode.
+	OnRejected []deciders.Hook
+
+	// OnUpstreamResponse hooks run when the backend has responded to an accepted request.
+	OnUpstreamResponse []deciders.Hook
+}
+
+func parseHooks(serialized hooksSerialized, registry *Registry) (Hooks, error) {
+	var hooks Hooks
+	var err error
+	if hooks.OnAccepted, err = makeHooks(serialized.OnAccepted, registry); err != nil {
+		return Hooks{}, err
+	}
+
+	if hooks.OnRejected, err = makeHooks(serialized.OnRejected, registry); err != nil {
+		hooks.Close()
+		return Hooks{}, err
+	}
+
+	if hooks.OnUpstreamResponse, err = makeHooks(serialized.OnUpstreamResponse, registry); err != nil {
+		hooks.Close()
+		return Hooks{}, err
+	}
+
+	return hooks, nil
+}
+
+func makeHooks(serialized []deciderSerialized, registry *Registry) ([]deciders.Hook, error) {
+	hooks := make([]deciders.Hook, 0, len(serialized))
+	for _, serializedHook := range serialized {
+		template, exists := registry.GetHook(serializedHook.Name)
+		if !exists {
+			closeAll(hooks)
+			return nil, fmt.Errorf("no hook template named %q found", serializedHook.Name)
+		}
+
+		hook, err := template.Make(serializedHook.Config)
+		if err != nil {
+			closeAll(hooks)
+			return nil, fmt.Errorf("failed to create hook %q: %s", serializedHook.Name, err)
+		}
+
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, nil
+}
+
+func makeMutators(serialized []deciderSerialized, registry *Registry) ([]deciders.Mutator, []string, error) {
+	mutators := make([]deciders.Mutator, 0, len(serialized))
+	names := make([]string, 0, len(serialized))
+	for _, serializedMutator := range serialized {
+		template, exists := registry.GetMutator(serializedMutator.Name)
+		if !exists {
+			closeAll(mutators)
+			return nil, nil, fmt.Errorf("no mutator template named %q found", serializedMutator.Name)
+		}
+
+		mutator, err := template.Make(serializedMutator.Config)
+		if err != nil {
+			closeAll(mutators)
+			return nil, nil, fmt.Errorf("failed to create mutator %q: %s", serializedMutator.Name, err)
+		}
+
+		mutators = append(mutators, mutator)
+		names = append(names, serializedMutator.Name)
+	}
+
+	return mutators, names, nil
+}
+
+// Empty returns whether there are no hooks at all.
+func (h Hooks) Empty() bool {
+	return len(h.OnAccepted) == 0 && len(h.OnRejected) == 0 && len(h.OnUpstreamResponse) == 0
+}
+
+// Close releases any resources held by the hooks.
+func (h Hooks) Close() {
+	closeAll(h.OnAccepted)
+	closeAll(h.OnRejected)
+	closeAll(h.OnUpstreamResponse)
+}
+
+// run runs the hooks appropriate for the outcome described by the given event.
+func (h Hooks) run(event *deciders.Event) {
+	if event.Rejection != nil {
+		runHooks(h.OnRejected, event)
+		return
+	}
+
+	runHooks(h.OnAccepted, event)
+	if event.Response != nil {
+		runHooks(h.OnUpstreamResponse, event)
+	}
+}
+
+func runHooks(hooks []deciders.Hook, event *deciders.Event) {
+	for _, hook := range hooks {
+		hook.Run(event)
+	}
+}
+
+// closeAll closes everything in the given slice that implements io.Closer.
+func closeAll[T any](things []T) {
+	for _, thing := range things {
+		if closer, ok := any(thing).(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Warn().Err(err).Msg("Failed to close decider")
+			}
+		}
+	}
+}
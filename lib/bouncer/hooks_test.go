@@ -0,0 +1,172 @@
+package bouncer_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/grafana/regexp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+type recordedEvent struct {
+	hook         string
+	body         string
+	rejected     bool
+	bouncer      string
+	dryRun       bool
+	status       int
+	responseBody string
+}
+
+func recordingHook(name string, events chan recordedEvent) deciders.Hook {
+	return deciders.HookFunc(func(event *deciders.Event) {
+		recorded := recordedEvent{
+			hook:     name,
+			body:     string(event.Body),
+			rejected: event.Rejection != nil,
+			bouncer:  event.Bouncer,
+			dryRun:   event.DryRun,
+		}
+
+		if event.Response != nil {
+			recorded.status = event.Response.StatusCode
+			recorded.responseBody = string(event.ResponseBody)
+		}
+
+		events <- recorded
+	})
+}
+
+func TestHooks(t *testing.T) {
+	const backendResponse = "I am the backend"
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		require.Equal(t, "accept", string(body), "Expected the backend to still get the body")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(backendResponse))
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	events := make(chan recordedEvent, 10)
+	bouncers := []bouncer.Bouncer{
+		{
+			Target: bouncer.Target{
+				Method:   http.MethodPost,
+				URIRegex: regexp.MustCompile(".*"),
+			},
+			Deciders: []deciders.Decider{
+				deciders.DeciderFunc(func(req *http.Request) *deciders.HTTPError {
+					body, _ := io.ReadAll(req.Body)
+					if string(body) != "accept" {
+						return &deciders.HTTPError{Status: http.StatusBadRequest, Err: "No"}
+					}
+
+					return nil
+				}),
+			},
+			Hooks: bouncer.Hooks{
+				OnAccepted:         []deciders.Hook{recordingHook("onAccepted", events)},
+				OnRejected:         []deciders.Hook{recordingHook("onRejected", events)},
+				OnUpstreamResponse: []deciders.Hook{recordingHook("onUpstreamResponse", events)},
+			},
+		},
+	}
+
+	frontend := httptest.NewServer(bouncer.NewBouncingReverseProxy(backendURL, bouncers, http.DefaultTransport))
+	defer frontend.Close()
+
+	response, err := frontend.Client().Post(frontend.URL, "text/plain", strings.NewReader("accept"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, backendResponse, string(body))
+
+	require.Equal(t, recordedEvent{hook: "onAccepted", body: "accept", status: http.StatusAccepted, responseBody: backendResponse}, <-events)
+	require.Equal(t, recordedEvent{hook: "onUpstreamResponse", body: "accept", status: http.StatusAccepted, responseBody: backendResponse}, <-events)
+
+	response, err = frontend.Client().Post(frontend.URL, "text/plain", strings.NewReader("reject"))
+	require.NoError(t, err)
+	response.Body.Close()
+	require.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	require.Equal(t, recordedEvent{hook: "onRejected", body: "reject", rejected: true}, <-events)
+	require.Empty(t, events)
+}
+
+func TestDryRunHooks(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	events := make(chan recordedEvent, 10)
+	bouncers := []bouncer.Bouncer{
+		{
+			Name: "dryrun",
+			Target: bouncer.Target{
+				Method:   http.MethodPost,
+				URIRegex: regexp.MustCompile(".*"),
+			},
+			Deciders: []deciders.Decider{
+				deciders.DeciderFunc(func(req *http.Request) *deciders.HTTPError {
+					return &deciders.HTTPError{Status: http.StatusBadRequest, Err: "No"}
+				}),
+			},
+			Hooks: bouncer.Hooks{
+				OnAccepted: []deciders.Hook{recordingHook("onAccepted", events)},
+				OnRejected: []deciders.Hook{recordingHook("onRejected", events)},
+			},
+			DryRun: true,
+		},
+	}
+
+	frontend := httptest.NewServer(bouncer.NewBouncingReverseProxy(backendURL, bouncers, http.DefaultTransport))
+	defer frontend.Close()
+
+	response, err := frontend.Client().Post(frontend.URL, "text/plain", strings.NewReader("reject"))
+	require.NoError(t, err)
+	response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	require.Equal(t, recordedEvent{hook: "onRejected", body: "reject", rejected: true, bouncer: "dryrun", dryRun: true}, <-events)
+	require.Equal(t, recordedEvent{hook: "onAccepted", body: "reject", status: http.StatusOK}, <-events)
+	require.Empty(t, events)
+}
+
+func TestParseHooks(t *testing.T) {
+	bouncers, err := bouncer.ParseBouncers([]byte(`
+bouncers:
+  - method: POST
+    uriRegex: /api/v2/silences
+    hooks:
+      onAccepted:
+        - name: Mirror
+          config:
+            destination: http://localhost:9093
+`))
+	require.NoError(t, err)
+	require.Len(t, bouncers, 1)
+	require.Len(t, bouncers[0].Hooks.OnAccepted, 1)
+	require.Equal(t, "bouncer-0", bouncers[0].Name, "Expected unnamed bouncers to be named after their index")
+	bouncers[0].Close()
+
+	_, err = bouncer.ParseBouncers([]byte(`
+bouncers:
+  - method: POST
+    uriRegex: /api/v2/silences
+    hooks:
+      onRejected:
+        - name: AllSilencesHaveAuthor
+`))
+	require.Error(t, err, "Expected deciders not to be usable as hooks")
+}
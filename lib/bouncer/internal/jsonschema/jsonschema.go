@@ -0,0 +1,117 @@
+// Package jsonschema generates JSON Schemas describing config structs, so that editors can validate and autocomplete config files.
+package jsonschema
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/grafana/regexp"
+)
+
+// Schema is a JSON Schema document.
+type Schema = map[string]interface{}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	regexpType   = reflect.TypeOf(&regexp.Regexp{})
+	locationType = reflect.TypeOf(&time.Location{})
+)
+
+// Reflect generates a Schema for the given value, naming struct fields by the given struct tag (e.g. "yaml" or "mapstructure").
+func Reflect(v interface{}, tag string) Schema {
+	if v == nil {
+		return Schema{"type": "object"}
+	}
+
+	return typeSchema(reflect.TypeOf(v), tag)
+}
+
+func typeSchema(t reflect.Type, tag string) Schema {
+	switch t {
+	case durationType:
+		return Schema{
+			"type":        "string",
+			"pattern":     `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`,
+			"description": "A duration, e.g. 1h30m",
+		}
+	case regexpType:
+		return Schema{
+			"type":   "string",
+			"format": "regex",
+		}
+	case locationType:
+		return Schema{
+			"type":        "string",
+			"description": "An IANA time zone name, e.g. Pacific/Auckland",
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), tag)
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return Schema{
+			"type":  "array",
+			"items": typeSchema(t.Elem(), tag),
+		}
+	case reflect.Map:
+		return Schema{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem(), tag),
+		}
+	case reflect.Struct:
+		return structSchema(t, tag)
+	default:
+		return Schema{}
+	}
+}
+
+func structSchema(t reflect.Type, tag string) Schema {
+	properties := Schema{}
+	schema := Schema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			continue
+		}
+
+		// Squashed (mapstructure) and inlined (yaml) structs have their fields decoded as if they were part of the parent.
+		if (strings.Contains(opts, "squash") || strings.Contains(opts, "inline")) && field.Type.Kind() == reflect.Struct {
+			for name, property := range structSchema(field.Type, tag)["properties"].(Schema) {
+				properties[name] = property
+			}
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+			if tag == "yaml" {
+				name = strings.ToLower(name)
+			}
+		}
+
+		properties[name] = typeSchema(field.Type, tag)
+	}
+
+	return schema
+}
@@ -0,0 +1,149 @@
+package bouncer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+const (
+	// ModeEnforce rejects requests that the decider rejects. This is the default.
+	ModeEnforce = "enforce"
+	// ModeDryRun logs and records requests that the decider would have rejected, and lets them through.
+	ModeDryRun = "dryrun"
+	// ModeWarn lets requests that the decider rejects through, with a Warning header on the response.
+	ModeWarn = "warn"
+	// ModeApproval holds requests that the decider rejects until someone else approves them. It requires approvals to be configured.
+	ModeApproval = "approval"
+
+	warningAgent = "alertmanager-bouncer"
+
+	// reasonOther is the reason label of rejections whose Reason isn't one of the deciders.Reason constants.
+	reasonOther = "other"
+)
+
+var (
+	dryRunRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alertmanager_bouncer_dryrun_rejections_total",
+		Help: "The number of requests that deciders would have rejected, if they weren't in dry run mode or outside of their enforcePercent",
+	}, []string{"bouncer", "decider", "reason"})
+	warningsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alertmanager_bouncer_warnings_total",
+		Help: "The number of requests that were let through with a warning by deciders in warn mode",
+	}, []string{"bouncer", "decider", "reason"})
+)
+
+// auditLog records requests that deciders let through despite rejecting them, so that the effects of
+// enforcing a decider can be judged before it's enforced.
+var auditLog = log.With().Str("log", "audit").Logger()
+
+// deciderOptions are the options that a decider was configured with in its bouncer.
+type deciderOptions struct {
+	name           string
+	mode           string
+	enforcePercent *float64
+}
+
+func (d deciderOptions) validate() error {
+	switch d.mode {
+	case "", ModeEnforce, ModeDryRun, ModeWarn, ModeApproval:
+	default:
+		return fmt.Errorf("mode must be one of %q, %q, %q, or %q, got %q", ModeEnforce, ModeDryRun, ModeWarn, ModeApproval, d.mode)
+	}
+
+	if d.enforcePercent != nil {
+		if d.mode != "" && d.mode != ModeEnforce {
+			return fmt.Errorf("enforcePercent can only be used in %q mode", ModeEnforce)
+		}
+
+		if *d.enforcePercent < 0 || *d.enforcePercent > 100 {
+			return fmt.Errorf("enforcePercent must be between 0 and 100, got %f", *d.enforcePercent)
+		}
+	}
+
+	return nil
+}
+
+// options returns the options of the decider at the given index, falling back to the defaults for Bouncers that weren't parsed from a config.
+func (b *Bouncer) options(decider int) deciderOptions {
+	if decider < len(b.deciderOptions) {
+		return b.deciderOptions[decider]
+	}
+
+	return deciderOptions{name: fmt.Sprintf("decider-%d", decider)}
+}
+
+// mode returns the mode that the decider at the given index should act in for the given request, with the given body.
+func (b *Bouncer) mode(decider int, req *http.Request, body []byte) string {
+	if b.DryRun {
+		return ModeDryRun
+	}
+
+	options := b.options(decider)
+	switch {
+	case options.mode == ModeDryRun || options.mode == ModeWarn || options.mode == ModeApproval:
+		return options.mode
+	case options.enforcePercent != nil && !sampled(req, body, *options.enforcePercent):
+		return ModeDryRun
+	default:
+		return ModeEnforce
+	}
+}
+
+// sampled returns whether the given request, with the given body, falls within the given percentage of requests. The decision is
+// based on a hash of the method, URI, and body, so that retrying the same request always gets the same result, but requests without
+// a body, like expiring a silence, don't all get the same one.
+func sampled(req *http.Request, body []byte, percent float64) bool {
+	hash := fnv.New32a()
+	hash.Write([]byte(req.Method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(req.URL.RequestURI()))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return float64(hash.Sum32()%10000) < percent*100
+}
+
+// audit records that the given rejection wasn't enforced because its decider was in the given mode.
+func audit(req *http.Request, mode string, err *deciders.HTTPError) {
+	auditLog.Info().
+		Str("mode", mode).
+		Str("bouncer", err.Bouncer).
+		Str("decider", err.Decider).
+		Str("reason", err.ReasonCode()).
+		Int("status", err.Status).
+		Str("method", req.Method).
+		Str("uri", req.URL.RequestURI()).
+		Str("error", err.Err).
+		Msg("Request let through despite being rejected")
+
+	switch mode {
+	case ModeDryRun:
+		dryRunRejectionsTotal.WithLabelValues(err.Bouncer, err.Decider, metricReason(err)).Inc()
+	case ModeWarn:
+		warningsTotal.WithLabelValues(err.Bouncer, err.Decider, metricReason(err)).Inc()
+	}
+}
+
+// metricReason returns the reason label for the given rejection. Webhooks, plugins, and wasm policies can return any Reason they
+// like, so only the deciders.Reason constants are used as labels, and everything else is counted as reasonOther.
+func metricReason(err *deciders.HTTPError) string {
+	switch reason := err.ReasonCode(); reason {
+	case deciders.ReasonRejected, deciders.ReasonInvalidRequest, deciders.ReasonDeciderFailed:
+		return reason
+	default:
+		return reasonOther
+	}
+}
+
+// addWarnings adds a Warning header to the given headers for each of the given rejections.
+func addWarnings(header http.Header, warnings []*deciders.HTTPError) {
+	for _, warning := range warnings {
+		header.Add("Warning", fmt.Sprintf("299 %s %s", warningAgent, strconv.Quote(warning.Err)))
+	}
+}
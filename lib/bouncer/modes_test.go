@@ -0,0 +1,204 @@
+package bouncer_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+)
+
+func TestDeciderModes(t *testing.T) {
+	const backendResponse = "I am the backend"
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(backendResponse))
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	registry := bouncer.NewRegistry()
+	require.NoError(t, registry.Register("BadRequest", rejectWith(http.StatusBadRequest, "bad_request")))
+	require.NoError(t, registry.Register("Forbidden", rejectWith(http.StatusForbidden, "forbidden")))
+	require.NoError(t, registry.Register("Invalid", rejectWith(http.StatusBadRequest, deciders.ReasonInvalidRequest)))
+
+	testCases := []struct {
+		name             string
+		deciders         string
+		expectedStatus   int
+		expectedWarnings []string
+		expectedDryRuns  float64
+		// decider and expectedReason are the labels that the first decider's rejections are counted under,
+		// BadRequest and "other" if they're empty.
+		decider        string
+		expectedReason string
+	}{
+		{
+			name: "enforce",
+			deciders: `
+      - name: BadRequest
+        mode: enforce
+`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "warn",
+			deciders: `
+      - name: BadRequest
+        mode: warn
+`,
+			expectedStatus:   http.StatusOK,
+			expectedWarnings: []string{`299 alertmanager-bouncer "bad_request failed"`},
+		},
+		{
+			name: "dryrun",
+			deciders: `
+      - name: BadRequest
+        mode: dryrun
+`,
+			expectedStatus:  http.StatusOK,
+			expectedDryRuns: 1,
+		},
+		{
+			name: "warnings are sent with rejections",
+			deciders: `
+      - name: BadRequest
+        mode: warn
+      - name: Forbidden
+`,
+			expectedStatus:   http.StatusForbidden,
+			expectedWarnings: []string{`299 alertmanager-bouncer "bad_request failed"`},
+		},
+		{
+			name: "never enforced",
+			deciders: `
+      - name: BadRequest
+        enforcePercent: 0
+`,
+			expectedStatus:  http.StatusOK,
+			expectedDryRuns: 1,
+		},
+		{
+			name: "always enforced",
+			deciders: `
+      - name: BadRequest
+        enforcePercent: 100
+`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "known reasons are kept",
+			deciders: `
+      - name: Invalid
+        mode: dryrun
+`,
+			expectedStatus:  http.StatusOK,
+			expectedDryRuns: 1,
+			decider:         "Invalid",
+			expectedReason:  deciders.ReasonInvalidRequest,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			bouncerName := strings.ReplaceAll(testCase.name, " ", "-")
+			config, err := bouncer.ParseConfigWithRegistry([]byte(`
+bouncers:
+  - name: `+bouncerName+`
+    method: POST
+    uriRegex: .*
+    deciders:`+testCase.deciders), registry)
+			require.NoError(t, err)
+
+			decider, reason := "BadRequest", "other"
+			if testCase.decider != "" {
+				decider, reason = testCase.decider, testCase.expectedReason
+			}
+
+			dryRuns := bouncer.DryRunRejections(bouncerName, decider, reason)
+			warnings := bouncer.Warnings(bouncerName, decider, reason)
+
+			frontend := httptest.NewServer(bouncer.NewBouncingReverseProxyWithConfig(backendURL, config, http.DefaultTransport))
+			defer frontend.Close()
+
+			response, err := frontend.Client().Post(frontend.URL+"/api/v2/silences", "application/json", strings.NewReader("{}"))
+			require.NoError(t, err)
+			body, err := io.ReadAll(response.Body)
+			response.Body.Close()
+			require.NoError(t, err)
+
+			require.Equal(t, testCase.expectedStatus, response.StatusCode)
+			require.Equal(t, testCase.expectedWarnings, response.Header.Values("Warning"))
+			require.Equal(t, testCase.expectedDryRuns, promtestutil.ToFloat64(dryRuns))
+			require.Equal(t, float64(len(testCase.expectedWarnings)), promtestutil.ToFloat64(warnings))
+			if testCase.expectedStatus == http.StatusOK {
+				require.Equal(t, backendResponse, string(body))
+			}
+		})
+	}
+}
+
+func TestDeciderModesConfig(t *testing.T) {
+	testCases := []string{
+		`
+      - name: AllSilencesHaveAuthor
+        mode: loud
+        config:
+          domain: example.com
+`,
+		`
+      - name: AllSilencesHaveAuthor
+        enforcePercent: 150
+        config:
+          domain: example.com
+`,
+		`
+      - name: AllSilencesHaveAuthor
+        mode: warn
+        enforcePercent: 50
+        config:
+          domain: example.com
+`,
+		`
+      - name: AllSilencesHaveAuthor
+        mode: approval
+        config:
+          domain: example.com
+`,
+	}
+
+	for _, deciders := range testCases {
+		_, err := bouncer.ParseConfig([]byte(`
+bouncers:
+  - method: POST
+    uriRegex: .*
+    deciders:` + deciders))
+		require.Error(t, err)
+	}
+}
+
+func TestEnforcePercentSamplesBodilessRequests(t *testing.T) {
+	var enforced, notEnforced int
+	for i := 0; i < 100; i++ {
+		req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/v2/silence/%d", i), nil)
+		if bouncer.Sampled(req, nil, 50) {
+			enforced++
+		} else {
+			notEnforced++
+		}
+	}
+
+	require.NotZero(t, enforced, "Expected some expiries to be enforced")
+	require.NotZero(t, notEnforced, "Expected some expiries not to be enforced")
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v2/silence/1", nil)
+	require.Equal(t, bouncer.Sampled(req, nil, 50), bouncer.Sampled(req, nil, 50), "Expected retries to get the same result")
+}
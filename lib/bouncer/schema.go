@@ -0,0 +1,90 @@
+package bouncer
+
+import (
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/internal/jsonschema"
+)
+
+// Schema generates a JSON Schema describing a bouncers config file, with the deciders, hooks, and mutators (and their configs) from the given Registry.
+func Schema(registry *Registry) map[string]interface{} {
+	deciderSchemas := []interface{}{}
+	for _, name := range registry.Names() {
+		info, _ := registry.Info(name)
+		schema := templateSchema(name, info.TemplateMetadata)
+		properties := schema["properties"].(jsonschema.Schema)
+		properties["mode"] = jsonschema.Schema{"type": "string", "enum": []string{ModeEnforce, ModeDryRun, ModeWarn, ModeApproval}}
+		properties["enforcePercent"] = jsonschema.Schema{"type": "number", "minimum": 0, "maximum": 100}
+		deciderSchemas = append(deciderSchemas, schema)
+	}
+
+	hookSchemas := []interface{}{}
+	for _, name := range registry.HookNames() {
+		info, _ := registry.HookInfo(name)
+		hookSchemas = append(hookSchemas, templateSchema(name, info.TemplateMetadata))
+	}
+
+	mutatorSchemas := []interface{}{}
+	for _, name := range registry.MutatorNames() {
+		info, _ := registry.MutatorInfo(name)
+		mutatorSchemas = append(mutatorSchemas, templateSchema(name, info.TemplateMetadata))
+	}
+
+	bouncerSchema := jsonschema.Reflect(bouncerSerialized{}, "yaml")
+	bouncerProperties := bouncerSchema["properties"].(jsonschema.Schema)
+	bouncerProperties["deciders"] = jsonschema.Schema{
+		"type":  "array",
+		"items": jsonschema.Schema{"oneOf": deciderSchemas},
+	}
+
+	bouncerProperties["mutators"] = jsonschema.Schema{
+		"type":  "array",
+		"items": jsonschema.Schema{"oneOf": mutatorSchemas},
+	}
+
+	evaluationSchema := jsonschema.Schema{"type": "string", "enum": []string{EvaluationFirst, EvaluationAll}}
+	bouncerProperties["evaluation"] = evaluationSchema
+
+	for _, hookProperty := range bouncerProperties["hooks"].(jsonschema.Schema)["properties"].(jsonschema.Schema) {
+		hookProperty.(jsonschema.Schema)["items"] = jsonschema.Schema{"oneOf": hookSchemas}
+	}
+
+	errorResponsesSchema := jsonschema.Reflect(ErrorResponses{}, "yaml")
+	errorResponsesProperties := errorResponsesSchema["properties"].(jsonschema.Schema)
+	errorResponsesProperties["format"].(jsonschema.Schema)["enum"] = []string{ErrorFormatAuto, ErrorFormatText, ErrorFormatJSON}
+	errorResponsesProperties["v2Shape"].(jsonschema.Schema)["enum"] = []string{V2ShapeString, V2ShapeObject}
+
+	return jsonschema.Schema{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "Alertmanager Bouncer config",
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": jsonschema.Schema{
+			"bouncers": jsonschema.Schema{
+				"type":  "array",
+				"items": bouncerSchema,
+			},
+			"errorResponses": errorResponsesSchema,
+			"evaluation":     evaluationSchema,
+			"approvals":      jsonschema.Reflect(Approvals{}, "yaml"),
+		},
+	}
+}
+
+// templateSchema describes a reference to the template with the given name in a config file.
+func templateSchema(name string, metadata TemplateMetadata) jsonschema.Schema {
+	schema := jsonschema.Schema{
+		"type": "object",
+		"properties": jsonschema.Schema{
+			"name":   jsonschema.Schema{"const": name},
+			"config": deciders.ConfigSchema(metadata.Config),
+		},
+		"required":             []string{"name"},
+		"additionalProperties": false,
+	}
+
+	if metadata.Description != "" {
+		schema["description"] = metadata.Description
+	}
+
+	return schema
+}
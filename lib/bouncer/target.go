@@ -0,0 +1,289 @@
+package bouncer
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/grafana/regexp"
+)
+
+// TargetConfig is the serialized form of a Target, as it appears in the config of a bouncer. Every field is optional,
+// and a request has to match all of the ones that are set.
+type TargetConfig struct {
+	// Method and URIRegex are the original way of targeting requests. URIRegex is matched against the path and query string together.
+	Method   string `yaml:"method"`
+	URIRegex string `yaml:"uriRegex"`
+
+	Methods      []string              `yaml:"methods"`
+	PathRegex    string                `yaml:"pathRegex"`
+	Query        map[string]string     `yaml:"query"`
+	Headers      []HeaderMatcherConfig `yaml:"headers"`
+	HostRegex    string                `yaml:"hostRegex"`
+	SourceCIDRs  []string              `yaml:"sourceCIDRs"`
+	ContentTypes []string              `yaml:"contentTypes"`
+}
+
+// HeaderMatcherConfig is the serialized form of a HeaderMatcher. Exactly one of Equals, Contains, Regex, or Present must be set.
+type HeaderMatcherConfig struct {
+	Name     string `yaml:"name"`
+	Equals   string `yaml:"equals"`
+	Contains string `yaml:"contains"`
+	Regex    string `yaml:"regex"`
+	Present  *bool  `yaml:"present"`
+}
+
+// Target Represents a potential target for an HTTP request with both a Method (Which represents the HTTP method), and a URI Regex
+// which matches the URI of the request. Targets can additionally match on the path and query separately, headers, the host,
+// the source IP, and the content type of the request. Zero values match everything, except for the methods: a Target without
+// a Method or any Methods matches no requests, as it always has.
+type Target struct {
+	Method   string
+	URIRegex *regexp.Regexp
+
+	Methods      []string
+	PathRegex    *regexp.Regexp
+	Query        map[string]*regexp.Regexp
+	Headers      []HeaderMatcher
+	HostRegex    *regexp.Regexp
+	SourceCIDRs  []netip.Prefix
+	ContentTypes []string
+}
+
+// HeaderMatcher matches a header of a request. If Regex is set, a value of the header has to match it,
+// otherwise Present controls whether the header has to be there or not.
+type HeaderMatcher struct {
+	Name    string
+	Regex   *regexp.Regexp
+	Present bool
+}
+
+// ParseTarget converts a TargetConfig into a Target, compiling its regexes and parsing its CIDRs.
+func ParseTarget(config TargetConfig) (Target, error) {
+	var target Target
+	var err error
+
+	target.Method = config.Method
+	target.Methods = config.Methods
+	target.ContentTypes = config.ContentTypes
+
+	if target.URIRegex, err = compileOptional(config.URIRegex); err != nil {
+		return Target{}, fmt.Errorf("invalid uriRegex: %w", err)
+	}
+
+	if target.PathRegex, err = compileOptional(config.PathRegex); err != nil {
+		return Target{}, fmt.Errorf("invalid pathRegex: %w", err)
+	}
+
+	if target.HostRegex, err = compileOptional(config.HostRegex); err != nil {
+		return Target{}, fmt.Errorf("invalid hostRegex: %w", err)
+	}
+
+	if len(config.Query) > 0 {
+		target.Query = make(map[string]*regexp.Regexp, len(config.Query))
+		for name, pattern := range config.Query {
+			if target.Query[name], err = regexp.Compile(pattern); err != nil {
+				return Target{}, fmt.Errorf("invalid regex for query parameter %q: %w", name, err)
+			}
+		}
+	}
+
+	for _, headerConfig := range config.Headers {
+		matcher, err := parseHeaderMatcher(headerConfig)
+		if err != nil {
+			return Target{}, err
+		}
+
+		target.Headers = append(target.Headers, matcher)
+	}
+
+	for _, cidr := range config.SourceCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid source CIDR: %w", err)
+		}
+
+		target.SourceCIDRs = append(target.SourceCIDRs, prefix.Masked())
+	}
+
+	return target, nil
+}
+
+func parseHeaderMatcher(config HeaderMatcherConfig) (HeaderMatcher, error) {
+	if config.Name == "" {
+		return HeaderMatcher{}, fmt.Errorf("header matchers must have a name")
+	}
+
+	set := 0
+	for _, isSet := range []bool{config.Equals != "", config.Contains != "", config.Regex != "", config.Present != nil} {
+		if isSet {
+			set++
+		}
+	}
+
+	if set != 1 {
+		return HeaderMatcher{}, fmt.Errorf("header matcher for %q must have exactly one of equals, contains, regex, or present", config.Name)
+	}
+
+	matcher := HeaderMatcher{Name: config.Name, Present: true}
+	var err error
+	switch {
+	case config.Equals != "":
+		matcher.Regex = regexp.MustCompile("^" + regexp.QuoteMeta(config.Equals) + "$")
+	case config.Contains != "":
+		matcher.Regex = regexp.MustCompile(regexp.QuoteMeta(config.Contains))
+	case config.Regex != "":
+		if matcher.Regex, err = regexp.Compile(config.Regex); err != nil {
+			return HeaderMatcher{}, fmt.Errorf("invalid regex for header %q: %w", config.Name, err)
+		}
+	default:
+		matcher.Present = *config.Present
+	}
+
+	return matcher, nil
+}
+
+func compileOptional(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	return regexp.Compile(pattern)
+}
+
+// Matches returns whether the given the given Target matches the given request, i.e. every part of the Target that is set matches it.
+func (t Target) Matches(req *http.Request) bool {
+	return t.Mismatch(req) == ""
+}
+
+// Mismatch returns a description of the first part of the Target that doesn't match the given request, or an empty string if it matches.
+func (t Target) Mismatch(req *http.Request) string {
+	if len(t.methods()) == 0 {
+		return "no method is set, so no requests match"
+	}
+
+	if !t.methodMatches(req.Method) {
+		return fmt.Sprintf("method %s isn't one of %s", req.Method, strings.Join(t.methods(), ", "))
+	}
+
+	if t.URIRegex != nil && !t.URIRegex.MatchString(req.URL.RequestURI()) {
+		return fmt.Sprintf("uri %s doesn't match %q", req.URL.RequestURI(), t.URIRegex)
+	}
+
+	if t.PathRegex != nil && !t.PathRegex.MatchString(req.URL.Path) {
+		return fmt.Sprintf("path %s doesn't match %q", req.URL.Path, t.PathRegex)
+	}
+
+	query := req.URL.Query()
+	for name, regex := range t.Query {
+		if !anyMatch(regex, query[name]) {
+			return fmt.Sprintf("query parameter %s doesn't match %q", name, regex)
+		}
+	}
+
+	for _, matcher := range t.Headers {
+		if !matcher.Matches(req.Header) {
+			return fmt.Sprintf("header %s doesn't match", matcher.Name)
+		}
+	}
+
+	if t.HostRegex != nil && !t.HostRegex.MatchString(hostWithoutPort(req.Host)) {
+		return fmt.Sprintf("host %s doesn't match %q", req.Host, t.HostRegex)
+	}
+
+	if len(t.SourceCIDRs) > 0 && !t.sourceMatches(req.RemoteAddr) {
+		return fmt.Sprintf("source address %s isn't in any of the source CIDRs", req.RemoteAddr)
+	}
+
+	if len(t.ContentTypes) > 0 && !t.contentTypeMatches(req.Header.Get("Content-Type")) {
+		return fmt.Sprintf("content type %q isn't one of %s", req.Header.Get("Content-Type"), strings.Join(t.ContentTypes, ", "))
+	}
+
+	return ""
+}
+
+// methods returns all the methods that the Target matches.
+func (t Target) methods() []string {
+	if t.Method == "" {
+		return t.Methods
+	}
+
+	return append([]string{t.Method}, t.Methods...)
+}
+
+func (t Target) methodMatches(method string) bool {
+	for _, m := range t.methods() {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t Target) sourceMatches(remoteAddr string) bool {
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range t.SourceCIDRs {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t Target) contentTypeMatches(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, ct := range t.ContentTypes {
+		if strings.EqualFold(ct, mediaType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Matches returns whether the given headers match the HeaderMatcher.
+func (h HeaderMatcher) Matches(header http.Header) bool {
+	values := header.Values(h.Name)
+	if h.Regex == nil {
+		return (len(values) > 0) == h.Present
+	}
+
+	return anyMatch(h.Regex, values)
+}
+
+func anyMatch(regex *regexp.Regexp, values []string) bool {
+	for _, value := range values {
+		if regex.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hostWithoutPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+
+	return host
+}
@@ -1,21 +1,332 @@
 package bouncer
 
 import (
+	"fmt"
+	"sort"
+	"sync"
+
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/blastradius"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/commentquality"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/duplicatesilences"
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/mirror"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/notify"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/oncall"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/plugin"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/ratelimit"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/silenceexpiry"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/silencequota"
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/silenceshaveauthor"
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/silenceshaveticket"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/silencesmatchalerts"
 	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/silencesnotonweekends"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/silencetemplate"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/silenceupdates"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/wasm"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders/webhook"
 )
 
-var deciderTemplates = map[string]deciders.Template{
-	"AllSilencesHaveAuthor":        deciders.TemplateFunc(silenceshaveauthor.New),
-	"Mirror":                       deciders.TemplateFunc(mirror.New),
-	"SilencesDontExpireOnWeekends": deciders.TemplateFunc(silencesnotonweekends.New),
-	"LongSilencesHaveTicket":       deciders.TemplateFunc(silenceshaveticket.New),
+// DefaultRegistry is the Registry used by ParseBouncers. It contains all the deciders that ship with the bouncer,
+// and any that have been added with RegisterDeciderTemplate.
+var DefaultRegistry = newDefaultRegistry()
+
+func newDefaultRegistry() *Registry {
+	registry := NewRegistry()
+	registry.mustRegister("AllSilencesHaveAuthor", deciders.TemplateFunc(silenceshaveauthor.New),
+		WithConfig(silenceshaveauthor.SilencesHaveAuthor{}),
+		WithDescription("Rejects silences whose createdBy doesn't end with the given domain"))
+	registry.mustRegister("Mirror", deciders.TemplateFunc(mirror.New),
+		WithConfig(mirror.MirrorDecider{}),
+		WithDescription("Mirrors requests to another Alertmanager"))
+	registry.mustRegister("SilencesDontExpireOnWeekends", deciders.TemplateFunc(silencesnotonweekends.New),
+		WithConfig(silencesnotonweekends.SilencesNotOnWeekends{}),
+		WithDescription("Rejects silences that expire on a Saturday or Sunday"))
+	registry.mustRegister("LongSilencesHaveTicket", deciders.TemplateFunc(silenceshaveticket.New),
+		WithConfig(silenceshaveticket.SilencesHaveTicket{}),
+		WithDescription("Rejects silences longer than maxLength that don't reference a ticket in their comment"))
+	registry.mustRegister("Webhook", deciders.TemplateFunc(webhook.New),
+		WithConfig(webhook.Webhook{}),
+		WithDescription("Delegates decisions to an external HTTP service"))
+	registry.mustRegister("Plugin", deciders.TemplateFunc(plugin.New),
+		WithConfig(plugin.Plugin{}),
+		WithDescription("Delegates decisions to an out of process gRPC plugin"))
+	registry.mustRegister("Wasm", deciders.TemplateFunc(wasm.New),
+		WithConfig(wasm.Wasm{}),
+		WithDescription("Runs a policy compiled to WebAssembly"))
+	registry.mustRegister("OnlyCreatorCanExpireSilences", deciders.TemplateFunc(silenceexpiry.New),
+		WithConfig(silenceexpiry.OnlyCreatorCanExpire{}),
+		WithDescription("Rejects requests to expire silences from anyone but their creator, or an admin"))
+	registry.mustRegister("SilenceUpdatesDontExceedMaxDuration", deciders.TemplateFunc(silenceupdates.New),
+		WithConfig(silenceupdates.UpdatesDontExceedMaxDuration{}),
+		WithDescription("Rejects updates that extend silences past maxDuration from when they started"))
+	registry.mustRegister("NoDuplicateSilences", deciders.TemplateFunc(duplicatesilences.New),
+		WithConfig(duplicatesilences.NoDuplicateSilences{}),
+		WithDescription("Rejects silences that an active silence in the backend already covers"))
+	registry.mustRegister("SilencesMatchAlerts", deciders.TemplateFunc(silencesmatchalerts.New),
+		WithConfig(silencesmatchalerts.SilencesMatchAlerts{}),
+		WithDescription("Rejects silences that don't match any alerts in the backend, or in Prometheus rule files"))
+	registry.mustRegister("BlastRadius", deciders.TemplateFunc(blastradius.New),
+		WithConfig(blastradius.BlastRadius{}),
+		WithDescription("Rejects silences that would mute too many firing alerts, or alerts from too many teams"))
+	registry.mustRegister("RateLimit", deciders.TemplateFunc(ratelimit.New),
+		WithConfig(ratelimit.RateLimit{}),
+		WithDescription("Rate limits requests per author, user, client IP, or label value with a token bucket"))
+	registry.mustRegister("SilenceQuota", deciders.TemplateFunc(silencequota.New),
+		WithConfig(silencequota.SilenceQuota{}),
+		WithDescription("Limits how many active silences each author, or label value, can have at once"))
+	registry.mustRegister("CommentQuality", deciders.TemplateFunc(commentquality.New),
+		WithConfig(commentquality.CommentQuality{}),
+		WithDescription("Rejects silences with comments that are too short, vague, or just repeat the alertname"))
+	registry.mustRegister("OnlyOnCallOutsideBusinessHours", deciders.TemplateFunc(oncall.New),
+		WithConfig(oncall.OnlyOnCallOutsideBusinessHours{}),
+		WithDescription("Outside of business hours, only lets whoever is on call for a team silence its alerts"))
+
+	registry.mustRegisterHook("Mirror", deciders.HookTemplateFunc(mirror.NewHook),
+		WithConfig(mirror.MirrorDecider{}),
+		WithDescription("Mirrors requests to another Alertmanager"))
+	registry.mustRegisterHook("Notify", deciders.HookTemplateFunc(notify.New),
+		WithConfig(notify.Notify{}),
+		WithDescription("Sends rejections to a webhook, Slack, or an email address"))
+
+	registry.mustRegisterMutator("SilenceTemplate", deciders.MutatorTemplateFunc(silencetemplate.New),
+		WithConfig(silencetemplate.SilenceTemplate{}),
+		WithDescription("Fills in the author, comment, end time, and matchers of silences from templates, before the deciders run"))
+	return registry
+}
+
+// TemplateMetadata describes a registered Template or HookTemplate.
+type TemplateMetadata struct {
+	// Config is a zero value of the struct that the Template decodes its config into, if it has one.
+	// It is used to describe the config that the Template accepts.
+	Config interface{}
+
+	// Description is a human readable description of what the Deciders or Hooks made by the Template do.
+	Description string
+}
+
+// TemplateInfo is a Template, along with metadata describing it.
+type TemplateInfo struct {
+	TemplateMetadata
+	Template deciders.Template
+}
+
+// HookTemplateInfo is a HookTemplate, along with metadata describing it.
+type HookTemplateInfo struct {
+	TemplateMetadata
+	Template deciders.HookTemplate
+}
+
+// MutatorTemplateInfo is a MutatorTemplate, along with metadata describing it.
+type MutatorTemplateInfo struct {
+	TemplateMetadata
+	Template deciders.MutatorTemplate
+}
+
+// TemplateOption sets optional metadata on a registered Template.
+type TemplateOption func(*TemplateMetadata)
+
+// WithConfig sets the struct that the Template decodes its config into.
+func WithConfig(config interface{}) TemplateOption {
+	return func(metadata *TemplateMetadata) {
+		metadata.Config = config
+	}
+}
+
+// WithDescription sets the human readable description of the Template.
+func WithDescription(description string) TemplateOption {
+	return func(metadata *TemplateMetadata) {
+		metadata.Description = description
+	}
+}
+
+// registry is a set of named templates of one kind, along with their metadata.
+type registry[T any] struct {
+	// kind is what the templates are called in errors, e.g. "decider".
+	kind string
+
+	lock      sync.RWMutex
+	templates map[string]registryEntry[T]
+}
+
+type registryEntry[T any] struct {
+	TemplateMetadata
+	template T
+}
+
+func newRegistry[T any](kind string) *registry[T] {
+	return &registry[T]{
+		kind:      kind,
+		templates: make(map[string]registryEntry[T]),
+	}
+}
+
+func (r *registry[T]) register(name string, template T, opts []TemplateOption) error {
+	if name == "" {
+		return fmt.Errorf("%s templates must have a name", r.kind)
+	}
+
+	if any(template) == nil {
+		return fmt.Errorf("%s template %q is nil", r.kind, name)
+	}
+
+	entry := registryEntry[T]{
+		template: template,
+	}
+
+	for _, opt := range opts {
+		opt(&entry.TemplateMetadata)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, exists := r.templates[name]; exists {
+		return fmt.Errorf("a %s template named %q is already registered", r.kind, name)
+	}
+
+	r.templates[name] = entry
+	return nil
+}
+
+func (r *registry[T]) get(name string) (registryEntry[T], bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	entry, ok := r.templates[name]
+	return entry, ok
+}
+
+func (r *registry[T]) names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	names := make([]string, 0, len(r.templates))
+	for name := range r.templates {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Registry is a set of named Templates, HookTemplates, and MutatorTemplates that bouncer configs can refer to.
+type Registry struct {
+	templates *registry[deciders.Template]
+	hooks     *registry[deciders.HookTemplate]
+	mutators  *registry[deciders.MutatorTemplate]
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		templates: newRegistry[deciders.Template]("decider"),
+		hooks:     newRegistry[deciders.HookTemplate]("hook"),
+		mutators:  newRegistry[deciders.MutatorTemplate]("mutator"),
+	}
+}
+
+// Register adds the given Template to the Registry under the given name, returning an error if the name is already taken.
+func (r *Registry) Register(name string, template deciders.Template, opts ...TemplateOption) error {
+	return r.templates.register(name, template, opts)
+}
+
+func (r *Registry) mustRegister(name string, template deciders.Template, opts ...TemplateOption) {
+	if err := r.Register(name, template, opts...); err != nil {
+		panic(err)
+	}
+}
+
+// Get returns the Template registered under the given name.
+func (r *Registry) Get(name string) (deciders.Template, bool) {
+	info, ok := r.Info(name)
+	return info.Template, ok
+}
+
+// Info returns the Template registered under the given name, along with its metadata.
+func (r *Registry) Info(name string) (TemplateInfo, bool) {
+	entry, ok := r.templates.get(name)
+	return TemplateInfo{TemplateMetadata: entry.TemplateMetadata, Template: entry.template}, ok
+}
+
+// Names returns the sorted names of every Template in the Registry.
+func (r *Registry) Names() []string {
+	return r.templates.names()
+}
+
+// RegisterHook adds the given HookTemplate to the Registry under the given name, returning an error if the name is already taken.
+// Hooks have their own namespace, so a Hook can share a name with a Decider.
+func (r *Registry) RegisterHook(name string, template deciders.HookTemplate, opts ...TemplateOption) error {
+	return r.hooks.register(name, template, opts)
+}
+
+func (r *Registry) mustRegisterHook(name string, template deciders.HookTemplate, opts ...TemplateOption) {
+	if err := r.RegisterHook(name, template, opts...); err != nil {
+		panic(err)
+	}
+}
+
+// GetHook returns the HookTemplate registered under the given name.
+func (r *Registry) GetHook(name string) (deciders.HookTemplate, bool) {
+	info, ok := r.HookInfo(name)
+	return info.Template, ok
+}
+
+// HookInfo returns the HookTemplate registered under the given name, along with its metadata.
+func (r *Registry) HookInfo(name string) (HookTemplateInfo, bool) {
+	entry, ok := r.hooks.get(name)
+	return HookTemplateInfo{TemplateMetadata: entry.TemplateMetadata, Template: entry.template}, ok
+}
+
+// HookNames returns the sorted names of every HookTemplate in the Registry.
+func (r *Registry) HookNames() []string {
+	return r.hooks.names()
+}
+
+// RegisterMutator adds the given MutatorTemplate to the Registry under the given name, returning an error if the name is already taken.
+// Like Hooks, Mutators have their own namespace.
+func (r *Registry) RegisterMutator(name string, template deciders.MutatorTemplate, opts ...TemplateOption) error {
+	return r.mutators.register(name, template, opts)
+}
+
+func (r *Registry) mustRegisterMutator(name string, template deciders.MutatorTemplate, opts ...TemplateOption) {
+	if err := r.RegisterMutator(name, template, opts...); err != nil {
+		panic(err)
+	}
+}
+
+// GetMutator returns the MutatorTemplate registered under the given name.
+func (r *Registry) GetMutator(name string) (deciders.MutatorTemplate, bool) {
+	info, ok := r.MutatorInfo(name)
+	return info.Template, ok
+}
+
+// MutatorInfo returns the MutatorTemplate registered under the given name, along with its metadata.
+func (r *Registry) MutatorInfo(name string) (MutatorTemplateInfo, bool) {
+	entry, ok := r.mutators.get(name)
+	return MutatorTemplateInfo{TemplateMetadata: entry.TemplateMetadata, Template: entry.template}, ok
+}
+
+// MutatorNames returns the sorted names of every MutatorTemplate in the Registry.
+func (r *Registry) MutatorNames() []string {
+	return r.mutators.names()
+}
+
+// RegisterDeciderTemplate adds a Template to the DefaultRegistry, so that it can be used in configs passed to ParseBouncers.
+func RegisterDeciderTemplate(name string, template deciders.Template, opts ...TemplateOption) error {
+	return DefaultRegistry.Register(name, template, opts...)
+}
+
+// RegisterHookTemplate adds a HookTemplate to the DefaultRegistry, so that it can be used in configs passed to ParseBouncers.
+func RegisterHookTemplate(name string, template deciders.HookTemplate, opts ...TemplateOption) error {
+	return DefaultRegistry.RegisterHook(name, template, opts...)
+}
+
+// RegisterMutatorTemplate adds a MutatorTemplate to the DefaultRegistry, so that it can be used in configs passed to ParseBouncers.
+func RegisterMutatorTemplate(name string, template deciders.MutatorTemplate, opts ...TemplateOption) error {
+	return DefaultRegistry.RegisterMutator(name, template, opts...)
 }
 
+// GetDeciderTemplate returns the Template with the given name from the DefaultRegistry.
 func GetDeciderTemplate(name string) (deciders.Template, bool) {
-	template, ok := deciderTemplates[name]
-	return template, ok
+	return DefaultRegistry.Get(name)
 }
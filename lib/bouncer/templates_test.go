@@ -0,0 +1,127 @@
+package bouncer_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/deciders"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/testutil"
+)
+
+var rejectAll = deciders.TemplateFunc(func(config map[string]interface{}) (deciders.Decider, error) {
+	return deciders.DeciderFunc(func(req *http.Request) *deciders.HTTPError {
+		return &deciders.HTTPError{
+			Status: http.StatusForbidden,
+			Err:    "No",
+		}
+	}), nil
+})
+
+func TestRegistry(t *testing.T) {
+	registry := bouncer.NewRegistry()
+	require.NoError(t, registry.Register("RejectAll", rejectAll, bouncer.WithDescription("Rejects everything")))
+	require.Error(t, registry.Register("RejectAll", rejectAll), "Expected duplicate registrations to fail")
+	require.Error(t, registry.Register("", rejectAll))
+	require.Error(t, registry.Register("Nil", nil))
+	require.NoError(t, registry.Register("AnotherRejectAll", rejectAll))
+
+	require.Equal(t, []string{"AnotherRejectAll", "RejectAll"}, registry.Names())
+
+	info, ok := registry.Info("RejectAll")
+	require.True(t, ok)
+	require.Equal(t, "Rejects everything", info.Description)
+
+	_, ok = registry.Get("AllSilencesHaveAuthor")
+	require.False(t, ok, "Expected new registries to be empty")
+}
+
+func TestParseBouncersWithRegistry(t *testing.T) {
+	registry := bouncer.NewRegistry()
+	require.NoError(t, registry.Register("RejectAll", rejectAll))
+
+	serialized := []byte(`
+bouncers:
+  - method: POST
+    uriRegex: ".*"
+    deciders:
+      - name: RejectAll
+`)
+
+	bouncers, err := bouncer.ParseBouncersWithRegistry(serialized, registry)
+	require.NoError(t, err)
+	require.Len(t, bouncers, 1)
+
+	response := bouncers[0].Bounce(testutil.MustMakeRequest(t, http.MethodPost, "/api/v2/silences", ""))
+	require.NotNil(t, response)
+	require.Equal(t, http.StatusForbidden, response.Status)
+
+	_, err = bouncer.ParseBouncers(serialized)
+	require.Error(t, err, "Expected the default registry not to know about RejectAll")
+}
+
+func TestDefaultRegistryHasBuiltins(t *testing.T) {
+	for _, name := range []string{"AllSilencesHaveAuthor", "Mirror", "SilencesDontExpireOnWeekends", "LongSilencesHaveTicket"} {
+		_, ok := bouncer.GetDeciderTemplate(name)
+		require.True(t, ok, "Expected %q to be registered", name)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	registry := bouncer.NewRegistry()
+	require.NoError(t, registry.Register("RejectAll", rejectAll, bouncer.WithDescription("Rejects everything")))
+
+	schema := bouncer.Schema(registry)
+	bouncerSchema := schema["properties"].(map[string]interface{})["bouncers"].(map[string]interface{})["items"].(map[string]interface{})
+	properties := bouncerSchema["properties"].(map[string]interface{})
+	require.Contains(t, properties, "method")
+	require.Contains(t, properties, "uriRegex")
+
+	deciderSchemas := properties["deciders"].(map[string]interface{})["items"].(map[string]interface{})["oneOf"].([]interface{})
+	require.Len(t, deciderSchemas, 1)
+	require.Equal(t, "Rejects everything", deciderSchemas[0].(map[string]interface{})["description"])
+}
+
+func TestRegistryHooks(t *testing.T) {
+	registry := bouncer.NewRegistry()
+	noop := deciders.HookTemplateFunc(func(config map[string]interface{}) (deciders.Hook, error) {
+		return deciders.HookFunc(func(event *deciders.Event) {}), nil
+	})
+
+	require.NoError(t, registry.RegisterHook("Noop", noop))
+	require.EqualError(t, registry.RegisterHook("Noop", noop), `a hook template named "Noop" is already registered`)
+	require.Error(t, registry.RegisterHook("Nil", nil))
+	require.NoError(t, registry.Register("Noop", rejectAll), "Expected hooks and deciders to have separate namespaces")
+
+	require.Equal(t, []string{"Noop"}, registry.HookNames())
+	_, ok := registry.GetHook("Noop")
+	require.True(t, ok)
+}
+
+func TestRegistryMutators(t *testing.T) {
+	registry := bouncer.NewRegistry()
+	noop := deciders.MutatorTemplateFunc(func(config map[string]interface{}) (deciders.Mutator, error) {
+		return deciders.MutatorFunc(func(req *http.Request, body []byte) ([]byte, *deciders.HTTPError) {
+			return body, nil
+		}), nil
+	})
+
+	require.NoError(t, registry.RegisterMutator("Noop", noop))
+	require.EqualError(t, registry.RegisterMutator("Noop", noop), `a mutator template named "Noop" is already registered`)
+	require.Error(t, registry.RegisterMutator("Nil", nil))
+	require.NoError(t, registry.Register("Noop", rejectAll), "Expected mutators and deciders to have separate namespaces")
+
+	require.Equal(t, []string{"Noop"}, registry.MutatorNames())
+	_, ok := registry.GetMutator("Noop")
+	require.True(t, ok)
+
+	_, err := bouncer.ParseBouncersWithRegistry([]byte(`
+bouncers:
+  - method: POST
+    mutators:
+      - name: Missing
+`), registry)
+	require.Error(t, err, "Expected unknown mutators to be rejected")
+}
@@ -0,0 +1,44 @@
+package testutil
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/sinkingpoint/alertmanager_bouncer/lib/bouncer/backend"
+)
+
+// FakeBackend is a backend.Client that serves silences and alerts from memory.
+type FakeBackend struct {
+	Silences []types.Silence
+	Alerts   []model.Alert
+	Err      error
+}
+
+func (f *FakeBackend) GetSilence(ctx context.Context, id string) (types.Silence, error) {
+	if f.Err != nil {
+		return types.Silence{}, f.Err
+	}
+
+	for _, silence := range f.Silences {
+		if silence.ID == id {
+			return silence, nil
+		}
+	}
+
+	return types.Silence{}, backend.ErrNotFound
+}
+
+func (f *FakeBackend) ListSilences(ctx context.Context) ([]types.Silence, error) {
+	return f.Silences, f.Err
+}
+
+func (f *FakeBackend) ListAlerts(ctx context.Context) ([]model.Alert, error) {
+	return f.Alerts, f.Err
+}
+
+// WithBackend returns a copy of the given request that carries the given backend Client, as if it had passed through the bouncer.
+func WithBackend(req *http.Request, client backend.Client) *http.Request {
+	return req.WithContext(backend.NewContext(req.Context(), client))
+}